@@ -0,0 +1,174 @@
+package addresses
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-com/models"
+)
+
+var ErrInvalidAddress = errors.New("Address is not valid")
+
+// FieldError tells what is wrong with one field, named the way it is in JSON
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with an address. It matches
+// ErrInvalidAddress with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, 0, len(err.Fields))
+	for _, field := range err.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+
+	return fmt.Sprintf("%v: %s", ErrInvalidAddress, strings.Join(messages, "; "))
+}
+
+func (err *ValidationError) Is(target error) bool {
+	return target == ErrInvalidAddress
+}
+
+// CountryRules knows how addresses are written in one country. Normalize puts
+// an address in the country's usual form and Validate then checks it.
+type CountryRules interface {
+	Country() string
+	Normalize(address *models.Address)
+	Validate(address models.Address) []FieldError
+}
+
+// Registry looks up the rules of a country by its ISO 3166-1 alpha-2 code.
+// Countries without rules of their own get the fallback.
+type Registry struct {
+	rules    map[string]CountryRules
+	fallback CountryRules
+}
+
+func NewRegistry(fallback CountryRules, rules ...CountryRules) *Registry {
+	registry := &Registry{rules: make(map[string]CountryRules), fallback: fallback}
+	for _, country := range rules {
+		registry.rules[country.Country()] = country
+	}
+
+	return registry
+}
+
+// Default knows the countries in Countries and checks every other country,
+// and addresses without one, with Anywhere
+func Default() *Registry {
+	rules := make([]CountryRules, 0, len(Countries))
+	for _, country := range Countries {
+		rules = append(rules, country)
+	}
+
+	return NewRegistry(Anywhere, rules...)
+}
+
+func (registry *Registry) Rules(country string) CountryRules {
+	if rules, ok := registry.rules[country]; ok {
+		return rules
+	}
+
+	return registry.fallback
+}
+
+// field is one text field of an address with the limits every country shares
+type field struct {
+	name     string
+	value    **string
+	required bool
+	max      int
+}
+
+func fields(address *models.Address) []field {
+	return []field{
+		{"label", &address.Label, false, 50},
+		{"recipient_name", &address.Recipient_name, false, 100},
+		{"phone", &address.Phone, false, 30},
+		{"house_name", &address.House, true, 100},
+		{"street_name", &address.Street, true, 200},
+		{"address_line2", &address.Line2, false, 200},
+		{"city_name", &address.City, true, 100},
+		{"region", &address.Region, false, 100},
+		{"postcode", &address.PostCode, false, 20},
+	}
+}
+
+// Check trims the address, puts it in the form its country uses and validates
+// it. The address is changed in place, also when it turns out not to be valid.
+func (registry *Registry) Check(address *models.Address) error {
+	address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+	for _, f := range fields(address) {
+		if *f.value == nil {
+			continue
+		}
+		trimmed := strings.Join(strings.Fields(**f.value), " ")
+		*f.value = &trimmed
+		if trimmed == "" {
+			*f.value = nil
+		}
+	}
+
+	rules := registry.Rules(address.Country)
+	rules.Normalize(address)
+
+	var problems []FieldError
+	if address.Country != "" && !isCountryCode(address.Country) {
+		problems = append(problems, FieldError{"country", "must be a two letter ISO 3166-1 country code"})
+	}
+	for _, f := range fields(address) {
+		switch {
+		case *f.value == nil && f.required:
+			problems = append(problems, FieldError{f.name, "is required"})
+		case *f.value != nil && len([]rune(**f.value)) > f.max:
+			problems = append(problems, FieldError{f.name, fmt.Sprintf("must be at most %d characters", f.max)})
+		}
+	}
+	if address.Phone != nil && !isPhone(*address.Phone) {
+		problems = append(problems, FieldError{"phone", "must be a phone number of 6 to 15 digits"})
+	}
+	problems = append(problems, rules.Validate(*address)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Fields: problems}
+	}
+
+	return nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPhone accepts digits with the usual separators and an optional leading +
+func isPhone(phone string) bool {
+	digits := 0
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return false
+		}
+	}
+
+	return digits >= 6 && digits <= 15
+}
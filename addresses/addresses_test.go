@@ -0,0 +1,144 @@
+package addresses
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-com/models"
+)
+
+func text(value string) *string {
+	return &value
+}
+
+// address is a valid street address in the country with the postcode and region
+func address(country string, postcode, region *string) models.Address {
+	return models.Address{
+		House:    text("1"),
+		Street:   text("Main Street"),
+		City:     text("Springfield"),
+		Country:  country,
+		PostCode: postcode,
+		Region:   region,
+	}
+}
+
+func TestCheckCountryRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  models.Address
+		postcode *string
+		region   *string
+		fields   []string
+	}{
+		{"US", address("us", text("62704"), text("il")), text("62704"), text("IL"), nil},
+		{"US zip+4", address("US", text("62704-1234"), text("IL")), text("62704-1234"), text("IL"), nil},
+		{"US short zip", address("US", text("6270"), text("IL")), text("6270"), text("IL"), []string{"postcode"}},
+		{"US unknown state", address("US", text("62704"), text("XX")), text("62704"), text("XX"), []string{"region"}},
+		{"US without a state", address("US", text("62704"), nil), text("62704"), nil, []string{"region"}},
+		{"US without a zip", address("US", nil, text("IL")), nil, text("IL"), []string{"postcode"}},
+		{"CA", address("CA", text("k1a0b1"), text("on")), text("K1A 0B1"), text("ON"), nil},
+		{"CA letter not used", address("CA", text("D1A 0B1"), text("ON")), text("D1A 0B1"), text("ON"), []string{"postcode"}},
+		{"GB", address("GB", text("sw1a1aa"), nil), text("SW1A 1AA"), nil, nil},
+		{"GB any region", address("GB", text("SW1A 1AA"), text("Greater London")), text("SW1A 1AA"), text("Greater London"), nil},
+		{"GB wrong shape", address("GB", text("12345"), nil), text("12 345"), nil, []string{"postcode"}},
+		{"IE", address("IE", text("d02x285"), nil), text("D02 X285"), nil, nil},
+		{"NL", address("NL", text("1012ab"), nil), text("1012 AB"), nil, nil},
+		{"NL leading zero", address("NL", text("0123 AB"), nil), text("0123 AB"), nil, []string{"postcode"}},
+		{"DE", address("DE", text("10115"), nil), text("10115"), nil, nil},
+		{"AU", address("AU", text("2000"), text("nsw")), text("2000"), text("NSW"), nil},
+		{"IN without a state", address("IN", text("110001"), nil), text("110001"), nil, []string{"region"}},
+		{"JP", address("JP", text("1000001"), text("Tokyo")), text("100-0001"), text("Tokyo"), nil},
+		{"HK drops the postcode", address("HK", text("999077"), nil), nil, nil, nil},
+		{"elsewhere", address("BR", text("01310-100"), nil), text("01310-100"), nil, nil},
+		{"elsewhere without a postcode", address("BR", nil, nil), nil, nil, []string{"postcode"}},
+		{"no country", address("", text("12345"), nil), text("12345"), nil, nil},
+		{"not a country code", address("USA", text("62704"), nil), text("62704"), nil, []string{"country"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address := test.address
+			err := Default().Check(&address)
+
+			var invalid *ValidationError
+			var fields []string
+			if errors.As(err, &invalid) {
+				for _, field := range invalid.Fields {
+					fields = append(fields, field.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("Check() error = %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("Check() found %v wrong, want %v: %v", fields, test.fields, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("Check() error = %v, want it to be %v", err, ErrInvalidAddress)
+			}
+
+			if !reflect.DeepEqual(address.PostCode, test.postcode) {
+				t.Errorf("postcode = %v, want %v", deref(address.PostCode), deref(test.postcode))
+			}
+			if !reflect.DeepEqual(address.Region, test.region) {
+				t.Errorf("region = %v, want %v", deref(address.Region), deref(test.region))
+			}
+		})
+	}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return "<nil>"
+	}
+	return *value
+}
+
+func TestCheckSharedFields(t *testing.T) {
+	long := make([]rune, 101)
+	for i := range long {
+		long[i] = 'é'
+	}
+
+	tests := []struct {
+		name   string
+		change func(address *models.Address)
+		fields []string
+	}{
+		{"trimmed", func(address *models.Address) { address.Street = text("  Main   Street ") }, nil},
+		{"blank house", func(address *models.Address) { address.House = text("   ") }, []string{"house_name"}},
+		{"everything missing", func(address *models.Address) {
+			address.House, address.Street, address.City = nil, nil, nil
+		}, []string{"house_name", "street_name", "city_name"}},
+		{"too long", func(address *models.Address) { address.City = text(string(long)) }, []string{"city_name"}},
+		{"phone", func(address *models.Address) { address.Phone = text("+1 (555) 010-0000") }, nil},
+		{"short phone", func(address *models.Address) { address.Phone = text("555") }, []string{"phone"}},
+		{"phone with letters", func(address *models.Address) { address.Phone = text("555-CALL-NOW") }, []string{"phone"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address := address("DE", text("10115"), nil)
+			test.change(&address)
+
+			err := Default().Check(&address)
+			var fields []string
+			var invalid *ValidationError
+			if errors.As(err, &invalid) {
+				for _, field := range invalid.Fields {
+					fields = append(fields, field.Field)
+				}
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("Check() found %v wrong, want %v: %v", fields, test.fields, err)
+			}
+		})
+	}
+
+	trimmed := address("DE", text("10115"), nil)
+	trimmed.Street = text("  Main   Street ")
+	if err := Default().Check(&trimmed); err != nil || *trimmed.Street != "Main Street" {
+		t.Errorf("Check() left the street as %q, %v, want Main Street", *trimmed.Street, err)
+	}
+}
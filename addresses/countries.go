@@ -0,0 +1,187 @@
+package addresses
+
+import (
+	"regexp"
+	"strings"
+
+	"go-com/models"
+)
+
+// Format describes how a country writes its addresses with a table instead of
+// code. It implements CountryRules.
+type Format struct {
+	Code string
+
+	// Postcode is the shape of a postcode once normalized, nil accepts any.
+	// Countries without postcodes set No_postcode and have theirs dropped.
+	Postcode         *regexp.Regexp
+	Postcode_example string
+	No_postcode      bool
+
+	// Postcodes are upper-cased and, when Postcode_gap is set, written with
+	// Postcode_separator (a space by default) before their last Postcode_gap characters
+	Upper_postcode     bool
+	Postcode_gap       int
+	Postcode_separator string
+
+	// Regions lists the region codes the country accepts, upper-cased.
+	// Require_region makes the region part of every address.
+	Regions        []string
+	Require_region bool
+}
+
+func (format Format) Country() string {
+	return format.Code
+}
+
+func (format Format) Normalize(address *models.Address) {
+	if format.No_postcode {
+		address.PostCode = nil
+	}
+
+	if address.PostCode != nil {
+		postcode := *address.PostCode
+		if format.Upper_postcode {
+			postcode = strings.ToUpper(postcode)
+		}
+		if format.Postcode_gap > 0 {
+			separator := format.Postcode_separator
+			if separator == "" {
+				separator = " "
+			}
+			postcode = strings.NewReplacer(" ", "", "-", "").Replace(postcode)
+			if len(postcode) > format.Postcode_gap {
+				cut := len(postcode) - format.Postcode_gap
+				postcode = postcode[:cut] + separator + postcode[cut:]
+			}
+		}
+		address.PostCode = &postcode
+	}
+
+	if address.Region != nil && len(format.Regions) > 0 {
+		region := strings.ToUpper(*address.Region)
+		address.Region = &region
+	}
+}
+
+func (format Format) Validate(address models.Address) []FieldError {
+	var problems []FieldError
+
+	switch {
+	case format.No_postcode:
+	case address.PostCode == nil:
+		problems = append(problems, FieldError{"postcode", "is required"})
+	case format.Postcode != nil && !format.Postcode.MatchString(*address.PostCode):
+		problems = append(problems, FieldError{"postcode", "must look like " + format.Postcode_example})
+	}
+
+	switch {
+	case address.Region == nil:
+		if format.Require_region {
+			problems = append(problems, FieldError{"region", "is required"})
+		}
+	case len(format.Regions) > 0 && !contains(format.Regions, *address.Region):
+		problems = append(problems, FieldError{"region", "is not a region of " + format.Code})
+	}
+
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Anywhere checks addresses of countries without a Format of their own, and
+// addresses from before addresses had a country: a postcode of any shape is enough
+var Anywhere = Format{}
+
+// Countries are the formats Default knows
+var Countries = []Format{
+	{
+		Code:             "US",
+		Postcode:         regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+		Postcode_example: "12345 or 12345-6789",
+		Regions: []string{
+			"AL", "AK", "AZ", "AR", "CA", "CO", "CT", "DE", "DC", "FL", "GA", "HI", "ID", "IL", "IN", "IA",
+			"KS", "KY", "LA", "ME", "MD", "MA", "MI", "MN", "MS", "MO", "MT", "NE", "NV", "NH", "NJ", "NM",
+			"NY", "NC", "ND", "OH", "OK", "OR", "PA", "RI", "SC", "SD", "TN", "TX", "UT", "VT", "VA", "WA",
+			"WV", "WI", "WY", "AS", "GU", "MP", "PR", "VI", "AA", "AE", "AP",
+		},
+		Require_region: true,
+	},
+	{
+		Code:             "CA",
+		Postcode:         regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] \d[ABCEGHJ-NPRSTV-Z]\d$`),
+		Postcode_example: "K1A 0B1",
+		Upper_postcode:   true,
+		Postcode_gap:     3,
+		Regions:          []string{"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"},
+		Require_region:   true,
+	},
+	{
+		Code:             "GB",
+		Postcode:         regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]?|GIR) \d[A-Z]{2}$`),
+		Postcode_example: "SW1A 1AA",
+		Upper_postcode:   true,
+		Postcode_gap:     3,
+	},
+	{
+		Code:             "IE",
+		Postcode:         regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W) [0-9AC-FHKNPRTV-Y]{4}$`),
+		Postcode_example: "D02 X285",
+		Upper_postcode:   true,
+		Postcode_gap:     4,
+	},
+	{
+		Code:             "DE",
+		Postcode:         regexp.MustCompile(`^\d{5}$`),
+		Postcode_example: "10115",
+	},
+	{
+		Code:             "FR",
+		Postcode:         regexp.MustCompile(`^\d{5}$`),
+		Postcode_example: "75008",
+	},
+	{
+		Code:             "NL",
+		Postcode:         regexp.MustCompile(`^[1-9]\d{3} [A-Z]{2}$`),
+		Postcode_example: "1012 AB",
+		Upper_postcode:   true,
+		Postcode_gap:     2,
+	},
+	{
+		Code:             "AU",
+		Postcode:         regexp.MustCompile(`^\d{4}$`),
+		Postcode_example: "2000",
+		Regions:          []string{"ACT", "NSW", "NT", "QLD", "SA", "TAS", "VIC", "WA"},
+		Require_region:   true,
+	},
+	{
+		Code:             "IN",
+		Postcode:         regexp.MustCompile(`^[1-9]\d{5}$`),
+		Postcode_example: "110001",
+		Require_region:   true,
+	},
+	{
+		Code:               "JP",
+		Postcode:           regexp.MustCompile(`^\d{3}-\d{4}$`),
+		Postcode_example:   "100-0001",
+		Postcode_gap:       4,
+		Postcode_separator: "-",
+		Require_region:     true,
+	},
+	{
+		Code:        "HK",
+		No_postcode: true,
+	},
+	{
+		Code:        "AE",
+		No_postcode: true,
+	},
+}
@@ -0,0 +1,159 @@
+package carts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-com/catalog"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrUnknownMergeStrategy = errors.New("Cart merge strategy is not known")
+
+// GuestLifetime is how long a guest cart is kept after it last changed
+const GuestLifetime = 30 * 24 * time.Hour
+
+// Expired reports whether the guest cart went unused for longer than GuestLifetime
+func Expired(cart models.GuestCart, now time.Time) bool {
+	return now.Sub(cart.Updated_at) > GuestLifetime
+}
+
+// MergeStrategy decides the quantity of a product that is in both the guest
+// cart and the user's cart when the guest logs in
+type MergeStrategy string
+
+const (
+	// MergeSum adds both quantities up
+	MergeSum MergeStrategy = "sum"
+	// MergeMax keeps the larger of the two
+	MergeMax MergeStrategy = "max"
+	// MergeKeepUser keeps what was in the user's cart
+	MergeKeepUser MergeStrategy = "keep_user"
+	// MergeKeepGuest takes what was in the guest cart
+	MergeKeepGuest MergeStrategy = "keep_guest"
+)
+
+// ParseMergeStrategy reads a strategy by its name, MergeSum when there is none
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	switch strategy := MergeStrategy(name); strategy {
+	case "":
+		return MergeSum, nil
+	case MergeSum, MergeMax, MergeKeepUser, MergeKeepGuest:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownMergeStrategy, name)
+	}
+}
+
+// Find returns the index of the line of the product, or of one variant of it, or -1
+func Find(cart []models.ProductUser, productID primitive.ObjectID, sku string) int {
+	for i, item := range cart {
+		if item.Product_id == productID && item.Sku == sku {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Remove returns the cart without the line of the product or variant
+func Remove(cart []models.ProductUser, productID primitive.ObjectID, sku string) []models.ProductUser {
+	remaining := make([]models.ProductUser, 0, len(cart))
+	for _, item := range cart {
+		if item.Product_id != productID || item.Sku != sku {
+			remaining = append(remaining, item)
+		}
+	}
+
+	return remaining
+}
+
+// Merge moves the lines of the guest cart into the user's cart. Products in
+// both carts get the quantity the strategy picks, the rest of the guest lines
+// are added as they are. What comes from the guest cart is held to what stock
+// says is available: lines that can't be bought any more are left out and the
+// others are cut down to the stock. The user's own quantities are only ever
+// lowered by MergeKeepGuest.
+func Merge(user, guest []models.ProductUser, strategy MergeStrategy, stock func(models.ProductUser) (int, bool)) []models.ProductUser {
+	merged := append([]models.ProductUser{}, user...)
+	for _, item := range guest {
+		available, ok := stock(item)
+		if !ok || available <= 0 {
+			continue
+		}
+
+		line := Find(merged, item.Product_id, item.Sku)
+		if line < 0 {
+			if item.Quantity > available {
+				item.Quantity = available
+			}
+			if item.Quantity > 0 {
+				merged = append(merged, item)
+			}
+			continue
+		}
+
+		quantity := merged[line].Quantity
+		switch strategy {
+		case MergeSum:
+			quantity += item.Quantity
+		case MergeMax:
+			if item.Quantity > quantity {
+				quantity = item.Quantity
+			}
+		case MergeKeepGuest:
+			quantity = item.Quantity
+		}
+		if quantity > available {
+			quantity = available
+		}
+		if quantity < merged[line].Quantity && strategy != MergeKeepGuest {
+			quantity = merged[line].Quantity
+		}
+		merged[line].Quantity = quantity
+	}
+
+	return merged
+}
+
+// PriceWishlist lists the wishlist with the current details of its products.
+// Items whose product isn't among products are listed as not available.
+func PriceWishlist(items []models.WishlistItem, products []models.Product) []models.WishlistLine {
+	found := make(map[primitive.ObjectID]models.Product, len(products))
+	for _, product := range products {
+		found[product.Product_id] = product
+	}
+
+	lines := make([]models.WishlistLine, 0, len(items))
+	for _, item := range items {
+		line := models.WishlistLine{Product_id: item.Product_id, Sku: item.Sku, Added_at: item.Added_at}
+		product, ok := found[item.Product_id]
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+
+		line.Product_name = product.Product_name
+		line.Image = product.Image
+		price, stock := product.Price, product.Stock
+		variant, err := catalog.FindVariant(product, item.Sku)
+		if variant != nil {
+			line.Attributes = variant.Attributes
+			price, stock = variant.Price, variant.Stock
+			if variant.Image != nil {
+				line.Image = variant.Image
+			}
+		}
+		if err == nil && !product.Archived {
+			line.Available = true
+			line.Price = &price
+			line.In_stock = stock > 0
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
@@ -0,0 +1,218 @@
+package carts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var (
+	mug    = primitive.NewObjectID()
+	teapot = primitive.NewObjectID()
+	shirt  = primitive.NewObjectID()
+)
+
+func line(productID primitive.ObjectID, sku string, quantity int) models.ProductUser {
+	return models.ProductUser{Product_id: productID, Sku: sku, Quantity: quantity}
+}
+
+// inStock says how many of each line can be bought, products missing from it are gone
+func inStock(stock map[primitive.ObjectID]int) func(models.ProductUser) (int, bool) {
+	return func(item models.ProductUser) (int, bool) {
+		available, ok := stock[item.Product_id]
+		return available, ok
+	}
+}
+
+func TestMerge(t *testing.T) {
+	plenty := map[primitive.ObjectID]int{mug: 100, teapot: 100, shirt: 100}
+
+	tests := []struct {
+		name     string
+		user     []models.ProductUser
+		guest    []models.ProductUser
+		strategy MergeStrategy
+		stock    map[primitive.ObjectID]int
+		want     []models.ProductUser
+	}{
+		{"sum", []models.ProductUser{line(mug, "", 2)}, []models.ProductUser{line(mug, "", 3), line(teapot, "", 1)}, MergeSum, plenty,
+			[]models.ProductUser{line(mug, "", 5), line(teapot, "", 1)}},
+		{"max of more", []models.ProductUser{line(mug, "", 2)}, []models.ProductUser{line(mug, "", 3)}, MergeMax, plenty,
+			[]models.ProductUser{line(mug, "", 3)}},
+		{"max of less", []models.ProductUser{line(mug, "", 4)}, []models.ProductUser{line(mug, "", 3)}, MergeMax, plenty,
+			[]models.ProductUser{line(mug, "", 4)}},
+		{"keep user", []models.ProductUser{line(mug, "", 2)}, []models.ProductUser{line(mug, "", 3), line(teapot, "", 1)}, MergeKeepUser, plenty,
+			[]models.ProductUser{line(mug, "", 2), line(teapot, "", 1)}},
+		{"keep guest", []models.ProductUser{line(mug, "", 4)}, []models.ProductUser{line(mug, "", 1)}, MergeKeepGuest, plenty,
+			[]models.ProductUser{line(mug, "", 1)}},
+		{"variants are lines of their own", []models.ProductUser{line(shirt, "S", 1)}, []models.ProductUser{line(shirt, "M", 2), line(shirt, "S", 1)}, MergeSum, plenty,
+			[]models.ProductUser{line(shirt, "S", 2), line(shirt, "M", 2)}},
+		{"empty guest cart", []models.ProductUser{line(mug, "", 2)}, nil, MergeSum, plenty,
+			[]models.ProductUser{line(mug, "", 2)}},
+		{"empty user cart", nil, []models.ProductUser{line(mug, "", 2)}, MergeKeepUser, plenty,
+			[]models.ProductUser{line(mug, "", 2)}},
+
+		{"sum capped by stock", []models.ProductUser{line(mug, "", 2)}, []models.ProductUser{line(mug, "", 3)}, MergeSum, map[primitive.ObjectID]int{mug: 4},
+			[]models.ProductUser{line(mug, "", 4)}},
+		{"new line capped by stock", nil, []models.ProductUser{line(mug, "", 3)}, MergeSum, map[primitive.ObjectID]int{mug: 2},
+			[]models.ProductUser{line(mug, "", 2)}},
+		{"guest line out of stock", nil, []models.ProductUser{line(mug, "", 3)}, MergeSum, map[primitive.ObjectID]int{mug: 0},
+			[]models.ProductUser{}},
+		{"guest line of a product that is gone", nil, []models.ProductUser{line(mug, "", 3)}, MergeSum, map[primitive.ObjectID]int{},
+			[]models.ProductUser{}},
+
+		// Only MergeKeepGuest may lower what the user had, stock doesn't
+		{"sum over stock the user is already over", []models.ProductUser{line(mug, "", 5)}, []models.ProductUser{line(mug, "", 1)}, MergeSum, map[primitive.ObjectID]int{mug: 3},
+			[]models.ProductUser{line(mug, "", 5)}},
+		{"max over stock the user is already over", []models.ProductUser{line(mug, "", 5)}, []models.ProductUser{line(mug, "", 6)}, MergeMax, map[primitive.ObjectID]int{mug: 3},
+			[]models.ProductUser{line(mug, "", 5)}},
+		{"keep user over stock", []models.ProductUser{line(mug, "", 5)}, []models.ProductUser{line(mug, "", 1)}, MergeKeepUser, map[primitive.ObjectID]int{mug: 3},
+			[]models.ProductUser{line(mug, "", 5)}},
+		{"user line out of stock", []models.ProductUser{line(mug, "", 5)}, []models.ProductUser{line(mug, "", 1)}, MergeSum, map[primitive.ObjectID]int{mug: 0},
+			[]models.ProductUser{line(mug, "", 5)}},
+		{"keep guest over stock", []models.ProductUser{line(mug, "", 5)}, []models.ProductUser{line(mug, "", 4)}, MergeKeepGuest, map[primitive.ObjectID]int{mug: 3},
+			[]models.ProductUser{line(mug, "", 3)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := append([]models.ProductUser{}, test.user...)
+			merged := Merge(user, test.guest, test.strategy, inStock(test.stock))
+			if len(merged) != len(test.want) {
+				t.Fatalf("Merge() = %+v, want %+v", merged, test.want)
+			}
+			for i, want := range test.want {
+				if merged[i].Product_id != want.Product_id || merged[i].Sku != want.Sku || merged[i].Quantity != want.Quantity {
+					t.Errorf("Merge() line %d = %+v, want %+v", i, merged[i], want)
+				}
+			}
+			for i, item := range test.user {
+				if user[i].Quantity != item.Quantity {
+					t.Errorf("Merge() changed the user's cart it was given, line %d is %+v", i, user[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	tests := []struct {
+		name string
+		want MergeStrategy
+		err  error
+	}{
+		{"", MergeSum, nil},
+		{"sum", MergeSum, nil},
+		{"max", MergeMax, nil},
+		{"keep_user", MergeKeepUser, nil},
+		{"keep_guest", MergeKeepGuest, nil},
+		{"SUM", "", ErrUnknownMergeStrategy},
+		{"replace", "", ErrUnknownMergeStrategy},
+	}
+
+	for _, test := range tests {
+		strategy, err := ParseMergeStrategy(test.name)
+		if !errors.Is(err, test.err) || strategy != test.want {
+			t.Errorf("ParseMergeStrategy(%q) = %q, %v, want %q, %v", test.name, strategy, err, test.want, test.err)
+		}
+	}
+}
+
+func TestFindAndRemove(t *testing.T) {
+	cart := []models.ProductUser{line(mug, "", 1), line(shirt, "S", 2), line(shirt, "M", 3)}
+
+	if i := Find(cart, shirt, "M"); i != 2 {
+		t.Errorf("Find(shirt, M) = %d, want 2", i)
+	}
+	if i := Find(cart, shirt, ""); i != -1 {
+		t.Errorf("Find(shirt) without a sku = %d, want -1", i)
+	}
+
+	remaining := Remove(cart, shirt, "S")
+	if len(remaining) != 2 || Find(remaining, shirt, "S") != -1 || Find(remaining, shirt, "M") != 1 {
+		t.Errorf("Remove(shirt, S) = %+v, want the mug and the M shirt", remaining)
+	}
+	if len(cart) != 3 {
+		t.Errorf("Remove() changed the cart it was given to %+v", cart)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	cart := models.GuestCart{Updated_at: at}
+	if Expired(cart, at.Add(GuestLifetime)) {
+		t.Error("Expired() = true right at the end of its lifetime")
+	}
+	if !Expired(cart, at.Add(GuestLifetime+time.Second)) {
+		t.Error("Expired() = false after its lifetime")
+	}
+}
+
+func TestPriceWishlist(t *testing.T) {
+	name, image, blue := "Mug", "mug.png", "shirt-blue.png"
+	archived := primitive.NewObjectID()
+	gone := primitive.NewObjectID()
+	products := []models.Product{
+		{Product_id: mug, Product_name: &name, Image: &image, Price: models.NewMoney(1250, "USD"), Stock: 3},
+		{Product_id: teapot, Product_name: &name, Price: models.NewMoney(3000, "USD"), Stock: 0},
+		{Product_id: shirt, Product_name: &name, Image: &image, Price: models.NewMoney(1400, "USD"), Stock: 5,
+			Attributes: []models.ProductAttribute{{Name: "colour", Values: []string{"red", "blue"}}},
+			Variants: []models.Variant{
+				{Sku: "RED", Attributes: map[string]string{"colour": "red"}, Price: models.NewMoney(1500, "USD"), Stock: 0},
+				{Sku: "BLUE", Attributes: map[string]string{"colour": "blue"}, Price: models.NewMoney(1400, "USD"), Image: &blue, Stock: 5},
+			}},
+		{Product_id: archived, Product_name: &name, Price: models.NewMoney(500, "USD"), Stock: 9, Archived: true},
+	}
+
+	tests := []struct {
+		name      string
+		item      models.WishlistItem
+		available bool
+		inStock   bool
+		price     int64
+		image     string
+	}{
+		{"product", models.WishlistItem{Product_id: mug}, true, true, 1250, image},
+		{"out of stock", models.WishlistItem{Product_id: teapot}, true, false, 3000, ""},
+		{"variant with its own image", models.WishlistItem{Product_id: shirt, Sku: "BLUE"}, true, true, 1400, blue},
+		{"variant out of stock", models.WishlistItem{Product_id: shirt, Sku: "RED"}, true, false, 1500, image},
+		{"variant that no longer exists", models.WishlistItem{Product_id: shirt, Sku: "GREEN"}, false, false, 0, image},
+		{"archived product", models.WishlistItem{Product_id: archived}, false, false, 0, ""},
+		{"deleted product", models.WishlistItem{Product_id: gone}, false, false, 0, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.item.Added_at = at
+			lines := PriceWishlist([]models.WishlistItem{test.item}, products)
+			if len(lines) != 1 {
+				t.Fatalf("PriceWishlist() = %d lines, want 1", len(lines))
+			}
+			line := lines[0]
+			if line.Product_id != test.item.Product_id || line.Sku != test.item.Sku || !line.Added_at.Equal(at) {
+				t.Errorf("PriceWishlist() = %+v, want the item it was given", line)
+			}
+			if line.Available != test.available || line.In_stock != test.inStock {
+				t.Errorf("PriceWishlist() available = %v, in stock = %v, want %v and %v", line.Available, line.In_stock, test.available, test.inStock)
+			}
+			if test.available && (line.Price == nil || *line.Price != models.NewMoney(test.price, "USD")) {
+				t.Errorf("PriceWishlist() price = %v, want %d", line.Price, test.price)
+			}
+			if !test.available && line.Price != nil {
+				t.Errorf("PriceWishlist() price = %v, want none for a line that can't be bought", *line.Price)
+			}
+			if (line.Image == nil && test.image != "") || (line.Image != nil && *line.Image != test.image) {
+				t.Errorf("PriceWishlist() image = %v, want %q", line.Image, test.image)
+			}
+		})
+	}
+
+	if lines := PriceWishlist(nil, products); len(lines) != 0 {
+		t.Errorf("PriceWishlist() of an empty wishlist = %+v, want none", lines)
+	}
+}
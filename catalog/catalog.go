@@ -0,0 +1,289 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidCursor = errors.New("Cursor is not valid for this listing")
+	ErrInvalidQuery  = errors.New("Listing options are not valid")
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// SortField is what a listing is ordered by. Products with the same value are
+// ordered by id, so every product has exactly one place in the listing.
+type SortField string
+
+const (
+	SortNewest SortField = "newest"
+	SortPrice  SortField = "price"
+	SortRating SortField = "rating"
+	SortName   SortField = "name"
+)
+
+// Query is one page of a product listing. Name is matched by the store as a
+// plain piece of text and Terms, when set, turn the listing into a search.
+// Categories keeps the products in any of them, callers browsing a category
+// pass it along with its Descendants. The other filters mean the same thing
+// everywhere. Facets has a listing count facets too, searches always do.
+type Query struct {
+	Name       string
+	Terms      []string
+	Sort       SortField
+	Descending bool
+	Currency   string
+	Min_price  *int64
+	Max_price  *int64
+	Min_rating *uint8
+	Categories []primitive.ObjectID
+	Limit      int
+	After      *Cursor
+	Facets     bool
+}
+
+// Page is what a listing responds with. Next_cursor is empty on the last page
+// and Facets is only there when the query asked for it.
+type Page struct {
+	Products    []models.Product `json:"products"`
+	Next_cursor string           `json:"next_cursor"`
+	Total       int64            `json:"total"`
+	Facets      *Facets          `json:"facets,omitempty"`
+}
+
+// Cursor remembers the last product of a page, so the next page starts right
+// after it even when products were added or removed in between
+type Cursor struct {
+	Sort       SortField          `json:"s"`
+	Descending bool               `json:"d"`
+	Number     *int64             `json:"n,omitempty"`
+	Text       *string            `json:"t,omitempty"`
+	Score      *float64           `json:"r,omitempty"`
+	ID         primitive.ObjectID `json:"id"`
+}
+
+// ParseSort reads the sort and order options. Without an order prices and names
+// go up, ratings go down and newest is always the latest first.
+func ParseSort(sort, order string) (SortField, bool, error) {
+	field := SortField(strings.ToLower(sort))
+	if field == "" {
+		field = SortNewest
+	}
+
+	var descending bool
+	switch field {
+	case SortNewest, SortRating:
+		descending = true
+	case SortPrice, SortName:
+	default:
+		return "", false, ErrInvalidQuery
+	}
+
+	switch strings.ToLower(order) {
+	case "":
+	case "asc":
+		descending = false
+	case "desc":
+		descending = true
+	default:
+		return "", false, ErrInvalidQuery
+	}
+	if field == SortNewest {
+		descending = true
+	}
+
+	return field, descending, nil
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// Nothing may follow the cursor, it would have been tampered with
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (cursor Cursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Normalize fills in the defaults and checks the options fit together
+func (query *Query) Normalize() error {
+	if len(query.Terms) > 0 {
+		query.Sort = SortRelevance
+		query.Descending = true
+	}
+	if query.Sort == "" {
+		query.Sort = SortNewest
+		query.Descending = true
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit > MaxLimit {
+		query.Limit = MaxLimit
+	}
+	if query.Currency == "" {
+		query.Currency = models.DefaultCurrency
+	}
+	query.Currency = strings.ToUpper(query.Currency)
+
+	if query.Min_price != nil && query.Max_price != nil && *query.Min_price > *query.Max_price {
+		return ErrInvalidQuery
+	}
+	if query.After != nil && (query.After.Sort != query.Sort || query.After.Descending != query.Descending) {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// Key is the value the product is sorted by. A nil key sorts before every
+// other value, which is also where MongoDB puts missing fields.
+func Key(product models.Product, sort SortField) (number *int64, text *string) {
+	switch sort {
+	case SortPrice:
+		amount := product.Price.Amount
+		return &amount, nil
+	case SortRating:
+		if product.Rating != nil {
+			rating := int64(*product.Rating)
+			return &rating, nil
+		}
+	case SortName:
+		return nil, product.Product_name
+	}
+
+	return nil, nil
+}
+
+// CursorFor is the cursor of the page that ends with the product
+func CursorFor(product models.Product, query Query) Cursor {
+	number, text := Key(product, query.Sort)
+	return Cursor{Sort: query.Sort, Descending: query.Descending, Number: number, Text: text, ID: product.Product_id}
+}
+
+// Matches applies the price and rating filters
+func Matches(product models.Product, query Query) bool {
+	if query.Min_price != nil || query.Max_price != nil {
+		if product.Price.Currency != query.Currency {
+			return false
+		}
+		if query.Min_price != nil && product.Price.Amount < *query.Min_price {
+			return false
+		}
+		if query.Max_price != nil && product.Price.Amount > *query.Max_price {
+			return false
+		}
+	}
+	if query.Min_rating != nil && (product.Rating == nil || *product.Rating < *query.Min_rating) {
+		return false
+	}
+	if len(query.Categories) > 0 && !inAny(product.Categories, query.Categories) {
+		return false
+	}
+
+	return true
+}
+
+func compareKeys(aNumber *int64, aText *string, bNumber *int64, bText *string) int {
+	switch {
+	case aNumber != nil || bNumber != nil:
+		if aNumber == nil || bNumber == nil {
+			return missingFirst(aNumber == nil)
+		}
+		return compareOrdered(*aNumber, *bNumber)
+	case aText != nil || bText != nil:
+		if aText == nil || bText == nil {
+			return missingFirst(aText == nil)
+		}
+		return strings.Compare(*aText, *bText)
+	}
+
+	return 0
+}
+
+// missingFirst compares a value with a missing one
+func missingFirst(aMissing bool) int {
+	if aMissing {
+		return -1
+	}
+	return 1
+}
+
+func compareOrdered(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare orders two positions in the listing, -1 when a comes first
+func compare(aNumber *int64, aText *string, aID primitive.ObjectID, bNumber *int64, bText *string, bID primitive.ObjectID, descending bool) int {
+	cmp := compareKeys(aNumber, aText, bNumber, bText)
+	if cmp == 0 {
+		cmp = bytes.Compare(aID[:], bID[:])
+	}
+	if descending {
+		cmp = -cmp
+	}
+
+	return cmp
+}
+
+// Less reports whether a comes before b in the listing
+func Less(a, b models.Product, query Query) bool {
+	aNumber, aText := Key(a, query.Sort)
+	bNumber, bText := Key(b, query.Sort)
+	return compare(aNumber, aText, a.Product_id, bNumber, bText, b.Product_id, query.Descending) < 0
+}
+
+// After reports whether the product comes after the query's cursor
+func After(product models.Product, query Query) bool {
+	if query.After == nil {
+		return true
+	}
+
+	number, text := Key(product, query.Sort)
+	return compare(number, text, product.Product_id, query.After.Number, query.After.Text, query.After.ID, query.Descending) > 0
+}
+
+func inAny(ids, wanted []primitive.ObjectID) bool {
+	for _, id := range ids {
+		for _, want := range wanted {
+			if id == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	price, name, score := int64(1250), "Mug", 2.5
+
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{"newest", Cursor{Sort: SortNewest, Descending: true, ID: primitive.NewObjectID()}},
+		{"price", Cursor{Sort: SortPrice, Number: &price, ID: primitive.NewObjectID()}},
+		{"name", Cursor{Sort: SortName, Descending: true, Text: &name, ID: primitive.NewObjectID()}},
+		{"relevance", Cursor{Sort: SortRelevance, Descending: true, Score: &score, ID: primitive.NewObjectID()}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := DecodeCursor(test.cursor.Encode())
+			if err != nil {
+				t.Fatalf("DecodeCursor() error = %v", err)
+			}
+			if decoded.Sort != test.cursor.Sort || decoded.Descending != test.cursor.Descending || decoded.ID != test.cursor.ID {
+				t.Errorf("DecodeCursor() = %+v, want %+v", decoded, test.cursor)
+			}
+			if (decoded.Number == nil) != (test.cursor.Number == nil) || decoded.Number != nil && *decoded.Number != *test.cursor.Number {
+				t.Errorf("DecodeCursor() number = %v, want %v", decoded.Number, test.cursor.Number)
+			}
+			if (decoded.Text == nil) != (test.cursor.Text == nil) || decoded.Text != nil && *decoded.Text != *test.cursor.Text {
+				t.Errorf("DecodeCursor() text = %v, want %v", decoded.Text, test.cursor.Text)
+			}
+			if (decoded.Score == nil) != (test.cursor.Score == nil) || decoded.Score != nil && *decoded.Score != *test.cursor.Score {
+				t.Errorf("DecodeCursor() score = %v, want %v", decoded.Score, test.cursor.Score)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := Cursor{Sort: SortPrice, ID: primitive.NewObjectID()}.Encode()
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"garbage", "not a cursor"},
+		{"padded", base64.URLEncoding.EncodeToString([]byte(`{"s":"price","d":false,"id":"000000000000000000000000"}`))},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("price:1250"))},
+		{"unknown field", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"price","d":false,"id":"000000000000000000000000","$where":"1"}`))},
+		{"bad id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"price","d":false,"id":"42"}`))},
+		{"wrong type", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"price","d":false,"n":"1250","id":"000000000000000000000000"}`))},
+		{"truncated", valid[:len(valid)-4]},
+		{"trailing data", valid + "AAAA"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cursor, err := DecodeCursor(test.encoded); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor() = %+v, %v, want %v", cursor, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		sort, order string
+		want        SortField
+		descending  bool
+		err         error
+	}{
+		{"", "", SortNewest, true, nil},
+		{"newest", "asc", SortNewest, true, nil},
+		{"price", "", SortPrice, false, nil},
+		{"PRICE", "DESC", SortPrice, true, nil},
+		{"rating", "", SortRating, true, nil},
+		{"rating", "asc", SortRating, false, nil},
+		{"name", "", SortName, false, nil},
+		{"relevance", "", "", false, ErrInvalidQuery},
+		{"price", "up", "", false, ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sort+" "+test.order, func(t *testing.T) {
+			field, descending, err := ParseSort(test.sort, test.order)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseSort() error = %v, want %v", err, test.err)
+			}
+			if field != test.want || descending != test.descending {
+				t.Errorf("ParseSort() = %s, %v, want %s, %v", field, descending, test.want, test.descending)
+			}
+		})
+	}
+}
+
+func TestNormalizeRejectsCursorOfAnotherListing(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		err   error
+	}{
+		{"same listing", Query{Sort: SortPrice, After: &Cursor{Sort: SortPrice}}, nil},
+		{"other sort", Query{Sort: SortPrice, After: &Cursor{Sort: SortName}}, ErrInvalidCursor},
+		{"other order", Query{Sort: SortPrice, After: &Cursor{Sort: SortPrice, Descending: true}}, ErrInvalidCursor},
+		{"listing cursor in a search", Query{Terms: []string{"mug"}, After: &Cursor{Sort: SortNewest, Descending: true}}, ErrInvalidCursor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.query.Normalize(); !errors.Is(err, test.err) {
+				t.Errorf("Normalize() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package catalog
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidSlug   = errors.New("Slug may only hold lower case letters, digits and dashes")
+	ErrInvalidParent = errors.New("A category can't be its own parent or sit under one of its children")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Slugify turns a category name into the slug used in URLs, e.g. "Pens & Pencils" into "pens-pencils"
+func Slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r > unicode.MaxASCII || (!unicode.IsLetter(r) && !unicode.IsDigit(r))
+	})
+
+	return strings.Join(words, "-")
+}
+
+func ValidSlug(slug string) error {
+	if !slugPattern.MatchString(slug) {
+		return ErrInvalidSlug
+	}
+
+	return nil
+}
+
+// CategoryNode is a category with the categories under it
+type CategoryNode struct {
+	models.Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// Tree arranges the categories under their parents. Categories whose parent is
+// gone, or whose parents lead back to themselves, end up at the top.
+func Tree(categories []models.Category) []*CategoryNode {
+	nodes := make(map[primitive.ObjectID]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.Category_id] = &CategoryNode{Category: category, Children: make([]*CategoryNode, 0)}
+	}
+
+	parentOf := parents(categories)
+	roots := make([]*CategoryNode, 0)
+	for _, category := range categories {
+		node := nodes[category.Category_id]
+		if category.Parent_id != nil && !inLoop(parentOf, category.Category_id) {
+			if parent, ok := nodes[*category.Parent_id]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots
+}
+
+func parents(categories []models.Category) map[primitive.ObjectID]*primitive.ObjectID {
+	parentOf := make(map[primitive.ObjectID]*primitive.ObjectID, len(categories))
+	for _, category := range categories {
+		parentOf[category.Category_id] = category.Parent_id
+	}
+
+	return parentOf
+}
+
+// inLoop reports whether going up the parents from the category comes back to it
+func inLoop(parentOf map[primitive.ObjectID]*primitive.ObjectID, categoryID primitive.ObjectID) bool {
+	seen := make(map[primitive.ObjectID]bool)
+	for parent := parentOf[categoryID]; parent != nil && !seen[*parent]; parent = parentOf[*parent] {
+		if *parent == categoryID {
+			return true
+		}
+		seen[*parent] = true
+	}
+
+	return false
+}
+
+// Descendants returns the category and every category below it, each once
+// even when the parents loop
+func Descendants(categories []models.Category, categoryID primitive.ObjectID) []primitive.ObjectID {
+	children := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, category := range categories {
+		if category.Parent_id != nil {
+			children[*category.Parent_id] = append(children[*category.Parent_id], category.Category_id)
+		}
+	}
+
+	found := []primitive.ObjectID{categoryID}
+	seen := map[primitive.ObjectID]bool{categoryID: true}
+	for i := 0; i < len(found); i++ {
+		for _, child := range children[found[i]] {
+			if !seen[child] {
+				seen[child] = true
+				found = append(found, child)
+			}
+		}
+	}
+
+	return found
+}
+
+// Ancestors returns the categories above the category, its parent first
+func Ancestors(categories []models.Category, categoryID primitive.ObjectID) []primitive.ObjectID {
+	parentOf := parents(categories)
+	ancestors := make([]primitive.ObjectID, 0)
+	seen := map[primitive.ObjectID]bool{categoryID: true}
+	for parent := parentOf[categoryID]; parent != nil && !seen[*parent]; parent = parentOf[*parent] {
+		seen[*parent] = true
+		ancestors = append(ancestors, *parent)
+	}
+
+	return ancestors
+}
+
+// ValidParent checks that putting the category under parent keeps the tree a tree
+func ValidParent(categories []models.Category, categoryID primitive.ObjectID, parent *primitive.ObjectID) error {
+	if parent == nil {
+		return nil
+	}
+
+	for _, below := range Descendants(categories, categoryID) {
+		if below == *parent {
+			return ErrInvalidParent
+		}
+	}
+
+	return nil
+}
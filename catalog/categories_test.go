@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func category(name string, parent *models.Category) models.Category {
+	category := models.Category{Category_id: primitive.NewObjectID(), Name: name, Slug: Slugify(name)}
+	if parent != nil {
+		category.Parent_id = &parent.Category_id
+	}
+
+	return category
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Pens & Pencils", "pens-pencils"},
+		{"  Office   Supplies ", "office-supplies"},
+		{"A4 Paper", "a4-paper"},
+		{"Café", "caf"},
+		{"&&", ""},
+	}
+
+	for _, test := range tests {
+		slug := Slugify(test.name)
+		if slug != test.want {
+			t.Errorf("Slugify(%q) = %q, want %q", test.name, slug, test.want)
+		}
+		if err := ValidSlug(slug); (err == nil) != (test.want != "") {
+			t.Errorf("ValidSlug(%q) error = %v", slug, err)
+		}
+	}
+
+	for _, slug := range []string{"Pens", "pens--pencils", "-pens", "pens-", "pens pencils"} {
+		if err := ValidSlug(slug); !errors.Is(err, ErrInvalidSlug) {
+			t.Errorf("ValidSlug(%q) error = %v, want %v", slug, err, ErrInvalidSlug)
+		}
+	}
+}
+
+// office holds writing, which holds pens and pencils, and paper
+func office() (office, writing, pens, pencils, paper models.Category) {
+	office = category("Office", nil)
+	writing = category("Writing", &office)
+	pens = category("Pens", &writing)
+	pencils = category("Pencils", &writing)
+	paper = category("Paper", &office)
+	return
+}
+
+func TestTree(t *testing.T) {
+	office, writing, pens, pencils, paper := office()
+	orphan := category("Orphan", &models.Category{Category_id: primitive.NewObjectID()})
+
+	roots := Tree([]models.Category{pens, office, paper, orphan, writing, pencils})
+	if len(roots) != 2 || roots[0].Name != "Office" || roots[1].Name != "Orphan" {
+		t.Fatalf("Tree() roots = %v, want Office and Orphan", roots)
+	}
+	children := roots[0].Children
+	if len(children) != 2 || children[0].Name != "Paper" || children[1].Name != "Writing" || len(children[1].Children) != 2 {
+		t.Errorf("Office holds %v, want Paper and Writing with two children", children)
+	}
+}
+
+func TestDescendantsAndAncestors(t *testing.T) {
+	office, writing, pens, pencils, paper := office()
+	categories := []models.Category{office, writing, pens, pencils, paper}
+
+	if got := Descendants(categories, writing.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{writing.Category_id, pens.Category_id, pencils.Category_id}) {
+		t.Errorf("Descendants(writing) = %v, want writing, pens and pencils", got)
+	}
+	if got := Descendants(categories, pens.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{pens.Category_id}) {
+		t.Errorf("Descendants(pens) = %v, want only pens", got)
+	}
+	if got := Ancestors(categories, pens.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{writing.Category_id, office.Category_id}) {
+		t.Errorf("Ancestors(pens) = %v, want writing and office", got)
+	}
+	if got := Ancestors(categories, office.Category_id); len(got) != 0 {
+		t.Errorf("Ancestors(office) = %v, want none", got)
+	}
+}
+
+func TestValidParent(t *testing.T) {
+	office, writing, pens, pencils, paper := office()
+	categories := []models.Category{office, writing, pens, pencils, paper}
+
+	tests := []struct {
+		name     string
+		category models.Category
+		parent   *primitive.ObjectID
+		err      error
+	}{
+		{"top", writing, nil, nil},
+		{"sibling", pens, &pencils.Category_id, nil},
+		{"other branch", writing, &paper.Category_id, nil},
+		{"itself", writing, &writing.Category_id, ErrInvalidParent},
+		{"child", writing, &pens.Category_id, ErrInvalidParent},
+		{"grandchild", office, &pencils.Category_id, ErrInvalidParent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidParent(categories, test.category.Category_id, test.parent); !errors.Is(err, test.err) {
+				t.Errorf("ValidParent() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// TestCategoryCycles makes sure a loop in the parents, which ValidParent keeps
+// out but two moves racing each other can still leave behind, doesn't hang or
+// hide categories
+func TestCategoryCycles(t *testing.T) {
+	a, b, c := category("A", nil), category("B", nil), category("C", nil)
+	a.Parent_id, b.Parent_id = &b.Category_id, &a.Category_id
+	c.Parent_id = &a.Category_id
+	self := category("Self", nil)
+	self.Parent_id = &self.Category_id
+	categories := []models.Category{a, b, c, self}
+
+	if got := Descendants(categories, a.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{a.Category_id, b.Category_id, c.Category_id}) {
+		t.Errorf("Descendants(a) = %v, want a, b and c once each", got)
+	}
+	if got := Descendants(categories, self.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{self.Category_id}) {
+		t.Errorf("Descendants(self) = %v, want only self", got)
+	}
+	if got := Ancestors(categories, c.Category_id); !reflect.DeepEqual(got, []primitive.ObjectID{a.Category_id, b.Category_id}) {
+		t.Errorf("Ancestors(c) = %v, want a and b", got)
+	}
+	if err := ValidParent(categories, c.Category_id, &b.Category_id); err != nil {
+		t.Errorf("ValidParent() error = %v, want none", err)
+	}
+
+	count := 0
+	var walk func(nodes []*CategoryNode)
+	walk = func(nodes []*CategoryNode) {
+		for _, node := range nodes {
+			count++
+			walk(node.Children)
+		}
+	}
+	walk(Tree(categories))
+	if count != len(categories) {
+		t.Errorf("Tree() holds %d categories, want all %d", count, len(categories))
+	}
+}
@@ -0,0 +1,154 @@
+package catalog
+
+import (
+	"math"
+	"sort"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// priceBoundaries are where the price buckets start, in major units
+var priceBoundaries = []int64{0, 10, 25, 50, 100}
+
+// Facets count the products that matched by category, price bucket and rating,
+// over all pages of the results
+type Facets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Price      []PriceFacet    `json:"price"`
+	Rating     []RatingFacet   `json:"rating"`
+}
+
+// CategoryFacet counts a product once for its category and once for every
+// category above it, so a parent counts everything it holds
+type CategoryFacet struct {
+	Category_id primitive.ObjectID `json:"_id"`
+	Name        string             `json:"name"`
+	Slug        string             `json:"slug"`
+	Count       int64              `json:"count"`
+}
+
+// PriceFacet counts the prices from Min up to but not including Max, in minor
+// units of Currency. The last bucket has no Max.
+type PriceFacet struct {
+	Min      int64  `json:"min"`
+	Max      *int64 `json:"max"`
+	Currency string `json:"currency"`
+	Count    int64  `json:"count"`
+}
+
+// RatingFacet counts the products rated Min_rating or better
+type RatingFacet struct {
+	Min_rating int   `json:"min_rating"`
+	Count      int64 `json:"count"`
+}
+
+// CategoryCombination is how many products have exactly these categories
+type CategoryCombination struct {
+	Categories []primitive.ObjectID `bson:"_id"`
+	Count      int64                `bson:"count"`
+}
+
+// PriceBoundaries are the lower ends of the price buckets in minor units of the currency
+func PriceBoundaries(currency string) []int64 {
+	scale := int64(math.Pow10(models.MinorUnitDigits(currency)))
+	boundaries := make([]int64, len(priceBoundaries))
+	for i, boundary := range priceBoundaries {
+		boundaries[i] = boundary * scale
+	}
+
+	return boundaries
+}
+
+// NewFacets puts the facets together from raw counts. priceCounts is keyed by
+// the lower end of the bucket and ratingCounts by the exact rating.
+func NewFacets(combinations []CategoryCombination, priceCounts map[int64]int64, ratingCounts map[int]int64, categories []models.Category, currency string) Facets {
+	facets := Facets{
+		Categories: make([]CategoryFacet, 0),
+		Price:      make([]PriceFacet, 0, len(priceBoundaries)),
+		Rating:     make([]RatingFacet, 0, 4),
+	}
+
+	byID := make(map[primitive.ObjectID]models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.Category_id] = category
+	}
+
+	counts := make(map[primitive.ObjectID]int64)
+	for _, combination := range combinations {
+		// A product in two children of the same parent still counts once for the parent
+		counted := make(map[primitive.ObjectID]bool)
+		for _, categoryID := range combination.Categories {
+			if _, ok := byID[categoryID]; !ok {
+				continue
+			}
+			for _, id := range append([]primitive.ObjectID{categoryID}, Ancestors(categories, categoryID)...) {
+				if !counted[id] {
+					counted[id] = true
+					counts[id] += combination.Count
+				}
+			}
+		}
+	}
+	for categoryID, count := range counts {
+		category := byID[categoryID]
+		facets.Categories = append(facets.Categories, CategoryFacet{Category_id: categoryID, Name: category.Name, Slug: category.Slug, Count: count})
+	}
+	sort.Slice(facets.Categories, func(i, j int) bool {
+		if facets.Categories[i].Count != facets.Categories[j].Count {
+			return facets.Categories[i].Count > facets.Categories[j].Count
+		}
+		return facets.Categories[i].Name < facets.Categories[j].Name
+	})
+
+	boundaries := PriceBoundaries(currency)
+	for i, boundary := range boundaries {
+		facet := PriceFacet{Min: boundary, Currency: currency, Count: priceCounts[boundary]}
+		if i+1 < len(boundaries) {
+			max := boundaries[i+1]
+			facet.Max = &max
+		}
+		facets.Price = append(facets.Price, facet)
+	}
+
+	for minRating := 4; minRating >= 1; minRating-- {
+		facet := RatingFacet{Min_rating: minRating}
+		for rating, count := range ratingCounts {
+			if rating >= minRating {
+				facet.Count += count
+			}
+		}
+		facets.Rating = append(facets.Rating, facet)
+	}
+
+	return facets
+}
+
+// CountFacets works out the facets of products that are already in memory
+func CountFacets(products []models.Product, categories []models.Category, currency string) Facets {
+	combinations := make([]CategoryCombination, 0, len(products))
+	priceCounts := make(map[int64]int64)
+	ratingCounts := make(map[int]int64)
+	boundaries := PriceBoundaries(currency)
+
+	for _, product := range products {
+		combinations = append(combinations, CategoryCombination{Categories: product.Categories, Count: 1})
+
+		if product.Price.Currency == currency && product.Price.Amount >= 0 {
+			bucket := boundaries[0]
+			for _, boundary := range boundaries {
+				if product.Price.Amount >= boundary {
+					bucket = boundary
+				}
+			}
+			priceCounts[bucket]++
+		}
+
+		if product.Rating != nil {
+			ratingCounts[int(*product.Rating)]++
+		}
+	}
+
+	return NewFacets(combinations, priceCounts, ratingCounts, categories, currency)
+}
@@ -0,0 +1,68 @@
+package catalog
+
+import (
+	"testing"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCountFacets(t *testing.T) {
+	office, writing, pens, pencils, paper := office()
+	categories := []models.Category{office, writing, pens, pencils, paper}
+	rated := func(rating uint8) *uint8 { return &rating }
+
+	products := []models.Product{
+		{Categories: []primitive.ObjectID{pens.Category_id, pencils.Category_id}, Price: models.NewMoney(499, "USD"), Rating: rated(5)},
+		{Categories: []primitive.ObjectID{pens.Category_id}, Price: models.NewMoney(1000, "USD"), Rating: rated(3)},
+		{Categories: []primitive.ObjectID{paper.Category_id}, Price: models.NewMoney(12000, "USD")},
+		{Categories: []primitive.ObjectID{primitive.NewObjectID()}, Price: models.NewMoney(2500, "EUR"), Rating: rated(4)},
+	}
+	facets := CountFacets(products, categories, "USD")
+
+	wantCategories := map[string]int64{"Office": 3, "Writing": 2, "Pens": 2, "Pencils": 1, "Paper": 1}
+	if len(facets.Categories) != len(wantCategories) {
+		t.Errorf("category facets = %+v, want %d categories", facets.Categories, len(wantCategories))
+	}
+	for _, facet := range facets.Categories {
+		if facet.Count != wantCategories[facet.Name] {
+			t.Errorf("%s counts %d products, want %d", facet.Name, facet.Count, wantCategories[facet.Name])
+		}
+	}
+	if facets.Categories[0].Name != "Office" {
+		t.Errorf("first category facet is %s, want the biggest, Office", facets.Categories[0].Name)
+	}
+
+	wantPrices := []struct {
+		min, count int64
+	}{{0, 1}, {1000, 1}, {2500, 0}, {5000, 0}, {10000, 1}}
+	if len(facets.Price) != len(wantPrices) {
+		t.Fatalf("price facets = %+v, want %d buckets", facets.Price, len(wantPrices))
+	}
+	for i, want := range wantPrices {
+		facet := facets.Price[i]
+		if facet.Min != want.min || facet.Count != want.count || facet.Currency != "USD" {
+			t.Errorf("price bucket %d = %+v, want %d USD and up counting %d", i, facet, want.min, want.count)
+		}
+		if last := i == len(wantPrices)-1; last != (facet.Max == nil) || !last && *facet.Max != wantPrices[i+1].min {
+			t.Errorf("price bucket %d ends at %v", i, facet.Max)
+		}
+	}
+
+	wantRatings := map[int]int64{4: 2, 3: 3, 2: 3, 1: 3}
+	for _, facet := range facets.Rating {
+		if facet.Count != wantRatings[facet.Min_rating] {
+			t.Errorf("%d stars and up counts %d products, want %d", facet.Min_rating, facet.Count, wantRatings[facet.Min_rating])
+		}
+	}
+}
+
+func TestPriceBoundaries(t *testing.T) {
+	if got := PriceBoundaries("JPY"); got[1] != 10 || got[4] != 100 {
+		t.Errorf("PriceBoundaries(JPY) = %v, want whole yen", got)
+	}
+	if got := PriceBoundaries("USD"); got[1] != 1000 || got[4] != 10000 {
+		t.Errorf("PriceBoundaries(USD) = %v, want cents", got)
+	}
+}
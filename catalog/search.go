@@ -0,0 +1,197 @@
+package catalog
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"go-com/models"
+)
+
+var ErrInvalidSearch = errors.New("Search must have between 1 and 10 words of letters or digits")
+
+const (
+	maxSearchLength = 200
+	maxSearchTerms  = 10
+
+	// A match in the name counts for more than one in the description
+	nameWeight        = 10
+	descriptionWeight = 2
+)
+
+// SortRelevance orders search results by how well they match, best first
+const SortRelevance SortField = "relevance"
+
+// SearchResult is a product with how well it matched and where. Highlights hold
+// the matching fields as HTML with the matched words wrapped in <em>.
+type SearchResult struct {
+	Product    models.Product    `json:"product"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type SearchPage struct {
+	Results     []SearchResult `json:"results"`
+	Next_cursor string         `json:"next_cursor"`
+	Total       int64          `json:"total"`
+	Facets      Facets         `json:"facets"`
+}
+
+// ParseSearch splits what the customer typed into lower case words. Anything that
+// isn't a letter or a digit only separates words, so no input can carry operators
+// into the query.
+func ParseSearch(search string) ([]string, error) {
+	if len(search) > maxSearchLength {
+		return nil, ErrInvalidSearch
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	seen := make(map[string]bool)
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+
+	if len(terms) == 0 || len(terms) > maxSearchTerms {
+		return nil, ErrInvalidSearch
+	}
+
+	return terms, nil
+}
+
+// termMatches compares a search term with a word of the text. Either may be the
+// start of the other, which lets "pens" find "pen" much like a stemmer would.
+func termMatches(term, word string) bool {
+	if term == word {
+		return true
+	}
+
+	shorter, longer := term, word
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+
+	return len(shorter) >= 3 && strings.HasPrefix(longer, shorter)
+}
+
+func matchesAny(terms []string, word string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if termMatches(term, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wordSpans returns the start and end of every word in the text
+func wordSpans(text string) [][2]int {
+	spans := make([][2]int, 0)
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+func countMatches(text *string, terms []string) int {
+	if text == nil {
+		return 0
+	}
+
+	count := 0
+	for _, span := range wordSpans(*text) {
+		if matchesAny(terms, (*text)[span[0]:span[1]]) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Score is how well the product matches the terms, zero when it doesn't at all
+func Score(product models.Product, terms []string) float64 {
+	return float64(nameWeight*countMatches(product.Product_name, terms) + descriptionWeight*countMatches(product.Description, terms))
+}
+
+// Highlight escapes the text for HTML and wraps the words matching the terms in
+// <em>. It reports whether anything matched.
+func Highlight(text string, terms []string) (string, bool) {
+	var highlighted strings.Builder
+	matched := false
+	last := 0
+	for _, span := range wordSpans(text) {
+		if !matchesAny(terms, text[span[0]:span[1]]) {
+			continue
+		}
+
+		matched = true
+		highlighted.WriteString(html.EscapeString(text[last:span[0]]))
+		highlighted.WriteString("<em>")
+		highlighted.WriteString(html.EscapeString(text[span[0]:span[1]]))
+		highlighted.WriteString("</em>")
+		last = span[1]
+	}
+	highlighted.WriteString(html.EscapeString(text[last:]))
+
+	return highlighted.String(), matched
+}
+
+// NewSearchResult puts together the result for a product the store found
+func NewSearchResult(product models.Product, score float64, terms []string) SearchResult {
+	result := SearchResult{Product: product, Score: score, Highlights: make(map[string]string)}
+	fields := map[string]*string{"product_name": product.Product_name, "description": product.Description}
+	for field, text := range fields {
+		if text == nil {
+			continue
+		}
+		if highlighted, ok := Highlight(*text, terms); ok {
+			result.Highlights[field] = highlighted
+		}
+	}
+
+	return result
+}
+
+// AfterResult reports whether a result with this score and product comes after
+// the query's cursor, results going from the best score down
+func AfterResult(product models.Product, score float64, query Query) bool {
+	if query.After == nil {
+		return true
+	}
+
+	last := query.After
+	if last.Score == nil {
+		return false
+	}
+	if score != *last.Score {
+		return score < *last.Score
+	}
+
+	return compare(nil, nil, product.Product_id, nil, nil, last.ID, true) > 0
+}
+
+// ResultCursor is the cursor of the page that ends with the result
+func ResultCursor(result SearchResult) Cursor {
+	score := result.Score
+	return Cursor{Sort: SortRelevance, Descending: true, Score: &score, ID: result.Product.Product_id}
+}
@@ -0,0 +1,76 @@
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-com/models"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []string
+		err    error
+	}{
+		{"Blue Mug", []string{"blue", "mug"}, nil},
+		{"  mug   MUG mug ", []string{"mug"}, nil},
+		{"café crème", []string{"café", "crème"}, nil},
+		{`"mug" -teapot`, []string{"mug", "teapot"}, nil},
+		{`{"$where": "sleep(1000)"}`, []string{"where", "sleep", "1000"}, nil},
+		{".*(mug|cup)$", []string{"mug", "cup"}, nil},
+		{"", nil, ErrInvalidSearch},
+		{"*&^%$ -- ()", nil, ErrInvalidSearch},
+		{"a b c d e f g h i j", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, nil},
+		{"a b c d e f g h i j k", nil, ErrInvalidSearch},
+		{strings.Repeat("mug ", 51), nil, ErrInvalidSearch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.search, func(t *testing.T) {
+			terms, err := ParseSearch(test.search)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseSearch() error = %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(terms, test.want) {
+				t.Errorf("ParseSearch() = %q, want %q", terms, test.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	name, description := "Blue Mugs", "A mug for tea. Mug sized."
+	product := models.Product{Product_name: &name, Description: &description}
+
+	tests := []struct {
+		terms []string
+		want  float64
+	}{
+		{[]string{"mug"}, nameWeight + 2*descriptionWeight},
+		{[]string{"blue"}, nameWeight},
+		{[]string{"tea"}, descriptionWeight},
+		{[]string{"mu"}, 0},
+		{[]string{"teapot"}, descriptionWeight},
+		{[]string{"coffee"}, 0},
+	}
+
+	for _, test := range tests {
+		if score := Score(product, test.terms); score != test.want {
+			t.Errorf("Score(%q) = %v, want %v", test.terms, score, test.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	highlighted, ok := Highlight("<b>Blue</b> mugs & cups", []string{"mug", "blue"})
+	if want := "&lt;b&gt;<em>Blue</em>&lt;/b&gt; <em>mugs</em> &amp; cups"; !ok || highlighted != want {
+		t.Errorf("Highlight() = %q, %v, want %q", highlighted, ok, want)
+	}
+
+	if highlighted, ok = Highlight("<teapot>", []string{"mug"}); ok || highlighted != "&lt;teapot&gt;" {
+		t.Errorf("Highlight() without a match = %q, %v, want the escaped text", highlighted, ok)
+	}
+}
@@ -0,0 +1,157 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-com/models"
+)
+
+var (
+	ErrVariantRequired = errors.New("Product comes in variants, pick one by its sku")
+	ErrVariantNotFound = errors.New("Product has no variant with this sku")
+	ErrInvalidVariants = errors.New("Product variants are not valid")
+)
+
+// CheckVariants makes sure the variants of a product fit its attributes: every
+// variant has a unique SKU and picks one allowed value of each attribute, no two
+// variants pick the same values, and all of them are priced in one currency.
+func CheckVariants(product models.Product) error {
+	if len(product.Variants) == 0 {
+		return nil
+	}
+	if len(product.Attributes) == 0 {
+		return fmt.Errorf("%w: a product with variants needs attributes", ErrInvalidVariants)
+	}
+
+	allowed := make(map[string]map[string]bool, len(product.Attributes))
+	for _, attribute := range product.Attributes {
+		if _, seen := allowed[attribute.Name]; seen {
+			return fmt.Errorf("%w: attribute %q is defined twice", ErrInvalidVariants, attribute.Name)
+		}
+		allowed[attribute.Name] = make(map[string]bool, len(attribute.Values))
+		for _, value := range attribute.Values {
+			allowed[attribute.Name][value] = true
+		}
+	}
+
+	skus := make(map[string]bool, len(product.Variants))
+	combinations := make(map[string]string, len(product.Variants))
+	currency := product.Variants[0].Price.Currency
+	for _, variant := range product.Variants {
+		if skus[variant.Sku] {
+			return fmt.Errorf("%w: sku %q is used twice", ErrInvalidVariants, variant.Sku)
+		}
+		skus[variant.Sku] = true
+
+		if err := variant.Price.Validate(); err != nil {
+			return fmt.Errorf("%w: sku %q: %v", ErrInvalidVariants, variant.Sku, err)
+		}
+		if variant.Price.Currency != currency {
+			return fmt.Errorf("%w: all variants must be priced in the same currency", ErrInvalidVariants)
+		}
+		if variant.Stock < 0 {
+			return fmt.Errorf("%w: sku %q has negative stock", ErrInvalidVariants, variant.Sku)
+		}
+
+		if len(variant.Attributes) != len(allowed) {
+			return fmt.Errorf("%w: sku %q must pick a value for every attribute", ErrInvalidVariants, variant.Sku)
+		}
+		for name, value := range variant.Attributes {
+			values, ok := allowed[name]
+			if !ok {
+				return fmt.Errorf("%w: sku %q has unknown attribute %q", ErrInvalidVariants, variant.Sku, name)
+			}
+			if !values[value] {
+				return fmt.Errorf("%w: sku %q has %q for %s, which is not one of its values", ErrInvalidVariants, variant.Sku, value, name)
+			}
+		}
+
+		combination := combinationKey(variant.Attributes)
+		if other, taken := combinations[combination]; taken {
+			return fmt.Errorf("%w: skus %q and %q are the same variant", ErrInvalidVariants, other, variant.Sku)
+		}
+		combinations[combination] = variant.Sku
+	}
+
+	return nil
+}
+
+// combinationKey writes the attribute values down in a fixed order
+func combinationKey(attributes map[string]string) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name + "=" + attributes[name] + "\x00")
+	}
+
+	return key.String()
+}
+
+// FindVariant picks the variant with the given SKU. Products without variants
+// are bought without a SKU and products with variants can't be.
+func FindVariant(product models.Product, sku string) (*models.Variant, error) {
+	if sku == "" {
+		if len(product.Variants) > 0 {
+			return nil, ErrVariantRequired
+		}
+		return nil, nil
+	}
+
+	for i := range product.Variants {
+		if product.Variants[i].Sku == sku {
+			return &product.Variants[i], nil
+		}
+	}
+
+	return nil, ErrVariantNotFound
+}
+
+// RollUp fills in the price and stock of a product with variants from the
+// variants themselves: the price is the cheapest variant's, which is what
+// listings sort and filter on, and the stock is everything in stock.
+func RollUp(product *models.Product) {
+	if len(product.Variants) == 0 {
+		return
+	}
+
+	product.Price = product.Variants[0].Price
+	product.Stock = 0
+	for _, variant := range product.Variants {
+		if variant.Price.Amount < product.Price.Amount {
+			product.Price = variant.Price
+		}
+		product.Stock += variant.Stock
+	}
+}
+
+// KeepStock puts back the stock the product had before it was edited. Variants
+// keep the stock of the variant with the same SKU and new ones start without
+// any, the same as a product that no longer has variants.
+func KeepStock(product *models.Product, before models.Product) {
+	stock := make(map[string]int, len(before.Variants))
+	for _, variant := range before.Variants {
+		stock[variant.Sku] = variant.Stock
+	}
+
+	if len(product.Variants) == 0 {
+		product.Stock = before.Stock
+		if len(before.Variants) > 0 {
+			product.Stock = 0
+		}
+		return
+	}
+
+	product.Stock = 0
+	for i := range product.Variants {
+		product.Variants[i].Stock = stock[product.Variants[i].Sku]
+		product.Stock += product.Variants[i].Stock
+	}
+}
@@ -0,0 +1,169 @@
+package catalog
+
+import (
+	"errors"
+	"testing"
+
+	"go-com/models"
+)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+// shirt comes in two sizes and two colours, three of the four made
+func shirt() models.Product {
+	return models.Product{
+		Attributes: []models.ProductAttribute{
+			{Name: "size", Values: []string{"S", "M"}},
+			{Name: "colour", Values: []string{"red", "blue"}},
+		},
+		Variants: []models.Variant{
+			{Sku: "S-RED", Attributes: map[string]string{"size": "S", "colour": "red"}, Price: usd(1500), Stock: 3},
+			{Sku: "M-RED", Attributes: map[string]string{"size": "M", "colour": "red"}, Price: usd(1700), Stock: 0},
+			{Sku: "M-BLUE", Attributes: map[string]string{"size": "M", "colour": "blue"}, Price: usd(1400), Stock: 5},
+		},
+	}
+}
+
+func TestCheckVariants(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(product *models.Product)
+		valid  bool
+	}{
+		{"valid", func(product *models.Product) {}, true},
+		{"no variants", func(product *models.Product) { product.Variants, product.Attributes = nil, nil }, true},
+		{"no attributes", func(product *models.Product) { product.Attributes = nil }, false},
+		{"attribute twice", func(product *models.Product) {
+			product.Attributes = append(product.Attributes, models.ProductAttribute{Name: "size", Values: []string{"L"}})
+		}, false},
+		{"sku twice", func(product *models.Product) { product.Variants[1].Sku = "S-RED" }, false},
+		{"same values twice", func(product *models.Product) {
+			product.Variants[1].Attributes = map[string]string{"size": "S", "colour": "red"}
+		}, false},
+		{"value not allowed", func(product *models.Product) { product.Variants[0].Attributes["size"] = "XL" }, false},
+		{"unknown attribute", func(product *models.Product) {
+			product.Variants[0].Attributes = map[string]string{"size": "S", "fabric": "silk"}
+		}, false},
+		{"attribute missing", func(product *models.Product) { delete(product.Variants[0].Attributes, "colour") }, false},
+		{"other currency", func(product *models.Product) { product.Variants[2].Price = models.NewMoney(1400, "EUR") }, false},
+		{"negative price", func(product *models.Product) { product.Variants[2].Price = usd(-1) }, false},
+		{"negative stock", func(product *models.Product) { product.Variants[2].Stock = -1 }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			product := shirt()
+			test.change(&product)
+
+			err := CheckVariants(product)
+			if test.valid && err != nil {
+				t.Errorf("CheckVariants() error = %v, want none", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidVariants) {
+				t.Errorf("CheckVariants() error = %v, want %v", err, ErrInvalidVariants)
+			}
+		})
+	}
+}
+
+func TestFindVariant(t *testing.T) {
+	tests := []struct {
+		name    string
+		product models.Product
+		sku     string
+		want    string
+		err     error
+	}{
+		{"variant", shirt(), "M-BLUE", "M-BLUE", nil},
+		{"no sku for a product with variants", shirt(), "", "", ErrVariantRequired},
+		{"unknown sku", shirt(), "L-RED", "", ErrVariantNotFound},
+		{"no sku for a plain product", models.Product{}, "", "", nil},
+		{"sku for a plain product", models.Product{}, "S-RED", "", ErrVariantNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			variant, err := FindVariant(test.product, test.sku)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("FindVariant() error = %v, want %v", err, test.err)
+			}
+			if (variant == nil) != (test.want == "") || variant != nil && variant.Sku != test.want {
+				t.Errorf("FindVariant() = %+v, want %q", variant, test.want)
+			}
+		})
+	}
+
+	// The variant found is the product's own, so stock changes stick
+	product := shirt()
+	variant, _ := FindVariant(product, "S-RED")
+	variant.Stock--
+	if product.Variants[0].Stock != 2 {
+		t.Errorf("stock of S-RED = %d after taking one off the variant found, want 2", product.Variants[0].Stock)
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	product := shirt()
+	RollUp(&product)
+	if product.Price != usd(1400) || product.Stock != 8 {
+		t.Errorf("RollUp() = %v with %d in stock, want the cheapest 14.00 USD and 8", product.Price, product.Stock)
+	}
+
+	plain := models.Product{Price: usd(999), Stock: 4}
+	RollUp(&plain)
+	if plain.Price != usd(999) || plain.Stock != 4 {
+		t.Errorf("RollUp() of a plain product = %v with %d in stock, want it untouched", plain.Price, plain.Stock)
+	}
+}
+
+func TestKeepStock(t *testing.T) {
+	before := shirt()
+	RollUp(&before)
+
+	tests := []struct {
+		name   string
+		change func(product *models.Product)
+		stock  map[string]int
+		total  int
+	}{
+		{"stock edited", func(product *models.Product) {
+			product.Variants[0].Stock, product.Stock = 100, 100
+		}, map[string]int{"S-RED": 3, "M-RED": 0, "M-BLUE": 5}, 8},
+		{"variant added", func(product *models.Product) {
+			product.Variants = append(product.Variants, models.Variant{Sku: "S-BLUE", Stock: 7})
+		}, map[string]int{"S-RED": 3, "M-RED": 0, "M-BLUE": 5, "S-BLUE": 0}, 8},
+		{"variant removed", func(product *models.Product) {
+			product.Variants = product.Variants[1:]
+		}, map[string]int{"M-RED": 0, "M-BLUE": 5}, 5},
+		{"variants dropped", func(product *models.Product) {
+			product.Variants, product.Stock = nil, 20
+		}, map[string]int{}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			product := shirt()
+			RollUp(&product)
+			test.change(&product)
+
+			KeepStock(&product, before)
+			if product.Stock != test.total || len(product.Variants) != len(test.stock) {
+				t.Fatalf("KeepStock() left %d in stock over %d variants, want %d over %d", product.Stock, len(product.Variants), test.total, len(test.stock))
+			}
+			for _, variant := range product.Variants {
+				if variant.Stock != test.stock[variant.Sku] {
+					t.Errorf("stock of %s = %d, want %d", variant.Sku, variant.Stock, test.stock[variant.Sku])
+				}
+			}
+		})
+	}
+
+	plain := models.Product{Stock: 4}
+	edited := models.Product{Stock: 40}
+	KeepStock(&edited, plain)
+	if edited.Stock != 4 {
+		t.Errorf("KeepStock() of a plain product = %d, want 4", edited.Stock)
+	}
+}
@@ -2,97 +2,230 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"time"
 	
+	"go-com/addresses"
+	"go-com/database"
 	"go-com/models"
 	
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func AddAddress() gin.HandlerFunc {
+// bindAddress reads an address from the request body and puts it in the form
+// its country uses. An invalid address gets a response listing every field
+// that is wrong.
+func (app *Application) bindAddress(c *gin.Context) (models.Address, bool) {
+	var address models.Address
+	if err := c.BindJSON(&address); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return address, false
+	}
+
+	var invalid *addresses.ValidationError
+	err := app.address_rules.Check(&address)
+	if errors.As(err, &invalid) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": addresses.ErrInvalidAddress.Error(), "fields": invalid.Fields})
+		return address, false
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return address, false
+	}
+
+	return address, true
+}
+
+// addressStatus picks the response code for errors around the address book
+func addressStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrAddressNotFound), errors.Is(err, database.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrUserIDIsNotValid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// addressParam reads the address ID from the path
+func addressParam(c *gin.Context) (primitive.ObjectID, bool) {
+	addressID, err := primitive.ObjectIDFromHex(c.Param("addressID"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, "Address ID is not valid")
+		return addressID, false
+	}
+
+	return addressID, true
+}
+
+func (app *Application) ListAddresses() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-		// Returns the keyed url query value
-		user_id := c.Query("id")
+		book, err := app.user_store.ListAddresses(ctx, actingUser(c))
+		if err != nil {
+			c.IndentedJSON(addressStatus(err), err.Error())
+			return
+		}
 
-		// Need to ensure user id is provided in the request before proceeding
-		if user_id == "" {
-			// Writes a header in the response when providing it with key:value args
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid code"})
-			c.Abort()
+		c.IndentedJSON(http.StatusOK, book)
+	}
+}
+
+func (app *Application) GetAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addressID, ok := addressParam(c)
+		if !ok {
 			return
 		}
 
-		// Generating an address using the hex string of user_id?
-		address, err := primitive.ObjectIDFromHex(user_id)
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		address, err := app.user_store.FindAddress(ctx, actingUser(c), addressID)
 		if err != nil {
-			c.IndentedJSON(500, "Internal Server Error")
+			c.IndentedJSON(addressStatus(err), err.Error())
+			return
 		}
 
-		//Creating a new object for the new address
-		var addresses models.Address
-		addresses.Address_id = primitive.NewObjectID()
+		c.IndentedJSON(http.StatusOK, address)
+	}
+}
 
-		// If the object fails to bind to JSON throw an error
-		if err = c.BindJSON(&addresses); err != nil {
-			c.IndentedJSON(http.StatusNotAcceptable, err.Error())
+// CreateAddress adds an address to the address book. Flagging it as the default
+// for shipping or billing takes the flag off the address that had it.
+func (app *Application) CreateAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address, ok := app.bindAddress(c)
+		if !ok {
+			return
 		}
+		address.Address_id = primitive.NewObjectID()
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		address, err := app.user_store.AddAddress(ctx, actingUser(c), address)
+		if err != nil {
+			c.IndentedJSON(addressStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, address)
+	}
+}
+
+func (app *Application) UpdateAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addressID, ok := addressParam(c)
+		if !ok {
+			return
+		}
+		address, ok := app.bindAddress(c)
+		if !ok {
+			return
+		}
+		address.Address_id = addressID
 
-		// Filtering documents based on the _id created for address, which is the user_id
-		// Flatten the results on the field 'address'
-		// Not sure whats happening in the group stage
-		match_filter := bson.D{{Key: "$match", Value: bson.D{primitive.E{Key: "_id", Value: address}}}}
-		unwind := bson.D{{Key: "$unwind", Value: bson.D{primitive.E{Key: "path", Value: "$address"}}}}
-		group := bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$address_id"}, {Key: "count", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}}}}}
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-		pointCursor, err := UserCollection.Aggregate(ctx, mongo.Pipeline{match_filter, unwind, group})
+		address, err := app.user_store.UpdateAddress(ctx, actingUser(c), address)
 		if err != nil {
-			c.IndentedJSON(500, "Internal Server Error")
+			c.IndentedJSON(addressStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, address)
+	}
+}
+
+// RemoveAddress deletes one address. What it was the default for passes to
+// the first address left.
+func (app *Application) RemoveAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addressID, ok := addressParam(c)
+		if !ok {
+			return
 		}
 
-		var addressInfo []bson.M
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-		// Binding the results in addressInfo, throws an error if something was wrong
-		if err = pointCursor.All(ctx, &addressInfo); err != nil {
-			panic(err)
+		if err := app.user_store.DeleteAddress(ctx, actingUser(c), addressID); err != nil {
+			c.IndentedJSON(addressStatus(err), err.Error())
+			return
 		}
 
-		// Saving the number into size
-		var size int32
-		for _, address_no := range addressInfo {
-			count := address_no["count"]
-			size = count.(int32)
+		c.IndentedJSON(http.StatusOK, "Successfully deleted the address")
+	}
+}
+
+// editAddressAt backs the old home and work address endpoints, which edit the
+// first and second address of the book. The address keeps its label and flags.
+func (app *Application) editAddressAt(ctx context.Context, userID string, index int, edited models.Address) error {
+	book, err := app.user_store.ListAddresses(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if index >= len(book) {
+		return database.ErrAddressNotFound
+	}
+
+	edited.Address_id = book[index].Address_id
+	edited.Label = book[index].Label
+	edited.Default_shipping = book[index].Default_shipping
+	edited.Default_billing = book[index].Default_billing
+	_, err = app.user_store.UpdateAddress(ctx, userID, edited)
+	return err
+}
+
+// AddAddress is the old way of adding an address, CreateAddress replaces it
+func (app *Application) AddAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// Returns the keyed url query value
+		user_id := actingUser(c)
+
+		// Need to ensure user id is provided in the request before proceeding
+		if user_id == "" {
+			// Writes a header in the response when providing it with key:value args
+			c.Header("Content-Type", "application/json")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid code"})
+			c.Abort()
+			return
 		}
 
-		// Add the address only if there are currently less than 2 addresses.
-		// Otherwise respond with an error.
-		if size < 2 {
-			filter := bson.D{primitive.E{Key: "_id", Value: address}}
-			update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "address", Value: addresses}}}}
-			_, err := UserCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				fmt.Println(err)
-			}
-		} else {
-			c.IndentedJSON(400, "Operation not allowed: Cannot add more than 2 addresses")
+		// If the object fails to bind to JSON throw an error
+		addresses, ok := app.bindAddress(c)
+		if !ok {
+			return
 		}
 
+		//Creating a new object for the new address
+		addresses.Address_id = primitive.NewObjectID()
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
+
+		_, err := app.user_store.AddAddress(ctx, user_id, addresses)
+		if err != nil {
+			c.IndentedJSON(500, "Internal Server Error")
+			return
+		}
+
 		ctx.Done()
+		c.IndentedJSON(200, "Successfully added the address")
 	}
 }
 
-func EditHomeAddress() gin.HandlerFunc {
+func (app *Application) EditHomeAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
+		user_id := actingUser(c)
 		// If user id is not provided in the header, respond with an error.
 		if user_id == "" {
 			c.Header("Content-Type", "application/json")
@@ -101,24 +234,20 @@ func EditHomeAddress() gin.HandlerFunc {
 			return
 		}
 
-		user_id2, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			c.IndentedJSON(500, err)
-		}
-
 		//If the address cannot bind to JSON respond with an error
-		var editAddress models.Address
-		if err = c.BindJSON(&editAddress); err != nil {
-			c.IndentedJSON(http.StatusBadRequest, err.Error())
+		editAddress, ok := app.bindAddress(c)
+		if !ok {
+			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		filter := bson.D{primitive.E{Key: "_id", Value: user_id2}}
-		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address.0.house_name", Value: editAddress.House}, {Key: "address.0.street_name", Value: editAddress.Street}, {Key: "address.0.city_name", Value: editAddress.City}, {Key: "address.0.postcode", Value: editAddress.PostCode}}}}
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
-
+		err := app.editAddressAt(ctx, user_id, 0, editAddress)
+		if errors.Is(err, database.ErrAddressNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
 		if err != nil {
 			c.IndentedJSON(500, "Something went wrong: Could not update the address")
 			return
@@ -130,9 +259,9 @@ func EditHomeAddress() gin.HandlerFunc {
 	}
 }
 
-func EditWorkAddress() gin.HandlerFunc {
+func (app *Application) EditWorkAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
+		user_id := actingUser(c)
 		// If user id is not provided in the header, respond with an error.
 		if user_id == "" {
 			c.Header("Content-Type", "application/json")
@@ -141,24 +270,20 @@ func EditWorkAddress() gin.HandlerFunc {
 			return
 		}
 
-		user_id2, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			c.IndentedJSON(500, err)
-		}
-
 		//If the address cannot bind to JSON respond with an error
-		var editAddress models.Address
-		if err = c.BindJSON(&editAddress); err != nil {
-			c.IndentedJSON(http.StatusBadRequest, err.Error())
+		editAddress, ok := app.bindAddress(c)
+		if !ok {
+			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		filter := bson.D{primitive.E{Key: "_id", Value: user_id2}}
-		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address.1.house_name", Value: editAddress.House}, {Key: "address.1.street_name", Value: editAddress.Street}, {Key: "address.1.city_name", Value: editAddress.City}, {Key: "address.1.postcode", Value: editAddress.PostCode}}}}
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
-
+		err := app.editAddressAt(ctx, user_id, 1, editAddress)
+		if errors.Is(err, database.ErrAddressNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
 		if err != nil {
 			c.IndentedJSON(500, "Something went wrong: Could not update the address")
 			return
@@ -170,9 +295,9 @@ func EditWorkAddress() gin.HandlerFunc {
 	}
 }
 
-func DeleteAddress() gin.HandlerFunc {
+func (app *Application) DeleteAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
+		user_id := actingUser(c)
 		if user_id == "" {
 			c.Header("Content-Type", "application/json")
 			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid search index"})
@@ -180,19 +305,11 @@ func DeleteAddress() gin.HandlerFunc {
 			return
 		}
 
-		addresses := make([]models.Address, 0)
-		user_id2, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			c.IndentedJSON(500, "Internal Server Error")
-		}
-
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
 		//Deleting all existing addresses?
-		filter := bson.D{primitive.E{Key: "_id", Value: user_id2}}
-		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address", Value: addresses}}}}
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
+		err := app.user_store.DeleteAddresses(ctx, user_id)
 
 		if err != nil {
 			c.IndentedJSON(404, "Wrong")
@@ -205,3 +322,32 @@ func DeleteAddress() gin.HandlerFunc {
 
 	}
 }
+
+// shippingAddress picks the address an order is shipped to: the one named by
+// the "address" query parameter, or else the user's default shipping address.
+// Users without any address get nil.
+func (app *Application) shippingAddress(ctx context.Context, c *gin.Context, userID string) (*models.Address, error) {
+	if raw := c.Query("address"); raw != "" {
+		addressID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return nil, database.ErrAddressNotFound
+		}
+		address, err := app.user_store.FindAddress(ctx, userID, addressID)
+		if err != nil {
+			return nil, err
+		}
+		return &address, nil
+	}
+
+	book, err := app.user_store.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range book {
+		if address.Default_shipping {
+			return &address, nil
+		}
+	}
+
+	return nil, nil
+}
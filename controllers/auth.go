@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-com/database"
+	"go-com/models"
+	"go-com/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ADMIN_EMAILS is a comma separated list of emails that sign up as admins.
+// It is how the first admin comes to exist, later ones can be promoted by an admin.
+var ADMIN_EMAILS = os.Getenv("ADMIN_EMAILS")
+
+func isAdminEmail(email string) bool {
+	for _, admin := range strings.Split(ADMIN_EMAILS, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// actingUser is the user a request works on. That is the user of the token,
+// except on the /admin/users/:userID routes where an admin names the user.
+func actingUser(c *gin.Context) string {
+	if userID := c.Param("userID"); userID != "" {
+		return userID
+	}
+
+	return c.GetString("uid")
+}
+
+// userRole is the role tokens are signed with, users from before roles are customers
+func userRole(user models.User) models.Role {
+	if user.Role == "" {
+		return models.RoleCustomer
+	}
+
+	return user.Role
+}
+
+// tokenFamily is what the store keeps about the refresh token that was just signed
+func tokenFamily(refreshClaims *tokens.SignedDetails) models.TokenFamily {
+	return models.TokenFamily{
+		Family_id:  refreshClaims.Family,
+		Token_id:   refreshClaims.Id,
+		Expires_at: time.Unix(refreshClaims.ExpiresAt, 0),
+	}
+}
+
+// RefreshToken swaps a refresh token for a new access token and refresh token.
+// The old refresh token stops working. Presenting it again is taken as a sign
+// that it leaked, and every token of that login is revoked.
+func (app *Application) RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Refresh_token string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, msg := tokens.ValidateRefreshToken(body.Refresh_token)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := app.user_store.FindUserByID(ctx, claims.Uid)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is invalid"})
+			return
+		}
+
+		token, refreshToken, refreshClaims, err := tokens.GenerateToken(*user.Email, *user.First_name, *user.Last_name, user.User_id, string(userRole(user)), claims.Family)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate the tokens"})
+			return
+		}
+
+		err = app.user_store.RotateRefreshToken(ctx, user.User_id, claims.Family, claims.Id, tokenFamily(refreshClaims))
+		if errors.Is(err, database.ErrRefreshTokenReused) || errors.Is(err, database.ErrTokenFamilyRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update the tokens"})
+			return
+		}
+
+		if err = app.user_store.UpdateAllTokens(ctx, token, refreshToken, user.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update the tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
+
+// SetUserRole changes what a user is allowed to do. The user's logins are revoked
+// so the new role is in every token from the next login on.
+func (app *Application) SetUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Role models.Role `json:"role" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !body.Role.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be customer, admin or support"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := app.user_store.SetUserRole(ctx, c.Param("userID"), body.Role)
+		switch {
+		case errors.Is(err, database.ErrUserIDIsNotValid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, database.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update the role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user_id": c.Param("userID"), "role": body.Role})
+	}
+}
@@ -3,30 +3,62 @@ package controllers
 import (
 	"context"
 	"errors"
+	"go-com/addresses"
+	"go-com/catalog"
+	"go-com/coupons"
 	"go-com/database"
 	"go-com/models"
+	"go-com/payments"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Application struct {
-	prod_collection *mongo.Collection
-	user_collection *mongo.Collection
+	prod_store   database.ProductStore
+	user_store   database.UserStore
+	cart_store   database.CartStore
+	wishlist_store database.WishlistStore
+	guest_store  database.GuestCartStore
+	guest_carts  database.CartStore
+	order_store  database.OrderStore
+	coupon_store database.CouponStore
+	category_store database.CategoryStore
+	payment_providers *payments.Registry
+	address_rules *addresses.Registry
 }
 
-func NewApplication(prodCollection, userCollection *mongo.Collection) *Application {
+// NewApplication serves the store, taking payments with the given providers
+func NewApplication(store database.Store, providers ...payments.PaymentProvider) *Application {
 	return &Application{
-		prod_collection: prodCollection,
-		user_collection: userCollection,
+		prod_store:   store,
+		user_store:   store,
+		cart_store:   store,
+		wishlist_store: store,
+		guest_store:  store,
+		guest_carts:  store.GuestCarts(),
+		order_store:  store,
+		coupon_store: store,
+		category_store: store,
+		payment_providers: payments.NewRegistry(providers...),
+		address_rules: addresses.Default(),
 	}
 }
 
+// cartOf picks the cart a request works on and who it belongs to: the guest
+// cart of the token the Guest middleware found, otherwise the acting user's cart
+func (app *Application) cartOf(c *gin.Context) (database.CartStore, string) {
+	if guestToken := c.GetString("guest"); guestToken != "" {
+		return app.guest_carts, guestToken
+	}
+
+	return app.cart_store, actingUser(c)
+}
+
 func (app *Application) AddToCart() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// Fetches the query value from the URL parameter keyed "id"
@@ -38,7 +70,7 @@ func (app *Application) AddToCart() gin.HandlerFunc{
 			return 
 		}
 
-		userQueryID := c.Query("userID")
+		cart, userQueryID := app.cartOf(c)
 		if userQueryID == "" {
 			log.Println("User ID is empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
@@ -53,12 +85,36 @@ func (app *Application) AddToCart() gin.HandlerFunc{
 			return 
 		}
 
+		// Quantity is optional and defaults to a single item
+		quantity := 1
+		if quantityQuery := c.Query("quantity"); quantityQuery != "" {
+			quantity, err = strconv.Atoi(quantityQuery)
+			if err!=nil || quantity < 1 {
+				_ = c.AbortWithError(http.StatusBadRequest, database.ErrInvalidQuantity)
+				return
+			}
+		}
+
 		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.AddProductToCart(ctx, app.prod_collection, app.user_collection, productID, userQueryID)
+		// Products with variants are added one variant at a time, picked by ?sku=
+		err = cart.AddProductToCart(ctx, productID, c.Query("sku"), userQueryID, quantity)
+		if errors.Is(err, database.ErrNotEnoughStock) || errors.Is(err, database.ErrProductArchived) {
+			c.IndentedJSON(http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, catalog.ErrVariantRequired) || errors.Is(err, catalog.ErrVariantNotFound) {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, database.ErrGuestCartNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
 		if err!=nil {
-			c.IndentedJSON(http.StatusInternalServerError, err)
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
 		}
 		c.IndentedJSON(200, "Successfully added to the cart")
 	}
@@ -73,7 +129,7 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 			return 
 		}
 
-		userQueryID := c.Query("userID")
+		cart, userQueryID := app.cartOf(c)
 		if userQueryID == "" {
 			log.Println("User ID is empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
@@ -91,64 +147,150 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.RemoveCartItem(ctx, app.prod_collection, app.user_collection, productID, userQueryID)
+		err = cart.RemoveCartItem(ctx, productID, c.Query("sku"), userQueryID)
+		if errors.Is(err, database.ErrGuestCartNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
 		if err!=nil {
-			c.IndentedJSON(http.StatusInternalServerError, err)
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
 		}
 		c.IndentedJSON(200, "Successfully removed from the cart")
 	}
 }	
 
-func GetItemFromCart() gin.HandlerFunc{
+func (app *Application) SetItemQuantity() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid ID"})
-			c.Abort()
+		productQueryID := c.Query("id")
+		if productQueryID == "" {
+			log.Println("Product ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("Product ID is empty"))
 			return 
 		}
 
-		user_id2, _ := primitive.ObjectIDFromHex(user_id)
-
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		defer cancel()
+		cart, userQueryID := app.cartOf(c)
+		if userQueryID == "" {
+			log.Println("User ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
+			return 
+		}
 
-		var filledCart models.User
+		quantity, err := strconv.Atoi(c.Query("quantity"))
+		if err!=nil || quantity < 0 {
+			_ = c.AbortWithError(http.StatusBadRequest, database.ErrInvalidQuantity)
+			return
+		}
 
-		err := UserCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: user_id2}}).Decode(&filledCart)
+		productID, err := primitive.ObjectIDFromHex(productQueryID)
 		if err!=nil {
 			log.Println(err)
-			c.IndentedJSON(500, "ID not found")
+			c.AbortWithStatus(http.StatusInternalServerError)
 			return 
 		}
 
-		filter_match := bson.D{{Key: "$match", Value: bson.D{primitive.E{Key: "_id", Value: user_id2}}}}
-		unwind := bson.D{{Key: "$unwind", Value: bson.D{primitive.E{Key: "path", Value: "$usercart"}}}}
-		grouping := bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$_id"}, {Key: "total", Value: bson.D{primitive.E{Key: "$sum", Value: "$usercart.price"}}}}}}
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-		pointCursor, err := UserCollection.Aggregate(ctx, mongo.Pipeline{filter_match, unwind, grouping})
+		// A quantity of zero removes the line from the cart
+		err = cart.SetCartItemQuantity(ctx, productID, c.Query("sku"), userQueryID, quantity)
+		if errors.Is(err, database.ErrItemNotInCart) || errors.Is(err, database.ErrGuestCartNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		if errors.Is(err, database.ErrNotEnoughStock) {
+			c.IndentedJSON(http.StatusConflict, err.Error())
+			return
+		}
 		if err!=nil {
-			log.Println(err)
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.IndentedJSON(200, "Successfully updated the quantity")
+	}
+}
+
+func (app *Application) DecrementItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productQueryID := c.Query("id")
+		if productQueryID == "" {
+			log.Println("Product ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("Product ID is empty"))
+			return 
+		}
+
+		cart, userQueryID := app.cartOf(c)
+		if userQueryID == "" {
+			log.Println("User ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
+			return 
 		}
 
-		var listing []bson.M
-		if err = pointCursor.All(ctx, &listing); err!=nil {
+		productID, err := primitive.ObjectIDFromHex(productQueryID)
+		if err!=nil {
 			log.Println(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
+			return 
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err = cart.DecrementCartItem(ctx, productID, c.Query("sku"), userQueryID)
+		if errors.Is(err, database.ErrItemNotInCart) || errors.Is(err, database.ErrGuestCartNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		if err!=nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.IndentedJSON(200, "Successfully decremented the item")
+	}
+}
+
+func (app *Application) GetItemFromCart() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		cart, user_id := app.cartOf(c)
+		if user_id == "" {
+			c.Header("Content-Type", "application/json")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid ID"})
+			c.Abort()
+			return 
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Users see the cart priced for their shipping address, guests don't have one yet
+		var shipping *models.Address
+		if c.GetString("guest") == "" {
+			var err error
+			if shipping, err = app.shippingAddress(ctx, c, user_id); err!=nil {
+				c.IndentedJSON(checkoutStatus(err), err.Error())
+				return
+			}
 		}
 
-		for _, json := range listing {
-			c.IndentedJSON(200, json["total"])
-			c.IndentedJSON(200, filledCart.UserCart)
+		// The same quote the checkout charges, an empty cart is a quote without lines
+		quote, err := cart.QuoteCart(ctx, user_id, shipping)
+		if errors.Is(err, database.ErrGuestCartNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		if err!=nil {
+			log.Println(err)
+			c.IndentedJSON(checkoutStatus(err), err.Error())
+			return 
 		}
-		ctx.Done()
+
+		c.IndentedJSON(200, quote)
 	}
 }
 
 func (app *Application) BuyFromCart() gin.HandlerFunc{
 		return func(c *gin.Context){
-			userQueryID := c.Query("id")
+			userQueryID := actingUser(c)
 			if userQueryID == "" {
 				log.Panicln("User ID is empty")
 				_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
@@ -157,17 +299,28 @@ func (app *Application) BuyFromCart() gin.HandlerFunc{
 			var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			err := database.BuyItemFromCart(ctx, app.user_collection, userQueryID)
+			shipping, err := app.shippingAddress(ctx, c, userQueryID)
 			if err!=nil {
-				c.IndentedJSON(http.StatusInternalServerError, err)
+				c.IndentedJSON(checkoutStatus(err), err.Error())
+				return
 			}
-			c.IndentedJSON(200, "Successfully placed the order")
+
+			preview, err := app.order_store.PreviewCart(ctx, userQueryID, shipping)
+			if err!=nil {
+				c.IndentedJSON(checkoutStatus(err), err.Error())
+				return
+			}
+
+			order, err := app.checkout(ctx, c, preview, func(payment models.Payment) (models.Order, error) {
+				return app.order_store.BuyItemFromCart(ctx, userQueryID, shipping, payment)
+			})
+			placed(c, order, err)
 		}
 }
 
 func (app *Application) InstantBuy() gin.HandlerFunc{
 	return func(c *gin.Context){
-		userQueryID := c.Query("id")
+		userQueryID := actingUser(c)
 		if userQueryID == "" {
 			log.Println("User ID is empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
@@ -191,10 +344,47 @@ func (app *Application) InstantBuy() gin.HandlerFunc{
 		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.InstantBuyer(ctx, app.prod_collection, app.user_collection, productID, userQueryID)
+		shipping, err := app.shippingAddress(ctx, c, userQueryID)
 		if err!=nil {
-			c.IndentedJSON(http.StatusInternalServerError, err)
+			c.IndentedJSON(checkoutStatus(err), err.Error())
+			return
 		}
-		c.IndentedJSON(200, "Successfully placed the order")
+
+		sku := c.Query("sku")
+		preview, err := app.order_store.PreviewInstantBuy(ctx, productID, sku, userQueryID, shipping)
+		if err!=nil {
+			c.IndentedJSON(checkoutStatus(err), err.Error())
+			return
+		}
+
+		order, err := app.checkout(ctx, c, preview, func(payment models.Payment) (models.Order, error) {
+			return app.order_store.InstantBuyer(ctx, productID, sku, userQueryID, shipping, payment)
+		})
+		placed(c, order, err)
+	}
+}
+
+// checkoutStatus picks the response code for an error coming back from a checkout
+// that didn't place the order. Nothing was written then, so the client can simply retry.
+func checkoutStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrUserIDIsNotValid), errors.Is(err, database.ErrCartIsEmpty):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrCantFindProduct), errors.Is(err, database.ErrAddressNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, payments.ErrUnknownProvider), errors.Is(err, catalog.ErrVariantRequired), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, payments.ErrPaymentDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, database.ErrNotEnoughStock), errors.Is(err, models.ErrCurrencyMismatch),
+		errors.Is(err, database.ErrPaymentMismatch), errors.Is(err, database.ErrProductArchived):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrCouponNotFound), errors.Is(err, coupons.ErrCouponInactive),
+		errors.Is(err, coupons.ErrCouponExpired), errors.Is(err, coupons.ErrCouponUsedUp),
+		errors.Is(err, coupons.ErrCouponUserLimit), errors.Is(err, coupons.ErrBelowMinimum):
+		// The coupon on the cart no longer applies, the customer has to remove it
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-com/catalog"
+	"go-com/database"
+	"go-com/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// categoryStatus picks the response code for errors around categories
+func categoryStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrCategorySlugTaken), errors.Is(err, database.ErrCategoryHasChildren):
+		return http.StatusConflict
+	case errors.Is(err, catalog.ErrInvalidSlug), errors.Is(err, catalog.ErrInvalidParent):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// bindCategory reads a category from the request body. Without a slug one is
+// made from the name.
+func bindCategory(c *gin.Context) (models.Category, bool) {
+	var category models.Category
+	if err := c.BindJSON(&category); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return category, false
+	}
+
+	if category.Slug == "" {
+		category.Slug = catalog.Slugify(category.Name)
+	}
+	if err := validate.Struct(category); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return category, false
+	}
+	if err := catalog.ValidSlug(category.Slug); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return category, false
+	}
+
+	return category, true
+}
+
+// checkParent makes sure the parent exists and that the category doesn't end up under itself
+func (app *Application) checkParent(ctx context.Context, category models.Category) error {
+	if category.Parent_id == nil {
+		return nil
+	}
+
+	categories, err := app.category_store.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, existing := range categories {
+		found = found || existing.Category_id == *category.Parent_id
+	}
+	if !found {
+		return catalog.ErrInvalidParent
+	}
+
+	return catalog.ValidParent(categories, category.Category_id, category.Parent_id)
+}
+
+// checkCategories makes sure every category a product is put in exists
+func (app *Application) checkCategories(ctx context.Context, categoryIDs []primitive.ObjectID) error {
+	for _, categoryID := range categoryIDs {
+		if _, err := app.category_store.FindCategory(ctx, categoryID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// browseCategory narrows the listing down to the category in ?category=, given
+// by its slug, and everything below it
+func (app *Application) browseCategory(ctx context.Context, c *gin.Context, query *catalog.Query) error {
+	slug := c.Query("category")
+	if slug == "" {
+		return nil
+	}
+
+	category, err := app.category_store.FindCategoryBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	categories, err := app.category_store.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+
+	query.Categories = catalog.Descendants(categories, category.Category_id)
+	return nil
+}
+
+// ListCategories responds with the whole category tree
+func (app *Application) ListCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		categories, err := app.category_store.ListCategories(ctx)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, catalog.Tree(categories))
+	}
+}
+
+func (app *Application) CreateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		category, ok := bindCategory(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		category.Category_id = primitive.NewObjectID()
+		if err := app.checkParent(ctx, category); err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		category.Created_at = time.Now()
+		category.Updated_at = category.Created_at
+		if err := app.category_store.InsertCategory(ctx, category); err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, category)
+	}
+}
+
+// UpdateCategory renames a category or moves it, along with everything under it
+func (app *Application) UpdateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, "Category ID is not valid")
+			return
+		}
+
+		category, ok := bindCategory(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		category.Category_id = categoryID
+		if err = app.checkParent(ctx, category); err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		category.Updated_at = time.Now()
+		if err = app.category_store.UpdateCategory(ctx, category); err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		updated, err := app.category_store.FindCategory(ctx, categoryID)
+		if err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteCategory removes a category that has no categories under it. Its
+// products stay, they are just no longer in it.
+func (app *Application) DeleteCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, "Category ID is not valid")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err = app.category_store.DeleteCategory(ctx, categoryID); err != nil {
+			c.IndentedJSON(categoryStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully deleted the category")
+	}
+}
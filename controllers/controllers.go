@@ -3,7 +3,7 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"go-com/database"
+	"go-com/catalog"
 	"go-com/models"
 	"go-com/tokens"
 	"log"
@@ -12,14 +12,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var UserCollection *mongo.Collection = database.UserData(database.Client, "Users")
-var ProdCollection *mongo.Collection = database.ProductData(database.Client, "Products")
 var validate = validator.New()
 
 func HashPassword(password string) string {
@@ -44,7 +40,7 @@ func VerifyPassword(userPassword, givenPassword string) (bool, string) {
 	return valid, msg
 }
 
-func SignUp() gin.HandlerFunc {
+func (app *Application) SignUp() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
@@ -55,13 +51,19 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// A guest cart brought along in the guest_token header becomes the new user's cart
+		strategy, ok := guestMergeStrategy(c)
+		if !ok {
+			return
+		}
+
 		validationErr := validate.Struct(user)
 		if validationErr != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
 			return
 		}
 
-		count, err := UserCollection.CountDocuments(ctx, bson.M{"email": user.Email})
+		count, err := app.user_store.CountUsersByEmail(ctx, *user.Email)
 		if err != nil {
 			log.Panic(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -70,9 +72,10 @@ func SignUp() gin.HandlerFunc {
 
 		if count > 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
+			return
 		}
 
-		count, err = UserCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
+		count, err = app.user_store.CountUsersByPhone(ctx, *user.Phone)
 		defer cancel()
 
 		if err != nil {
@@ -93,37 +96,60 @@ func SignUp() gin.HandlerFunc {
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
-		token, refreshToken, _ := tokens.GenerateToken(*user.Email, *user.First_name, *user.Last_name, user.User_id)
+		// The role is never taken from the request, only the configured admins start out as admins
+		user.Role = models.RoleCustomer
+		if isAdminEmail(*user.Email) {
+			user.Role = models.RoleAdmin
+		}
+		token, refreshToken, refreshClaims, err := tokens.GenerateToken(*user.Email, *user.First_name, *user.Last_name, user.User_id, string(user.Role), tokens.NewID())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate the tokens"})
+			return
+		}
 		user.Token = &token
 		user.Refresh_Token = &refreshToken
+		user.Token_families = []models.TokenFamily{tokenFamily(refreshClaims)}
 		user.UserCart = make([]models.ProductUser, 0)
+		user.Wishlist = make([]models.WishlistItem, 0)
 		user.Address_Details = make([]models.Address, 0)
-		user.Order_Status = make([]models.Order, 0)
 
-		_, insertErr := UserCollection.InsertOne(ctx, user)
+		insertErr := app.user_store.InsertUser(ctx, user)
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Not inserted"})
 			return
 		}
+		app.mergeGuestCart(ctx, c, user.User_id, strategy)
 
 		defer cancel()
 		c.JSON(http.StatusCreated, "Successfully signed up!")
 	}
 }
 
-func Login() gin.HandlerFunc {
+func (app *Application) Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		var user, foundUser models.User
+		var user models.User
 
 		if err := c.BindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err})
 			return
 		}
 
-		err := UserCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+		if user.Email == nil || user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email and password are required"})
+			return
+		}
+
+		// A guest cart brought along in the guest_token header is merged into the
+		// user's cart, products in both carts as the "merge" parameter says
+		strategy, ok := guestMergeStrategy(c)
+		if !ok {
+			return
+		}
+
+		foundUser, err := app.user_store.FindUserByEmail(ctx, *user.Email)
 		defer cancel()
 
 		if err != nil {
@@ -136,19 +162,35 @@ func Login() gin.HandlerFunc {
 		if !passwordIsValid {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			fmt.Println(msg)
+			return
 		}
 
-		token, refreshToken,  _ := tokens.GenerateToken(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
-		defer cancel()
+		token, refreshToken, refreshClaims, err := tokens.GenerateToken(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, string(userRole(foundUser)), tokens.NewID())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate the tokens"})
+			return
+		}
 		
-		// What is the difference between GenerateToken & UpdateAllTokens?
-		tokens.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+		// GenerateToken only signs the tokens, UpdateAllTokens stores them on the user
+		if err = app.user_store.StartTokenFamily(ctx, foundUser.User_id, tokenFamily(refreshClaims)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update the tokens"})
+			return
+		}
+		if err = app.user_store.UpdateAllTokens(ctx, token, refreshToken, foundUser.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update the tokens"})
+			return
+		}
+		foundUser.Token = &token
+		foundUser.Refresh_Token = &refreshToken
+		if merged, ok := app.mergeGuestCart(ctx, c, foundUser.User_id, strategy); ok {
+			foundUser.UserCart = merged
+		}
 		c.JSON(http.StatusFound, foundUser)
 	}
 
 }
 
-func ProductViewerAdmin() gin.HandlerFunc {
+func (app *Application) ProductViewerAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var product models.Product
@@ -160,9 +202,24 @@ func ProductViewerAdmin() gin.HandlerFunc {
 			return
 		}
 
+		// Products with variants are priced and stocked by their variants
+		catalog.RollUp(&product)
+		if err := validateProduct(product); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := app.checkCategories(ctx, product.Categories); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		//Creating a new ID for the product and inserting it into the DB
 		product.Product_id = primitive.NewObjectID()
-		_, anyerr := ProdCollection.InsertOne(ctx, product)
+		product.Archived = false
+		product.Archived_at = nil
+		product.Created_at = time.Now()
+		product.Updated_at = product.Created_at
+		anyerr := app.prod_store.InsertProduct(ctx, product)
 		if anyerr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Not created"})
 			return
@@ -174,33 +231,26 @@ func ProductViewerAdmin() gin.HandlerFunc {
 	}
 }
 
-func SearchProduct() gin.HandlerFunc {
+func (app *Application) SearchProduct() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var productList []models.Product
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Retrieve all products
-		cursor, err := ProdCollection.Find(ctx, bson.D{{}})
+		query, err := productQuery(c)
 		if err != nil {
-			c.IndentedJSON(http.StatusInternalServerError, "Something went wrong")
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
 			return
 		}
-
-		err = cursor.All(ctx, &productList)
-		if err != nil {
-			log.Println(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+		if err = app.browseCategory(ctx, c, &query); err != nil {
+			c.IndentedJSON(listingStatus(err), err.Error())
 			return
 		}
 
-		defer cursor.Close(ctx)
-		// Returns the last error seen by the cursor, otherwise it returns nil
-		if err := cursor.Err(); err != nil {
-			// Don't forget to log errors. I log them really simple here just
-			// to get the point across.
+		// Retrieve one page of the products
+		productList, err := app.prod_store.ListProducts(ctx, query)
+		if err != nil {
 			log.Println(err)
-			c.IndentedJSON(400, "Invalid")
+			c.IndentedJSON(listingStatus(err), "Something went wrong")
 			return
 		}
 
@@ -209,11 +259,14 @@ func SearchProduct() gin.HandlerFunc {
 	}
 }
 
-func SearchProductByQuery() gin.HandlerFunc {
+// SearchProductByQuery filters products by a piece of their name with ?name=, or
+// searches names and descriptions with ?q= and ranks what it finds by relevance.
+// Both count facets of everything they found.
+func (app *Application) SearchProductByQuery() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var searchProducts []models.Product
 		queryParam := c.Query("name")
-		if queryParam == "" {
+		search := c.Query("q")
+		if queryParam == "" && search == "" {
 			log.Println("Query is empty")
 			c.Header("Content-Type", "application/json")
 			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid index search"})
@@ -224,25 +277,39 @@ func SearchProductByQuery() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		searchQueryDB, err := ProdCollection.Find(ctx, bson.M{"product_name": bson.M{"$regex": queryParam}})
+		query, err := productQuery(c)
 		if err != nil {
-			c.IndentedJSON(400, "Something went wrong while fetching the DB query")
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
 			return
 		}
-
-		err = searchQueryDB.All(ctx, &searchProducts)
-		if err != nil {
-			log.Println(err)
-			c.IndentedJSON(400, "Invalid")
+		query.Name = queryParam
+		query.Facets = true
+		if err = app.browseCategory(ctx, c, &query); err != nil {
+			c.IndentedJSON(listingStatus(err), err.Error())
 			return
 		}
 
-		// Closes the cursor
-		defer searchQueryDB.Close(ctx)
+		if search != "" {
+			if query.Terms, err = catalog.ParseSearch(search); err != nil {
+				c.IndentedJSON(http.StatusBadRequest, err.Error())
+				return
+			}
+
+			results, err := app.prod_store.SearchProducts(ctx, query)
+			if err != nil {
+				log.Println(err)
+				c.IndentedJSON(listingStatus(err), "Something went wrong while searching")
+				return
+			}
 
-		if err := searchQueryDB.Err(); err != nil {
+			c.IndentedJSON(200, results)
+			return
+		}
+
+		searchProducts, err := app.prod_store.ListProducts(ctx, query)
+		if err != nil {
 			log.Println(err)
-			c.IndentedJSON(400, "Invalid request")
+			c.IndentedJSON(400, "Something went wrong while fetching the DB query")
 			return
 		}
 
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-com/coupons"
+	"go-com/database"
+	"go-com/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// couponStatus picks the response code for errors around coupons
+func couponStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrCouponCodeTaken):
+		return http.StatusConflict
+	case errors.Is(err, coupons.ErrInvalidCouponRules), errors.Is(err, coupons.ErrCouponInactive),
+		errors.Is(err, coupons.ErrCouponExpired), errors.Is(err, coupons.ErrCouponUsedUp),
+		errors.Is(err, coupons.ErrCouponUserLimit), errors.Is(err, coupons.ErrBelowMinimum),
+		errors.Is(err, models.ErrCurrencyMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// bindCoupon reads a coupon from the request body and checks its rules
+func bindCoupon(c *gin.Context) (models.Coupon, bool) {
+	var coupon models.Coupon
+	if err := c.BindJSON(&coupon); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return coupon, false
+	}
+
+	coupon.Code = coupons.NormalizeCode(coupon.Code)
+	if err := validate.Struct(coupon); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return coupon, false
+	}
+	if err := coupons.CheckRules(coupon); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return coupon, false
+	}
+
+	return coupon, true
+}
+
+func (app *Application) CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coupon, ok := bindCoupon(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		coupon.Coupon_id = primitive.NewObjectID()
+		coupon.Used_count = 0
+		coupon.Used_by = make(map[string]int)
+		coupon.Created_at = time.Now()
+		coupon.Updated_at = coupon.Created_at
+		if err := app.coupon_store.InsertCoupon(ctx, coupon); err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, coupon)
+	}
+}
+
+func (app *Application) ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		list, err := app.coupon_store.ListCoupons(ctx)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, list)
+	}
+}
+
+func (app *Application) UpdateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		couponID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, "Coupon ID is not valid")
+			return
+		}
+
+		coupon, ok := bindCoupon(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		coupon.Coupon_id = couponID
+		coupon.Updated_at = time.Now()
+		if err = app.coupon_store.UpdateCoupon(ctx, coupon); err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		updated, err := app.coupon_store.FindCoupon(ctx, couponID)
+		if err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, updated)
+	}
+}
+
+func (app *Application) DeleteCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		couponID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, "Coupon ID is not valid")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err = app.coupon_store.DeleteCoupon(ctx, couponID); err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully deleted the coupon")
+	}
+}
+
+// ApplyCoupon puts a coupon code on the user's cart after checking it against
+// the cart as it is now. Checkout checks it once more before charging.
+func (app *Application) ApplyCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userQueryID := actingUser(c)
+		if userQueryID == "" {
+			log.Println("User ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
+			return
+		}
+
+		code := coupons.NormalizeCode(c.Query("code"))
+		if code == "" {
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("Coupon code is empty"))
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		coupon, err := app.coupon_store.FindCouponByCode(ctx, code)
+		if err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		subtotal, err := app.cart_store.CartTotal(ctx, userQueryID)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		discount, err := coupons.Discount(coupon, subtotal, userQueryID, time.Now())
+		if err != nil {
+			c.IndentedJSON(couponStatus(err), err.Error())
+			return
+		}
+
+		if err = app.cart_store.SetCartCoupon(ctx, userQueryID, &code); err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, gin.H{"coupon_code": code, "discount": discount})
+	}
+}
+
+func (app *Application) RemoveCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userQueryID := actingUser(c)
+		if userQueryID == "" {
+			log.Println("User ID is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("User ID is empty"))
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.cart_store.SetCartCoupon(ctx, userQueryID, nil); err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully removed the coupon")
+	}
+}
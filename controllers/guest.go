@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-com/carts"
+	"go-com/database"
+	"go-com/models"
+	"go-com/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateGuestCart starts an empty cart for a visitor and hands out its guest
+// token. The guest cart routes take the token in the guest_token header, and
+// logging in or signing up with it moves the cart into the user's.
+func (app *Application) CreateGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		cart := models.GuestCart{
+			Token:      tokens.NewID(),
+			UserCart:   make([]models.ProductUser, 0),
+			Created_at: now,
+			Updated_at: now,
+		}
+		if err := app.guest_store.InsertGuestCart(ctx, cart); err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, cart)
+	}
+}
+
+// guestMergeStrategy reads how a login or signup should merge the guest cart,
+// from the "merge" query parameter
+func guestMergeStrategy(c *gin.Context) (carts.MergeStrategy, bool) {
+	strategy, err := carts.ParseMergeStrategy(c.Query("merge"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return strategy, false
+	}
+
+	return strategy, true
+}
+
+// mergeGuestCart moves the cart of the guest_token header, when there is one,
+// into the user's cart and returns the user's cart after it. A guest cart that
+// expired or was merged before leaves the user's cart as it is, logging in
+// shouldn't fail over it.
+func (app *Application) mergeGuestCart(ctx context.Context, c *gin.Context, userID string, strategy carts.MergeStrategy) ([]models.ProductUser, bool) {
+	guestToken := c.Request.Header.Get("guest_token")
+	if guestToken == "" {
+		return nil, false
+	}
+
+	merged, err := app.guest_store.MergeGuestCart(ctx, guestToken, userID, strategy)
+	if err != nil {
+		if !errors.Is(err, database.ErrGuestCartNotFound) {
+			log.Println(err)
+		}
+		return nil, false
+	}
+
+	return merged, true
+}
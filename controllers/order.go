@@ -0,0 +1,362 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-com/database"
+	"go-com/models"
+	"go-com/orders"
+	"go-com/payments"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func orderStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, orders.ErrUnknownStatus), errors.Is(err, orders.ErrInvalidRefund):
+		return http.StatusBadRequest
+	case errors.Is(err, orders.ErrInvalidTransition), errors.Is(err, orders.ErrNotCancellable),
+		errors.Is(err, orders.ErrNotRefundable), errors.Is(err, orders.ErrNothingToRefund),
+		errors.Is(err, database.ErrOrderChanged), errors.Is(err, payments.ErrInvalidOperation),
+		errors.Is(err, payments.ErrAmountTooLarge):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// orderParam reads the order ID from the path
+func orderParam(c *gin.Context) (primitive.ObjectID, bool) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusBadRequest, "Order ID is not valid")
+		return orderID, false
+	}
+
+	return orderID, true
+}
+
+// refund gives back the given quantities of the order's lines, everything left
+// when there are none, and records it in the order's history along with the
+// payment refund it is owed. It returns the lines it refunded.
+func refund(order *models.Order, lines []models.OrderLine, by string, reason *string, at time.Time) ([]models.OrderLine, error) {
+	refunding, amount, err := orders.PlanRefund(*order, lines)
+	if err != nil {
+		return nil, err
+	}
+	if err = orders.ApplyRefund(order, refunding, amount, by, reason, at); err != nil {
+		return nil, err
+	}
+	if _, err = payments.Plan(order, at); err != nil {
+		return nil, err
+	}
+
+	return refunding, nil
+}
+
+// settled answers a change to an order once settle ran for it. A payment that
+// couldn't be settled is reported along with the order, which was changed all
+// the same and still owes the payment operation.
+func settled(c *gin.Context, order models.Order, err error) {
+	if err != nil {
+		c.IndentedJSON(paymentStatus(err), gin.H{"message": "The order was updated but its payment could not be settled", "error": err.Error(), "order": order})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, order)
+}
+
+// restock puts order lines back in stock. The order records them as restocked
+// before this runs, so a product that can't take them back is only logged.
+func (app *Application) restock(ctx context.Context, lines []models.OrderLine) {
+	for _, line := range lines {
+		if _, err := app.prod_store.AdjustStock(ctx, line.Product_id, line.Sku, line.Quantity); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// UpdateOrderStatus moves an order along its lifecycle and then settles its
+// payment to match. Moves the orders package doesn't allow are refused with a 409. Cancelling
+// puts the items back in stock and refunding gives back whatever is left to refund.
+func (app *Application) UpdateOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderParam(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Status models.OrderStatus `json:"status" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		by := c.GetString("uid")
+		var restocked []models.OrderLine
+		order, err := app.order_store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+			now := time.Now()
+			switch body.Status {
+			case models.OrderCancelled:
+				if err := orders.Cancel(order, by, nil, now); err != nil {
+					return err
+				}
+				restocked = orders.Restock(order, orders.Unrestocked(*order), by, now)
+			case models.OrderRefunded:
+				_, err := refund(order, nil, by, nil, now)
+				return err
+			default:
+				if err := orders.Transition(order, body.Status, now); err != nil {
+					return err
+				}
+			}
+			_, err := payments.Plan(order, now)
+			return err
+		})
+		if err != nil {
+			c.IndentedJSON(orderStatus(err), err.Error())
+			return
+		}
+		app.restock(ctx, restocked)
+
+		order, err = app.settle(ctx, orderID)
+		settled(c, order, err)
+	}
+}
+
+// CancelOrder lets the acting user cancel one of their orders until it is
+// fulfilled, with an optional reason. The payment is released, or refunded when
+// it was already taken, and the items go back in stock.
+func (app *Application) CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderParam(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Reason *string `json:"reason" binding:"omitempty,max=500"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		by := c.GetString("uid")
+		var restocked []models.OrderLine
+		order, err := app.order_store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+			if order.User_id != actingUser(c) {
+				return database.ErrOrderNotFound
+			}
+
+			now := time.Now()
+			if err := orders.Cancel(order, by, body.Reason, now); err != nil {
+				return err
+			}
+			restocked = orders.Restock(order, orders.Unrestocked(*order), by, now)
+			_, err := payments.Plan(order, now)
+			return err
+		})
+		if err != nil {
+			c.IndentedJSON(orderStatus(err), err.Error())
+			return
+		}
+		app.restock(ctx, restocked)
+
+		order, err = app.settle(ctx, orderID)
+		settled(c, order, err)
+	}
+}
+
+// RefundOrder gives back some of the quantities of an order's lines, or all of
+// what is left without lines. Each line is worth its share of the discounted
+// total. With restock the refunded items go back in stock, e.g. when they were
+// returned. Refunding the last of every line moves the order to refunded.
+func (app *Application) RefundOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderParam(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Lines   []models.OrderLine `json:"lines"`
+			Restock bool               `json:"restock"`
+			Reason  *string            `json:"reason" binding:"omitempty,max=500"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		by := c.GetString("uid")
+		var restocked []models.OrderLine
+		order, err := app.order_store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+			now := time.Now()
+			refunded, err := refund(order, body.Lines, by, body.Reason, now)
+			if err != nil {
+				return err
+			}
+			if body.Restock {
+				restocked = orders.Restock(order, refunded, by, now)
+			}
+			return nil
+		})
+		if err != nil {
+			c.IndentedJSON(orderStatus(err), err.Error())
+			return
+		}
+		app.restock(ctx, restocked)
+
+		order, err = app.settle(ctx, orderID)
+		settled(c, order, err)
+	}
+}
+
+// SettleOrder runs the payment operations an order still owes, like a refund
+// whose provider call failed in a way that left open whether the money moved.
+// They run again with the same idempotency key, so nothing moves twice.
+func (app *Application) SettleOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderParam(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		order, err := app.settle(ctx, orderID)
+		if errors.Is(err, database.ErrOrderNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		settled(c, order, err)
+	}
+}
+
+// ListOrders returns the acting user's orders, latest first. They can be narrowed
+// down with status (one or more, comma separated) and with from and to, which
+// take a date or an RFC 3339 time. from is inclusive and to is up to the end of
+// a date or exactly the time.
+func (app *Application) ListOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := orders.Query{User_id: actingUser(c)}
+		var err error
+		for _, status := range strings.Split(c.Query("status"), ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				query.Statuses = append(query.Statuses, models.OrderStatus(strings.ToLower(status)))
+			}
+		}
+		if query.From, err = queryTime(c, "from", false); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if query.To, err = queryTime(c, "to", true); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		limit, err := optionalInt(c, "limit", 1, orders.MaxLimit)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, orders.ErrInvalidQuery.Error())
+			return
+		}
+		if limit != nil {
+			query.Limit = int(*limit)
+		}
+		if cursor := c.Query("cursor"); cursor != "" {
+			if query.After, err = orders.DecodeCursor(cursor); err != nil {
+				c.IndentedJSON(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		page, err := app.order_store.ListOrders(ctx, query)
+		switch {
+		case errors.Is(err, orders.ErrInvalidQuery), errors.Is(err, orders.ErrUnknownStatus):
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, page)
+	}
+}
+
+// queryTime reads a date or RFC 3339 time option. A date that ends a range
+// stands for the end of that day.
+func queryTime(c *gin.Context, key string, end bool) (*time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &at, nil
+	}
+	day, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, orders.ErrInvalidQuery
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return &day, nil
+}
+
+// GetOrder returns one of the acting user's orders. Other users' orders are
+// reported as not found, the same as orders that don't exist.
+func (app *Application) GetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderParam(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		order, err := app.order_store.FindOrder(ctx, orderID)
+		if err == nil && order.User_id != actingUser(c) {
+			err = database.ErrOrderNotFound
+		}
+		if errors.Is(err, database.ErrOrderNotFound) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, order)
+	}
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-com/database"
+	"go-com/models"
+	"go-com/payments"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkout takes payment for the previewed order with the provider the customer
+// picked in the "payment" query parameter, cash on delivery when there is none.
+// The amount is authorized before place writes the order and released again when
+// that fails. Providers other than cash on delivery are then captured, which
+// marks the order as paid. A capture that fails leaves the order placed but
+// pending, checkout returns it along with the error.
+func (app *Application) checkout(ctx context.Context, c *gin.Context, preview models.Order, place func(models.Payment) (models.Order, error)) (models.Order, error) {
+	method := c.DefaultQuery("payment", payments.CashOnDeliveryName)
+	provider, err := app.payment_providers.Get(method)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	payment, err := payments.Authorize(ctx, provider, preview.Price, c.Query("card_token"), time.Now())
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, err
+	}
+
+	order, err := place(payment)
+	if err != nil {
+		if voidErr := payments.Void(ctx, provider, &payment, time.Now()); voidErr != nil {
+			log.Println(voidErr)
+		}
+		return models.Order{}, err
+	}
+
+	if payment.COD {
+		return order, nil
+	}
+
+	return app.settle(ctx, order.Order_id)
+}
+
+// placed answers a checkout. An order that was placed but whose payment didn't
+// go through is returned with the error, so it isn't taken for a completed purchase.
+func placed(c *gin.Context, order models.Order, err error) {
+	if err != nil && order.Order_id.IsZero() {
+		c.IndentedJSON(checkoutStatus(err), err.Error())
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(paymentStatus(err), gin.H{"message": "The order was placed but the payment could not be taken", "error": err.Error(), "order": order})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Successfully placed the order", "order": order})
+}
+
+func paymentStatus(err error) int {
+	switch {
+	case errors.Is(err, payments.ErrPaymentDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, payments.ErrInvalidOperation), errors.Is(err, payments.ErrAmountTooLarge), errors.Is(err, database.ErrOrderChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// settleAttempts bounds how often settle goes around when other requests keep
+// changing the order
+const settleAttempts = 5
+
+// settle moves the money the order's payment still owes at its provider, see
+// payments.Due, until there is nothing left. Every operation is first written
+// to the order as pending, by the update that changed the order or by settle
+// itself, and the provider is only called after that write went through, never
+// while the order is being updated. The outcome is recorded in an update of its own. An operation whose
+// outcome isn't known stays pending and the next settle runs it again with the
+// same idempotency key.
+func (app *Application) settle(ctx context.Context, orderID primitive.ObjectID) (models.Order, error) {
+	var order models.Order
+	for attempt := 0; attempt < settleAttempts; attempt++ {
+		var err error
+		if order, err = app.order_store.FindOrder(ctx, orderID); err != nil {
+			return order, err
+		}
+
+		if order.Payment_method.Pending == nil {
+			planned := false
+			order, err = app.order_store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+				var err error
+				planned, err = payments.Plan(order, time.Now())
+				return err
+			})
+			if errors.Is(err, database.ErrOrderChanged) {
+				continue
+			}
+			if err != nil || !planned {
+				return order, err
+			}
+		}
+
+		op := *order.Payment_method.Pending
+		provider, err := app.payment_providers.Get(order.Payment_method.Provider)
+		if err != nil {
+			return order, err
+		}
+		failed := payments.Execute(ctx, provider, order.Payment_method, op)
+		if failed != nil && !payments.Refused(failed) {
+			log.Println(failed)
+			return order, failed
+		}
+
+		if order, err = app.recordPayment(ctx, orderID, op, failed); err != nil {
+			return order, err
+		}
+		if failed != nil {
+			return order, failed
+		}
+	}
+
+	return order, database.ErrOrderChanged
+}
+
+// recordPayment writes the outcome of the operation to the order, trying again
+// while other requests change the order in between. Another settle may have
+// recorded it already, which leaves the order as it is.
+func (app *Application) recordPayment(ctx context.Context, orderID primitive.ObjectID, op models.PaymentOperation, failed error) (models.Order, error) {
+	for attempt := 0; attempt < settleAttempts; attempt++ {
+		order, err := app.order_store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+			if pending := order.Payment_method.Pending; pending == nil || pending.Key != op.Key {
+				return nil
+			}
+			return payments.Record(order, failed, time.Now())
+		})
+		if errors.Is(err, database.ErrOrderChanged) {
+			continue
+		}
+		return order, err
+	}
+
+	return models.Order{}, database.ErrOrderChanged
+}
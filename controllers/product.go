@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-com/catalog"
+	"go-com/database"
+	"go-com/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateStock lets admins either set the stock of a product outright with
+// {"stock": n} or move it up and down with {"adjust": n}. The stock of products
+// with variants is kept per variant, named by {"sku": "..."}.
+func (app *Application) UpdateStock() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			log.Println(err)
+			c.IndentedJSON(http.StatusBadRequest, "Product ID is not valid")
+			return
+		}
+
+		var body struct {
+			Sku    string `json:"sku"`
+			Stock  *int   `json:"stock"`
+			Adjust *int   `json:"adjust"`
+		}
+		if err = c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if (body.Stock == nil) == (body.Adjust == nil) {
+			c.IndentedJSON(http.StatusBadRequest, "Provide either stock or adjust")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var product models.Product
+		if body.Stock != nil {
+			product, err = app.prod_store.SetStock(ctx, productID, body.Sku, *body.Stock)
+		} else {
+			product, err = app.prod_store.AdjustStock(ctx, productID, body.Sku, *body.Adjust)
+		}
+
+		switch {
+		case errors.Is(err, database.ErrCantFindProduct):
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		case errors.Is(err, database.ErrInvalidStock), errors.Is(err, catalog.ErrVariantRequired), errors.Is(err, catalog.ErrVariantNotFound):
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, database.ErrProductChanged):
+			c.IndentedJSON(http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, product)
+	}
+}
+
+// validateProduct checks a product the way an admin sent it, after the price
+// and stock of a product with variants were rolled up from its variants
+func validateProduct(product models.Product) error {
+	if err := validate.Struct(product); err != nil {
+		return err
+	}
+	if err := catalog.CheckVariants(product); err != nil {
+		return err
+	}
+	if err := product.Price.Validate(); err != nil {
+		return err
+	}
+	if product.Stock < 0 {
+		return database.ErrInvalidStock
+	}
+
+	return nil
+}
+
+// productStatus picks the response code for an error from a product update
+func productStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindProduct):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrProductChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// bindCategories responds with an error when a category the product is put in doesn't exist
+func (app *Application) bindCategories(c *gin.Context, categoryIDs []primitive.ObjectID) bool {
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := app.checkCategories(ctx, categoryIDs)
+	if errors.Is(err, database.ErrCategoryNotFound) {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// updateProduct runs mutate on the product named in the path and responds with the result
+func (app *Application) updateProduct(c *gin.Context, mutate func(*models.Product) error) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusBadRequest, "Product ID is not valid")
+		return
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	product, err := app.prod_store.UpdateProduct(ctx, productID, mutate)
+	if err != nil {
+		c.IndentedJSON(productStatus(err), err.Error())
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, product)
+}
+
+// UpdateProduct replaces everything admins edit about a product. Stock is
+// changed through UpdateStock and archiving through ArchiveProduct, so variants
+// keep the stock they had and new variants start without any.
+func (app *Application) UpdateProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body models.Product
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if !app.bindCategories(c, body.Categories) {
+			return
+		}
+
+		app.updateProduct(c, func(product *models.Product) error {
+			product.Product_name = body.Product_name
+			product.Price = body.Price
+			product.Rating = body.Rating
+			product.Image = body.Image
+			product.Description = body.Description
+			product.Categories = body.Categories
+			product.Tax_class = body.Tax_class
+			product.Attributes = body.Attributes
+			product.Variants = body.Variants
+			catalog.RollUp(product)
+			return validateProduct(*product)
+		})
+	}
+}
+
+// PatchProduct changes only the fields that were sent
+func (app *Application) PatchProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Product_name *string                    `json:"product_name"`
+			Price        *models.Money              `json:"price"`
+			Rating       *uint8                     `json:"rating"`
+			Image        *string                    `json:"image"`
+			Description  *string                    `json:"description"`
+			Categories   *[]primitive.ObjectID      `json:"categories"`
+			Tax_class    *string                    `json:"tax_class"`
+			Attributes   *[]models.ProductAttribute `json:"attributes"`
+			Variants     *[]models.Variant          `json:"variants"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if body.Categories != nil && !app.bindCategories(c, *body.Categories) {
+			return
+		}
+
+		app.updateProduct(c, func(product *models.Product) error {
+			if body.Product_name != nil {
+				product.Product_name = body.Product_name
+			}
+			if body.Price != nil {
+				product.Price = *body.Price
+			}
+			if body.Rating != nil {
+				product.Rating = body.Rating
+			}
+			if body.Image != nil {
+				product.Image = body.Image
+			}
+			if body.Description != nil {
+				product.Description = body.Description
+			}
+			if body.Categories != nil {
+				product.Categories = *body.Categories
+			}
+			if body.Tax_class != nil {
+				product.Tax_class = *body.Tax_class
+			}
+			if body.Attributes != nil {
+				product.Attributes = *body.Attributes
+			}
+			if body.Variants != nil {
+				product.Variants = *body.Variants
+			}
+			catalog.RollUp(product)
+			return validateProduct(*product)
+		})
+	}
+}
+
+// ArchiveProduct stops selling a product. It disappears from the catalogue and
+// can't be added to carts, but orders that hold it keep showing it.
+func (app *Application) ArchiveProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.updateProduct(c, func(product *models.Product) error {
+			if !product.Archived {
+				now := time.Now()
+				product.Archived = true
+				product.Archived_at = &now
+			}
+			return nil
+		})
+	}
+}
+
+func (app *Application) UnarchiveProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.updateProduct(c, func(product *models.Product) error {
+			product.Archived = false
+			product.Archived_at = nil
+			return nil
+		})
+	}
+}
+
+// DeleteProduct removes a product for good. Archiving is usually what you want.
+func (app *Application) DeleteProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			log.Println(err)
+			c.IndentedJSON(http.StatusBadRequest, "Product ID is not valid")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err = app.prod_store.DeleteProduct(ctx, productID)
+		if errors.Is(err, database.ErrCantFindProduct) {
+			c.IndentedJSON(http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully deleted the product")
+	}
+}
+
+// productQuery reads the listing options shared by the product listing and search:
+// sort (newest, price, rating, name), order (asc, desc), min_price and max_price in
+// the minor unit of currency, min_rating, limit and the cursor of the previous page
+func productQuery(c *gin.Context) (catalog.Query, error) {
+	var query catalog.Query
+	var err error
+	if query.Sort, query.Descending, err = catalog.ParseSort(c.Query("sort"), c.Query("order")); err != nil {
+		return query, err
+	}
+
+	query.Currency = c.Query("currency")
+	if query.Min_price, err = optionalInt(c, "min_price", 0, 1<<62); err != nil {
+		return query, err
+	}
+	if query.Max_price, err = optionalInt(c, "max_price", 0, 1<<62); err != nil {
+		return query, err
+	}
+
+	rating, err := optionalInt(c, "min_rating", 0, 5)
+	if err != nil {
+		return query, err
+	}
+	if rating != nil {
+		minRating := uint8(*rating)
+		query.Min_rating = &minRating
+	}
+
+	limit, err := optionalInt(c, "limit", 1, catalog.MaxLimit)
+	if err != nil {
+		return query, err
+	}
+	if limit != nil {
+		query.Limit = int(*limit)
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if query.After, err = catalog.DecodeCursor(cursor); err != nil {
+			return query, err
+		}
+	}
+
+	// The store fills in the defaults and checks the options fit together
+	return query, nil
+}
+
+// optionalInt reads a whole number query option that has to be within min and max
+func optionalInt(c *gin.Context, key string, min, max int64) (*int64, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < min || value > max {
+		return nil, catalog.ErrInvalidQuery
+	}
+
+	return &value, nil
+}
+
+// listingStatus picks the response code for an error from a product listing
+func listingStatus(err error) int {
+	if errors.Is(err, catalog.ErrInvalidQuery) || errors.Is(err, catalog.ErrInvalidCursor) || errors.Is(err, catalog.ErrInvalidSearch) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, database.ErrCategoryNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
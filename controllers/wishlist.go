@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func wishlistStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrItemNotInWishlist), errors.Is(err, database.ErrItemNotInCart),
+		errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrCantFindProduct):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrUserIDIsNotValid), errors.Is(err, database.ErrInvalidQuantity),
+		errors.Is(err, catalog.ErrVariantRequired), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrNotEnoughStock), errors.Is(err, database.ErrProductArchived):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// itemParams reads which product, and which variant of it for products with
+// variants, a request is about from the "id" and "sku" query parameters
+func itemParams(c *gin.Context) (primitive.ObjectID, string, bool) {
+	productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, "Product ID is not valid")
+		return productID, "", false
+	}
+
+	return productID, c.Query("sku"), true
+}
+
+// ListWishlist returns the acting user's wishlist, oldest first, priced at what
+// its products cost now
+func (app *Application) ListWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		items, err := app.wishlist_store.GetWishlist(ctx, actingUser(c))
+		if err != nil {
+			c.IndentedJSON(wishlistStatus(err), err.Error())
+			return
+		}
+
+		productIDs := make([]primitive.ObjectID, 0, len(items))
+		for _, item := range items {
+			productIDs = append(productIDs, item.Product_id)
+		}
+		products, err := app.prod_store.FindProducts(ctx, productIDs)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, carts.PriceWishlist(items, products))
+	}
+}
+
+func (app *Application) AddToWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, sku, ok := itemParams(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.wishlist_store.AddToWishlist(ctx, productID, sku, actingUser(c)); err != nil {
+			c.IndentedJSON(wishlistStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully added to the wishlist")
+	}
+}
+
+func (app *Application) RemoveFromWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, sku, ok := itemParams(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.wishlist_store.RemoveFromWishlist(ctx, productID, sku, actingUser(c)); err != nil {
+			c.IndentedJSON(wishlistStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully removed from the wishlist")
+	}
+}
+
+// MoveToCart moves an item from the wishlist to the cart, a single one unless
+// the "quantity" query parameter asks for more
+func (app *Application) MoveToCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, sku, ok := itemParams(c)
+		if !ok {
+			return
+		}
+
+		quantity := 1
+		if quantityQuery := c.Query("quantity"); quantityQuery != "" {
+			var err error
+			if quantity, err = strconv.Atoi(quantityQuery); err != nil || quantity < 1 {
+				c.IndentedJSON(http.StatusBadRequest, database.ErrInvalidQuantity.Error())
+				return
+			}
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.wishlist_store.MoveToCart(ctx, productID, sku, actingUser(c), quantity); err != nil {
+			c.IndentedJSON(wishlistStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully moved to the cart")
+	}
+}
+
+// SaveForLater moves a line of the cart to the wishlist
+func (app *Application) SaveForLater() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, sku, ok := itemParams(c)
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.wishlist_store.SaveForLater(ctx, productID, sku, actingUser(c)); err != nil {
+			c.IndentedJSON(wishlistStatus(err), err.Error())
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, "Successfully saved for later")
+	}
+}
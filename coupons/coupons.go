@@ -0,0 +1,108 @@
+package coupons
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-com/models"
+)
+
+var (
+	ErrCouponInactive     = errors.New("Coupon is not active")
+	ErrCouponExpired      = errors.New("Coupon has expired")
+	ErrCouponUsedUp       = errors.New("Coupon has reached its usage limit")
+	ErrCouponUserLimit    = errors.New("Coupon was already used the maximum number of times")
+	ErrBelowMinimum       = errors.New("Cart value is below the coupon minimum")
+	ErrInvalidCouponRules = errors.New("Coupon rules are not valid")
+)
+
+// NormalizeCode makes codes case-insensitive, "summer10" and "SUMMER10" are the same coupon
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CheckRules makes sure an admin-created coupon makes sense on its own,
+// on top of the struct validation tags
+func CheckRules(coupon models.Coupon) error {
+	switch coupon.Type {
+	case models.CouponPercentage:
+		if coupon.Percent < 1 || coupon.Percent > 100 {
+			return fmt.Errorf("%w: percent must be between 1 and 100", ErrInvalidCouponRules)
+		}
+	case models.CouponFixed:
+		if err := coupon.Amount.Validate(); err != nil || coupon.Amount.IsZero() {
+			return fmt.Errorf("%w: amount must be a positive amount with a currency", ErrInvalidCouponRules)
+		}
+	default:
+		return fmt.Errorf("%w: type must be percentage or fixed", ErrInvalidCouponRules)
+	}
+
+	if coupon.Min_cart_value != nil {
+		if err := coupon.Min_cart_value.Validate(); err != nil {
+			return fmt.Errorf("%w: min_cart_value: %v", ErrInvalidCouponRules, err)
+		}
+	}
+
+	return nil
+}
+
+// Usable checks everything about the coupon that doesn't depend on the cart
+func Usable(coupon models.Coupon, userID string, now time.Time) error {
+	if !coupon.Active {
+		return ErrCouponInactive
+	}
+	if coupon.Expires_at != nil && !now.Before(*coupon.Expires_at) {
+		return ErrCouponExpired
+	}
+	if coupon.Max_uses > 0 && coupon.Used_count >= coupon.Max_uses {
+		return ErrCouponUsedUp
+	}
+	if coupon.Max_uses_per_user > 0 && coupon.Used_by[userID] >= coupon.Max_uses_per_user {
+		return ErrCouponUserLimit
+	}
+
+	return nil
+}
+
+// Discount works out how much the coupon takes off the subtotal for this user.
+// The discount is never more than the subtotal.
+func Discount(coupon models.Coupon, subtotal models.Money, userID string, now time.Time) (models.Money, error) {
+	if err := Usable(coupon, userID, now); err != nil {
+		return models.Money{}, err
+	}
+
+	if coupon.Min_cart_value != nil {
+		cmp, err := subtotal.Cmp(*coupon.Min_cart_value)
+		if err != nil {
+			return models.Money{}, err
+		}
+		if cmp < 0 {
+			return models.Money{}, ErrBelowMinimum
+		}
+	}
+
+	var discount models.Money
+	switch coupon.Type {
+	case models.CouponPercentage:
+		var err error
+		if discount, err = subtotal.MulRatio(coupon.Percent, 100); err != nil {
+			return models.Money{}, err
+		}
+	case models.CouponFixed:
+		discount = coupon.Amount
+	default:
+		return models.Money{}, ErrInvalidCouponRules
+	}
+
+	cmp, err := discount.Cmp(subtotal)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if cmp > 0 {
+		discount = subtotal
+	}
+
+	return discount, nil
+}
@@ -0,0 +1,115 @@
+package coupons
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+func TestUsable(t *testing.T) {
+	later, earlier := at.Add(time.Hour), at.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		err    error
+	}{
+		{"active", models.Coupon{Active: true}, nil},
+		{"inactive", models.Coupon{}, ErrCouponInactive},
+		{"expires later", models.Coupon{Active: true, Expires_at: &later}, nil},
+		{"expired", models.Coupon{Active: true, Expires_at: &earlier}, ErrCouponExpired},
+		{"expires right now", models.Coupon{Active: true, Expires_at: &at}, ErrCouponExpired},
+		{"uses left", models.Coupon{Active: true, Max_uses: 2, Used_count: 1}, nil},
+		{"used up", models.Coupon{Active: true, Max_uses: 2, Used_count: 2}, ErrCouponUsedUp},
+		{"used by someone else", models.Coupon{Active: true, Max_uses_per_user: 1, Used_by: map[string]int{"other": 1}}, nil},
+		{"used by this user", models.Coupon{Active: true, Max_uses_per_user: 1, Used_by: map[string]int{"user": 1}}, ErrCouponUserLimit},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Usable(test.coupon, "user", at); !errors.Is(err, test.err) {
+				t.Errorf("Usable() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	minimum := usd(5000)
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		subtotal models.Money
+		want     models.Money
+		err      error
+	}{
+		{"percentage", models.Coupon{Type: models.CouponPercentage, Percent: 15, Active: true}, usd(4999), usd(750), nil},
+		{"whole subtotal", models.Coupon{Type: models.CouponPercentage, Percent: 100, Active: true}, usd(4999), usd(4999), nil},
+		{"fixed", models.Coupon{Type: models.CouponFixed, Amount: usd(1000), Active: true}, usd(4999), usd(1000), nil},
+		{"fixed over the subtotal", models.Coupon{Type: models.CouponFixed, Amount: usd(1000), Active: true}, usd(800), usd(800), nil},
+		{"at the minimum", models.Coupon{Type: models.CouponFixed, Amount: usd(1000), Active: true, Min_cart_value: &minimum}, usd(5000), usd(1000), nil},
+		{"below the minimum", models.Coupon{Type: models.CouponFixed, Amount: usd(1000), Active: true, Min_cart_value: &minimum}, usd(4999), models.Money{}, ErrBelowMinimum},
+		{"fixed in another currency", models.Coupon{Type: models.CouponFixed, Amount: models.NewMoney(1000, "EUR"), Active: true}, usd(4999), models.Money{}, models.ErrCurrencyMismatch},
+		{"minimum in another currency", models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Min_cart_value: &models.Money{Amount: 100, Currency: "EUR"}}, usd(4999), models.Money{}, models.ErrCurrencyMismatch},
+		{"not usable", models.Coupon{Type: models.CouponPercentage, Percent: 10}, usd(4999), models.Money{}, ErrCouponInactive},
+		{"unknown type", models.Coupon{Type: "bogo", Active: true}, usd(4999), models.Money{}, ErrInvalidCouponRules},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discount, err := Discount(test.coupon, test.subtotal, "user", at)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Discount() error = %v, want %v", err, test.err)
+			}
+			if discount != test.want {
+				t.Errorf("Discount() = %v, want %v", discount, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	negative := usd(-1)
+
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		valid  bool
+	}{
+		{"percentage", models.Coupon{Type: models.CouponPercentage, Percent: 10}, true},
+		{"percentage of nothing", models.Coupon{Type: models.CouponPercentage}, false},
+		{"percentage over 100", models.Coupon{Type: models.CouponPercentage, Percent: 101}, false},
+		{"fixed", models.Coupon{Type: models.CouponFixed, Amount: usd(500)}, true},
+		{"fixed of nothing", models.Coupon{Type: models.CouponFixed, Amount: usd(0)}, false},
+		{"fixed without a currency", models.Coupon{Type: models.CouponFixed, Amount: models.Money{Amount: 500}}, false},
+		{"negative minimum", models.Coupon{Type: models.CouponPercentage, Percent: 10, Min_cart_value: &negative}, false},
+		{"unknown type", models.Coupon{Type: "bogo", Percent: 10}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckRules(test.coupon)
+			if test.valid && err != nil {
+				t.Errorf("CheckRules() error = %v, want none", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidCouponRules) {
+				t.Errorf("CheckRules() error = %v, want %v", err, ErrInvalidCouponRules)
+			}
+		})
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	if code := NormalizeCode("  summer10 "); code != "SUMMER10" {
+		t.Errorf("NormalizeCode() = %q, want SUMMER10", code)
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AbandonedCarts returns up to limit users whose cart holds something and
+// hasn't changed since idleSince, longest idle first. Carts that were already
+// reminded of since they last changed are left out.
+func (store *MongoStore) AbandonedCarts(ctx context.Context, idleSince time.Time, limit int) ([]models.User, error) {
+	filter := bson.M{
+		"usercart.0":      bson.M{"$exists": true},
+		"cart_updated_at": bson.M{"$lt": idleSince},
+		"$or": bson.A{
+			bson.M{"cart_reminded_at": nil},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$cart_reminded_at", "$cart_updated_at"}}},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "cart_updated_at", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := store.user_collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserNotFound
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]models.User, 0)
+	if err = cursor.All(ctx, &users); err != nil {
+		log.Println(err)
+		return nil, ErrUserNotFound
+	}
+
+	return users, nil
+}
+
+// MarkCartReminded records that the user was reminded of their cart
+func (store *MongoStore) MarkCartReminded(ctx context.Context, userID string, at time.Time) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "cart_reminded_at", Value: at}}}}
+	result, err := store.user_collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// PurgeGuestCarts deletes the guest carts that last changed before the given
+// time and returns how many there were
+func (store *MongoStore) PurgeGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := store.guest_collection.DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": before}})
+	if err != nil {
+		log.Println(err)
+		return 0, ErrCantUpdateGuestCart
+	}
+
+	return result.DeletedCount, nil
+}
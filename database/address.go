@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrAddressNotFound = errors.New("Address not found")
+
+// addressIndex returns the index of the address in the address book or -1
+func addressIndex(book []models.Address, addressID primitive.ObjectID) int {
+	for i, address := range book {
+		if address.Address_id == addressID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// settleDefaults takes the default flags the address at index has off every
+// other address. When no address is left as the default for something, the
+// first one is, so a book that isn't empty always has one of each.
+func settleDefaults(book []models.Address, index int) {
+	shipping, billing := false, false
+	for i := range book {
+		if i != index && book[index].Default_shipping {
+			book[i].Default_shipping = false
+		}
+		if i != index && book[index].Default_billing {
+			book[i].Default_billing = false
+		}
+		shipping = shipping || book[i].Default_shipping
+		billing = billing || book[i].Default_billing
+	}
+
+	if len(book) > 0 {
+		book[0].Default_shipping = book[0].Default_shipping || !shipping
+		book[0].Default_billing = book[0].Default_billing || !billing
+	}
+}
+
+func addAddress(book []models.Address, address models.Address) []models.Address {
+	book = append(book, address)
+	settleDefaults(book, len(book)-1)
+	return book
+}
+
+// replaceAddress swaps the address with the same ID for the new one
+func replaceAddress(book []models.Address, address models.Address) ([]models.Address, error) {
+	index := addressIndex(book, address.Address_id)
+	if index < 0 {
+		return book, ErrAddressNotFound
+	}
+
+	book[index] = address
+	settleDefaults(book, index)
+	return book, nil
+}
+
+// removeAddress takes the address out of the book. Whatever it was the default
+// for passes to the first address left.
+func removeAddress(book []models.Address, addressID primitive.ObjectID) ([]models.Address, error) {
+	index := addressIndex(book, addressID)
+	if index < 0 {
+		return book, ErrAddressNotFound
+	}
+
+	removed := book[index]
+	book = append(book[:index:index], book[index+1:]...)
+	if len(book) > 0 {
+		book[0].Default_shipping = book[0].Default_shipping || removed.Default_shipping
+		book[0].Default_billing = book[0].Default_billing || removed.Default_billing
+	}
+
+	return book, nil
+}
+
+// updateAddresses reads the address book, lets change edit it and writes it
+// back. The write only goes through while the user is still the way it was
+// read, and is tried again from the start a few times when it wasn't.
+func (store *MongoStore) updateAddresses(ctx context.Context, userID string, change func([]models.Address) ([]models.Address, error)) ([]models.Address, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIDIsNotValid
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		user, err := store.FindUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		book, err := change(append([]models.Address{}, user.Address_Details...))
+		if err != nil {
+			return nil, err
+		}
+
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "updated_at", Value: user.Updated_at}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "address", Value: book}, {Key: "updated_at", Value: time.Now()}}}}
+		result, err := store.user_collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantUpdateAddress
+		}
+		if result.MatchedCount > 0 {
+			return book, nil
+		}
+	}
+
+	return nil, ErrCantUpdateAddress
+}
+
+// AddAddress puts a new address in the address book and returns it as it was
+// stored, with its default flags settled
+func (store *MongoStore) AddAddress(ctx context.Context, userID string, address models.Address) (models.Address, error) {
+	book, err := store.updateAddresses(ctx, userID, func(book []models.Address) ([]models.Address, error) {
+		return addAddress(book, address), nil
+	})
+	if err != nil {
+		return address, err
+	}
+
+	return book[addressIndex(book, address.Address_id)], nil
+}
+
+func (store *MongoStore) ListAddresses(ctx context.Context, userID string) ([]models.Address, error) {
+	user, err := store.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Address_Details, nil
+}
+
+func (store *MongoStore) FindAddress(ctx context.Context, userID string, addressID primitive.ObjectID) (models.Address, error) {
+	book, err := store.ListAddresses(ctx, userID)
+	if err != nil {
+		return models.Address{}, err
+	}
+
+	index := addressIndex(book, addressID)
+	if index < 0 {
+		return models.Address{}, ErrAddressNotFound
+	}
+
+	return book[index], nil
+}
+
+// UpdateAddress replaces the address with the same Address_id
+func (store *MongoStore) UpdateAddress(ctx context.Context, userID string, address models.Address) (models.Address, error) {
+	book, err := store.updateAddresses(ctx, userID, func(book []models.Address) ([]models.Address, error) {
+		return replaceAddress(book, address)
+	})
+	if err != nil {
+		return address, err
+	}
+
+	return book[addressIndex(book, address.Address_id)], nil
+}
+
+func (store *MongoStore) DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error {
+	_, err := store.updateAddresses(ctx, userID, func(book []models.Address) ([]models.Address, error) {
+		return removeAddress(book, addressID)
+	})
+
+	return err
+}
+
+// DeleteAddresses empties the address book
+func (store *MongoStore) DeleteAddresses(ctx context.Context, userID string) error {
+	_, err := store.updateAddresses(ctx, userID, func([]models.Address) ([]models.Address, error) {
+		return make([]models.Address, 0), nil
+	})
+
+	return err
+}
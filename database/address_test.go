@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaults returns the labels of the default shipping and billing addresses,
+// failing the test unless there is exactly one of each
+func defaults(t *testing.T, book []models.Address) (shipping, billing string) {
+	t.Helper()
+	var shippingCount, billingCount int
+	for _, address := range book {
+		if address.Default_shipping {
+			shippingCount++
+			shipping = *address.Label
+		}
+		if address.Default_billing {
+			billingCount++
+			billing = *address.Label
+		}
+	}
+	if len(book) > 0 && (shippingCount != 1 || billingCount != 1) {
+		t.Fatalf("address book has %d default shipping and %d default billing addresses, want one of each", shippingCount, billingCount)
+	}
+
+	return shipping, billing
+}
+
+func TestAddressBookDefaults(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(pricing.Default())
+	id := primitive.NewObjectID()
+	if err := store.InsertUser(ctx, models.User{ID: id, User_id: id.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]primitive.ObjectID)
+	address := func(label string, shipping, billing bool) models.Address {
+		if _, ok := ids[label]; !ok {
+			ids[label] = primitive.NewObjectID()
+		}
+		return models.Address{Address_id: ids[label], Label: &label, Default_shipping: shipping, Default_billing: billing}
+	}
+
+	steps := []struct {
+		name     string
+		do       func() error
+		shipping string
+		billing  string
+	}{
+		{"first address", func() error {
+			_, err := store.AddAddress(ctx, id.Hex(), address("home", false, false))
+			return err
+		}, "home", "home"},
+		{"second address", func() error {
+			_, err := store.AddAddress(ctx, id.Hex(), address("work", false, false))
+			return err
+		}, "home", "home"},
+		{"new default shipping", func() error {
+			_, err := store.AddAddress(ctx, id.Hex(), address("office", true, false))
+			return err
+		}, "office", "home"},
+		{"update to default billing", func() error {
+			_, err := store.UpdateAddress(ctx, id.Hex(), address("work", false, true))
+			return err
+		}, "office", "work"},
+		{"update takes a default away", func() error {
+			_, err := store.UpdateAddress(ctx, id.Hex(), address("office", false, false))
+			return err
+		}, "home", "work"},
+		{"remove the default billing", func() error {
+			return store.DeleteAddress(ctx, id.Hex(), ids["work"])
+		}, "home", "home"},
+		{"remove the first address", func() error {
+			return store.DeleteAddress(ctx, id.Hex(), ids["home"])
+		}, "office", "office"},
+		{"remove an unknown address", func() error {
+			if err := store.DeleteAddress(ctx, id.Hex(), primitive.NewObjectID()); !errors.Is(err, ErrAddressNotFound) {
+				t.Errorf("DeleteAddress() of an unknown address error = %v, want %v", err, ErrAddressNotFound)
+			}
+			return nil
+		}, "office", "office"},
+		{"remove the last address", func() error {
+			return store.DeleteAddress(ctx, id.Hex(), ids["office"])
+		}, "", ""},
+	}
+
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+
+		book, err := store.ListAddresses(ctx, id.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		shipping, billing := defaults(t, book)
+		if shipping != step.shipping || billing != step.billing {
+			t.Errorf("%s: defaults are %q for shipping and %q for billing, want %q and %q", step.name, shipping, billing, step.shipping, step.billing)
+		}
+	}
+}
@@ -6,7 +6,12 @@ import(
 	"log"
 	"time"
 
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/coupons"
 	"go-com/models"
+	"go-com/orders"
+	"go-com/pricing"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,24 +27,28 @@ var (
 	ErrCantRemoveItem = errors.New("Cannot remove item from cart")
 	ErrCantGetItem = errors.New("Cannot get item from cart")
 	ErrCantBuyCartItem = errors.New("Cannot update the purchase")
+	ErrUserNotFound = errors.New("User not found")
+	ErrCantUpdateAddress = errors.New("Cannot update the address")
+	ErrInvalidQuantity = errors.New("Quantity is not valid")
+	ErrItemNotInCart = errors.New("Item is not in the cart")
+	ErrCartIsEmpty = errors.New("Cart is empty")
+	ErrNotEnoughStock = errors.New("Not enough stock for the purchase")
+	ErrPaymentMismatch = errors.New("Order total changed during checkout, please try again")
 )
 
-func AddProductToCart(ctx context.Context, prodCollection, userCollection *mongo.Collection, productID primitive.ObjectID, userID string) error {
+// AddProductToCart puts quantity of the product in the cart. Products that come
+// in variants are added one variant at a time, picked by its SKU.
+func (store *MongoStore) AddProductToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
 	
-	//Returns a Cursor for matching documents. Looking for thr product by its ID
-	searchFromDB, err := prodCollection.Find(ctx, bson.M{"_id": productID})
+	// Looking for the product by its ID
+	product, err := store.FindProduct(ctx, productID)
 	if err!=nil{
-		log.Println(err)
-		return ErrCantFindProduct
+		return err
 	}
 
-	var productCart []models.ProductUser 	
-	
-	//Iterates the cursor and decodes each doc into a result.
-	err = searchFromDB.All(ctx, &productCart)
-	if err!=nil{
-		log.Println(err)
-		return ErrCantDecodeProducts
+	variant, err := catalog.FindVariant(product, sku)
+	if err!=nil {
+		return err
 	}
 
 	id, err := primitive.ObjectIDFromHex(userID)
@@ -47,24 +56,189 @@ func AddProductToCart(ctx context.Context, prodCollection, userCollection *mongo
 		log.Println(err)
 		return ErrUserIDIsNotValid
 	}
-	
-	// When the product is found in the db, decoded successfully into golang, 
-	// and userID is validated, an item can be added to the user's cart
-	// DB needs to be updated, giving it the id of the user and the product written to productCart
 
-	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "usercart", Value: bson.D{{Key: "$each", Value: productCart}}}}}}
+	if quantity < 1 {
+		return ErrInvalidQuantity
+	}
+
+	// The cart may not hold more of a product than there is in stock. Stock is
+	// only taken at checkout, this just stops the obvious cases early.
+	if err = store.checkAvailability(ctx, productID, sku, userID, quantity); err!=nil {
+		return err
+	}
+
+	// When the product is already in the cart only its quantity goes up
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+	update := touchCart(bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "usercart.$.quantity", Value: quantity}}}})
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err!=nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
 
-	_, err = userCollection.UpdateOne(ctx, filter, update)
+	// Otherwise a new line is pushed. The $ne guard stops two concurrent adds
+	// from pushing the same product twice.
+	item := productToCartItem(product, variant)
+	item.Quantity = quantity
+	filter = bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$not": bson.M{"$elemMatch": cartItem(productID, sku)}}}}
+	update = touchCart(bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "usercart", Value: item}}}})
+	result, err = store.user_collection.UpdateOne(ctx, filter, update)
 	if err!=nil {
 		log.Println(err)
 		return ErrCantUpdateUser
 	}
+	if result.MatchedCount == 0 {
+		// Either the user doesn't exist or another add created the line in
+		// between, in which case that line is incremented instead
+		filter = bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+		update = touchCart(bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "usercart.$.quantity", Value: quantity}}}})
+		result, err = store.user_collection.UpdateOne(ctx, filter, update)
+		if err!=nil {
+			log.Println(err)
+			return ErrCantUpdateUser
+		}
+		if result.MatchedCount == 0 {
+			return ErrUserNotFound
+		}
+	}
 
 	return nil
 }
 
-func RemoveCartItem(ctx context.Context, prodCollection, userCollection *mongo.Collection, productID primitive.ObjectID, userID string) error {
+// checkAvailability fails with ErrNotEnoughStock when adding quantity to what
+// the cart already holds would go over the stock of the product or variant
+func (store *MongoStore) checkAvailability(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	product, err := store.FindProduct(ctx, productID)
+	if err!=nil {
+		return err
+	}
+	if product.Archived {
+		return ErrProductArchived
+	}
+
+	user, err := store.FindUserByID(ctx, userID)
+	if err!=nil {
+		return err
+	}
+
+	if line := carts.Find(user.UserCart, productID, sku); line >= 0 {
+		quantity += user.UserCart[line].Quantity
+	}
+
+	return checkStock(product, sku, quantity)
+}
+
+// checkStock fails when the product, or its variant with the given SKU, has
+// less than quantity in stock
+func checkStock(product models.Product, sku string, quantity int) error {
+	variant, err := catalog.FindVariant(product, sku)
+	if err!=nil {
+		return err
+	}
+
+	stock := product.Stock
+	if variant != nil {
+		stock = variant.Stock
+	}
+	if stock < quantity {
+		return ErrNotEnoughStock
+	}
+
+	return nil
+}
+
+// cartItem matches the cart line of the product, or of one variant of it. Lines
+// of products without variants have no sku.
+func cartItem(productID primitive.ObjectID, sku string) bson.M {
+	if sku == "" {
+		return bson.M{"_id": productID, "sku": nil}
+	}
+
+	return bson.M{"_id": productID, "sku": sku}
+}
+
+// touchCart makes an update of the user's cart also record when the cart last
+// changed, which is what abandoned carts are found by
+func touchCart(update bson.D) bson.D {
+	touched := bson.E{Key: "cart_updated_at", Value: time.Now()}
+	for i, operator := range update {
+		if operator.Key == "$set" {
+			update[i].Value = append(operator.Value.(bson.D), touched)
+			return update
+		}
+	}
+
+	return append(update, bson.E{Key: "$set", Value: bson.D{touched}})
+}
+
+// withTaxClasses returns the lines with the tax class their products have now.
+// Lines keep the class their product had when they were added to the cart, and
+// an admin may have changed it since. Lines of products that are gone keep theirs.
+func withTaxClasses(lines []models.ProductUser, products []models.Product) []models.ProductUser {
+	classes := make(map[primitive.ObjectID]string, len(products))
+	for _, product := range products {
+		classes[product.Product_id] = product.Tax_class
+	}
+
+	current := append([]models.ProductUser{}, lines...)
+	for i := range current {
+		if class, ok := classes[current[i].Product_id]; ok {
+			current[i].Tax_class = class
+		}
+	}
+
+	return current
+}
+
+// currentTaxClasses looks up the products of the lines with find, for withTaxClasses
+func currentTaxClasses(ctx context.Context, find func(context.Context, []primitive.ObjectID) ([]models.Product, error), lines []models.ProductUser) ([]models.ProductUser, error) {
+	if len(lines) == 0 {
+		return lines, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(lines))
+	for i, item := range lines {
+		ids[i] = item.Product_id
+	}
+	products, err := find(ctx, ids)
+	if err!=nil {
+		return nil, err
+	}
+
+	return withTaxClasses(lines, products), nil
+}
+
+// productToCartItem makes the cart line for the product, priced and pictured
+// as the variant when there is one
+func productToCartItem(product models.Product, variant *models.Variant) models.ProductUser {
+	item := models.ProductUser{
+		Product_id:   product.Product_id,
+		Product_name: product.Product_name,
+		Price:        product.Price,
+		Image:        product.Image,
+		Tax_class:    product.Tax_class,
+	}
+	if product.Rating != nil {
+		rating := uint64(*product.Rating)
+		item.Rating = &rating
+	}
+
+	if variant != nil {
+		item.Sku = variant.Sku
+		item.Attributes = variant.Attributes
+		item.Price = variant.Price
+		if variant.Image != nil {
+			item.Image = variant.Image
+		}
+	}
+
+	return item
+}
+
+func (store *MongoStore) RemoveCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
 	// Validate the userID
 	id, err := primitive.ObjectIDFromHex(userID)
 	if err!=nil {
@@ -74,8 +248,8 @@ func RemoveCartItem(ctx context.Context, prodCollection, userCollection *mongo.C
 
 	// Removing item from User's cart using the productID
 	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	update := bson.M{"$pull": bson.M{"usercart": bson.M{"_id": productID}}}
-	_, err = userCollection.UpdateMany(ctx, filter, update)
+	update := touchCart(bson.D{{Key: "$pull", Value: bson.M{"usercart": cartItem(productID, sku)}}})
+	_, err = store.user_collection.UpdateMany(ctx, filter, update)
 	if err!=nil {
 		log.Println(err)
 		return ErrCantRemoveItem
@@ -84,137 +258,453 @@ func RemoveCartItem(ctx context.Context, prodCollection, userCollection *mongo.C
 	return nil
 }
 
-func BuyItemFromCart(ctx context.Context, userCollection *mongo.Collection, userID string) error{
-	
-	// The caller of this function passes userID as a hex string which needs to be validated
+// SetCartItemQuantity overwrites the quantity of a cart line, a quantity of zero removes the line
+func (store *MongoStore) SetCartItemQuantity(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return store.RemoveCartItem(ctx, productID, sku, userID)
+	}
+
 	id, err := primitive.ObjectIDFromHex(userID)
 	if err!=nil {
 		log.Println(err)
 		return ErrUserIDIsNotValid
 	}
-	
-	// A User
-	var getCartItems models.User
 
-	// An Order
-	var orderCart models.Order
+	product, err := store.FindProduct(ctx, productID)
+	if err!=nil {
+		return err
+	}
+	if err = checkStock(product, sku, quantity); err!=nil {
+		return err
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+	update := touchCart(bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "usercart.$.quantity", Value: quantity}}}})
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err!=nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrItemNotInCart
+	}
 
-	// For that Order we are creating an ID, time ordered, a slice of ProductUser, and payment method
-	// []ProductUser is the same as []Products.. Why not just use []Product? 
-	orderCart.Order_id = primitive.NewObjectID()
-	orderCart.Ordered_at = time.Now()
-	orderCart.Order_cart = make([]models.ProductUser, 0)
-	orderCart.Payment_method.COD = true 
+	return nil
+}
 
+// DecrementCartItem takes one off the quantity of a cart line and removes the line when it reaches zero
+func (store *MongoStore) DecrementCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err!=nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
 
-	// $usercart is the field representing the slice of Products of a User. 
-	// Seems like they are being retrieved from the DB as individual items using $unwind
-	unwind 	:= bson.D{{Key: "$unwind", Value: bson.D{primitive.E{Key: "path", Value: "$usercart"}} }}
-	grouping:= bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$_id"}, {Key: "total", Value: bson.D{primitive.E{Key: "$sum", Value: "$usercart.price"}}}}}}
+	line := cartItem(productID, sku)
+	line["quantity"] = bson.M{"$gt": 1}
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$elemMatch": line}}}
+	update := touchCart(bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "usercart.$.quantity", Value: -1}}}})
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err!=nil {
+		log.Println(err)
+		return ErrCantRemoveItem
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
 
-	// Aggregation result from DB, probably returning the order price as prices of individual products
-	currentResults, err := userCollection.Aggregate(ctx, mongo.Pipeline{unwind, grouping})
+	// The line had a quantity of one (or is missing), so it goes away entirely
+	filter = bson.D{primitive.E{Key: "_id", Value: id}, {Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+	update = touchCart(bson.D{{Key: "$pull", Value: bson.M{"usercart": cartItem(productID, sku)}}})
+	result, err = store.user_collection.UpdateOne(ctx, filter, update)
+	if err!=nil {
+		log.Println(err)
+		return ErrCantRemoveItem
+	}
+	if result.MatchedCount == 0 {
+		return ErrItemNotInCart
+	}
 
-	// Obtains a channel that gets closed when the ctx is cancelled or timed out
-	ctx.Done()
+	return nil
+}
 
+func (store *MongoStore) GetCart(ctx context.Context, userID string) ([]models.ProductUser, error) {
+	user, err := store.FindUserByID(ctx, userID)
 	if err!=nil {
-		panic(err)
+		return nil, err
 	}
 
-	// Decoding the result into getUserCart by iterating over currentResults
-	// bson.M is handled in Go as: map[string]interface{} 
-	// Hence can be iterated over using for-range loop
-	var getUserCart []bson.M 
-	if err = currentResults.All(ctx, &getUserCart); err!=nil {
-		panic(err)
+	return user.UserCart, nil
+}
+
+func (store *MongoStore) CartTotal(ctx context.Context, userID string) (models.Money, error) {
+	cart, err := store.GetCart(ctx, userID)
+	if err!=nil {
+		return models.Money{}, err
 	}
 
-	// Save the total price of items in the cart 
-	var total_price int32 
-	for _, user_item := range getUserCart {
-		price := user_item["total"]
-		total_price = price.(int32) //Shouldnt it be total_price += price.(int32)
-									// Actually grouping stage in the DB already totaled the price of the items
-	}								// So why do we iterate over a result that already has the total?
+	return pricing.Subtotal(cart)
+}
 
-	// Update the order's total price
-	orderCart.Price = int(total_price)
+// QuoteCart prices the cart with the same engine as the checkout, shipped to
+// the address when it is known
+func (store *MongoStore) QuoteCart(ctx context.Context, userID string, address *models.Address) (models.Quote, error) {
+	user, err := store.FindUserByID(ctx, userID)
+	if err!=nil {
+		return models.Quote{}, err
+	}
+	lines, err := currentTaxClasses(ctx, store.FindProducts, user.UserCart)
+	if err!=nil {
+		return models.Quote{}, err
+	}
 
-	// Update the User's Order in the DB
-	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "orders", Value: orderCart}}}}
-	_, err = userCollection.UpdateMany(ctx, filter, update)
+	coupon, err := store.cartCoupon(ctx, user.Cart_coupon)
+	return quoteCart(store.pricing, userID, lines, coupon, err, address)
+}
+
+// SetCartCoupon remembers the coupon code applied to the cart, nil removes it.
+// The coupon is checked by the caller when applied and again at checkout.
+func (store *MongoStore) SetCartCoupon(ctx context.Context, userID string, code *string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
 	if err!=nil {
 		log.Println(err)
+		return ErrUserIDIsNotValid
 	}
 
-	// Retrieving the items added to the cart from the DB and decoding it into the user's cart
-	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&getCartItems)
+	update := touchCart(bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "cart_coupon", Value: code}}}})
+	result, err := store.user_collection.UpdateOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}, update)
 	if err!=nil {
-		log.Println(err) 
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
 	}
 
-	// Updating the User's []Order with the items in the User's cart
-	filter2 := bson.D{primitive.E{Key: "_id", Value: id}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": bson.M{"$each": getCartItems.UserCart}}}
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+	return nil
+}
+
+// cartOrder reads the user's cart and prices it into an order without writing
+// anything. A coupon on the cart is checked again against the cart as it is now.
+func (store *MongoStore) cartOrder(ctx context.Context, userID string, shipping *models.Address) (models.Order, *models.Coupon, error) {
+	user, err := store.FindUserByID(ctx, userID)
 	if err!=nil {
-		log.Println(err)
+		return models.Order{}, nil, err
 	}
 
-	// Empty the user's cart to complete the purchase
-	usercart_empty := make([]models.ProductUser, 0)
-	filtered := bson.D{primitive.E{Key: "_id", Value: id}}
-	updated := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key:"usercart", Value: usercart_empty}}}}
-	_, err = userCollection.UpdateOne(ctx, filtered, updated)
+	if len(user.UserCart) == 0 {
+		return models.Order{}, nil, ErrCartIsEmpty
+	}
+
+	coupon, err := store.cartCoupon(ctx, user.Cart_coupon)
+	if err!=nil {
+		return models.Order{}, nil, err
+	}
+	lines, err := currentTaxClasses(ctx, store.FindProducts, user.UserCart)
 	if err!=nil {
-		return ErrCantBuyCartItem
+		return models.Order{}, nil, err
 	}
 
-	return nil
+	order, err := newOrder(store.pricing, userID, lines, coupon, shipping)
+	return order, coupon, err
 }
 
-func InstantBuyer(ctx context.Context, prodCollection, userCollection *mongo.Collection, productID primitive.ObjectID, userID string) error {
-	id, err := primitive.ObjectIDFromHex(userID)
+// cartCoupon looks up the coupon applied to a cart, nil when there is none
+func (store *MongoStore) cartCoupon(ctx context.Context, code *string) (*models.Coupon, error) {
+	if code == nil {
+		return nil, nil
+	}
+
+	coupon, err := store.findCoupon(ctx, bson.M{"code": *code})
 	if err!=nil {
-		log.Println(err)
-		return ErrUserIDIsNotValid
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// instantOrder prices a single product, or variant, into an order without writing anything
+func (store *MongoStore) instantOrder(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address) (models.Order, error) {
+	if _, err := store.FindUserByID(ctx, userID); err!=nil {
+		return models.Order{}, err
+	}
+
+	product, err := store.FindProduct(ctx, productID)
+	if err!=nil {
+		return models.Order{}, err
+	}
+	if product.Archived {
+		return models.Order{}, ErrProductArchived
+	}
+
+	variant, err := catalog.FindVariant(product, sku)
+	if err!=nil {
+		return models.Order{}, err
 	}
 
 	// ProductUser is identical to Product aside from datatypes. 
 	// Not sure why they should both exist
-	var product_details models.ProductUser
-	var order_details models.Order 
+	product_details := productToCartItem(product, variant)
+	product_details.Quantity = 1
+	return newOrder(store.pricing, userID, []models.ProductUser{product_details}, nil, shipping)
+}
+
+// PreviewCart prices the cart the way BuyItemFromCart would, so the payment
+// can be authorized for the right amount before checking out
+func (store *MongoStore) PreviewCart(ctx context.Context, userID string, shipping *models.Address) (models.Order, error) {
+	order, _, err := store.cartOrder(ctx, userID, shipping)
+	if err!=nil {
+		return models.Order{}, checkoutError(err)
+	}
 
-	order_details.Order_id = primitive.NewObjectID()
-	order_details.Ordered_at = time.Now()
-	order_details.Order_cart = make([]models.ProductUser, 0)
-	order_details.Payment_method.COD = true 
+	return order, nil
+}
 
-	// Retrieving the product from the DB and saving it to product_details
-	err = prodCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).Decode(&product_details)
+func (store *MongoStore) PreviewInstantBuy(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address) (models.Order, error) {
+	order, err := store.instantOrder(ctx, productID, sku, userID, shipping)
 	if err!=nil {
-		log.Println(err)
+		return models.Order{}, checkoutError(err)
 	}
 
-	order_details.Price = product_details.Price
+	return order, nil
+}
+
+// BuyItemFromCart turns the user's cart into an order paid for by the given,
+// already authorized, payment. Reading the cart, taking the stock, using the
+// coupon, inserting the order and emptying the cart happen in one transaction,
+// so either the order holds exactly what was in the cart and the cart is empty,
+// or nothing changed at all. Transactions need MongoDB to run as a replica set.
+func (store *MongoStore) BuyItemFromCart(ctx context.Context, userID string, shipping *models.Address, payment models.Payment) (models.Order, error) {
+	
+	// The caller of this function passes userID as a hex string which needs to be validated
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err!=nil {
+		log.Println(err)
+		return models.Order{}, ErrUserIDIsNotValid
+	}
 
-	// Updating the User's Orders with order_details
-	filter := bson.D{primitive.E{Key:"_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "orders", Value: order_details}}}}
-	_, err = userCollection.UpdateOne(ctx, filter ,update)
+	session, err := store.client.StartSession()
 	if err!=nil {
 		log.Println(err)
+		return models.Order{}, ErrCantBuyCartItem
 	}
+	defer session.EndSession(ctx)
+
+	// WithTransaction retries the whole callback when another request wrote to the
+	// same user in between, so the order always matches the cart it emptied
+	result, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		order, coupon, err := store.cartOrder(sessCtx, userID, shipping)
+		if err!=nil {
+			return nil, err
+		}
+		if err = attachPayment(&order, payment); err!=nil {
+			return nil, err
+		}
+
+		if err = store.reserveStock(sessCtx, order.Order_cart); err!=nil {
+			return nil, err
+		}
+		if coupon != nil {
+			if err = store.redeemCoupon(sessCtx, *coupon, userID); err!=nil {
+				return nil, err
+			}
+		}
+		if _, err = store.order_collection.InsertOne(sessCtx, order); err!=nil {
+			return nil, err
+		}
+
+		// Empty the user's cart to complete the purchase
+		usercart_empty := make([]models.ProductUser, 0)
+		updated := touchCart(bson.D{{Key: "$set", Value: bson.D{primitive.E{Key:"usercart", Value: usercart_empty}, {Key: "cart_coupon", Value: nil}}}})
+		if _, err = store.user_collection.UpdateOne(sessCtx, bson.D{primitive.E{Key: "_id", Value: id}}, updated); err!=nil {
+			return nil, err
+		}
+
+		return order, nil
+	})
+	if err!=nil {
+		return models.Order{}, checkoutError(err)
+	}
+
+	return result.(models.Order), nil
+}
 
-	// Updating the Order's cart with product_details
-	filter2 := bson.D{primitive.E{Key:"_id", Value: id}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": product_details}}
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+// InstantBuyer places an order for a single product without touching the cart,
+// with the same all-or-nothing guarantee as BuyItemFromCart
+func (store *MongoStore) InstantBuyer(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address, payment models.Payment) (models.Order, error) {
+	if _, err := primitive.ObjectIDFromHex(userID); err!=nil {
+		log.Println(err)
+		return models.Order{}, ErrUserIDIsNotValid
+	}
+
+	session, err := store.client.StartSession()
 	if err!=nil {
 		log.Println(err)
+		return models.Order{}, ErrCantBuyCartItem
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		order, err := store.instantOrder(sessCtx, productID, sku, userID, shipping)
+		if err!=nil {
+			return nil, err
+		}
+		if err = attachPayment(&order, payment); err!=nil {
+			return nil, err
+		}
+
+		if err = store.reserveStock(sessCtx, order.Order_cart); err!=nil {
+			return nil, err
+		}
+		if _, err = store.order_collection.InsertOne(sessCtx, order); err!=nil {
+			return nil, err
+		}
+
+		return order, nil
+	})
+	if err!=nil {
+		return models.Order{}, checkoutError(err)
+	}
+
+	return result.(models.Order), nil
+}
+
+// reserveStock takes the quantity of every line off its product's stock, and off
+// the variant's for lines of a variant. Each decrement only matches while enough
+// stock is left, so two checkouts can never sell the same item twice. Any
+// shortfall aborts the surrounding transaction.
+func (store *MongoStore) reserveStock(sessCtx mongo.SessionContext, lines []models.ProductUser) error {
+	for _, item := range lines {
+		filter := bson.D{primitive.E{Key: "_id", Value: item.Product_id}, {Key: "stock", Value: bson.M{"$gte": item.Quantity}}, {Key: "archived", Value: bson.M{"$ne": true}}}
+		update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "stock", Value: -item.Quantity}}}}
+		if item.Sku != "" {
+			filter = append(filter, bson.E{Key: "variants", Value: bson.M{"$elemMatch": bson.M{"sku": item.Sku, "stock": bson.M{"$gte": item.Quantity}}}})
+			update = bson.D{{Key: "$inc", Value: bson.D{{Key: "stock", Value: -item.Quantity}, {Key: "variants.$.stock", Value: -item.Quantity}}}}
+		}
+		result, err := store.prod_collection.UpdateOne(sessCtx, filter, update)
+		if err!=nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			// Products archived while sitting in the cart can't be bought any more
+			if product, findErr := store.FindProduct(sessCtx, item.Product_id); findErr == nil {
+				if product.Archived {
+					return ErrProductArchived
+				}
+				if _, variantErr := catalog.FindVariant(product, item.Sku); variantErr != nil {
+					return variantErr
+				}
+			}
+			return ErrNotEnoughStock
+		}
+	}
+
+	return nil
+}
+
+// newOrder builds a pending order for the given lines, shipped to the given
+// address and priced by the engine, taking off the discount of the coupon when
+// there is one. The payment is attached by the checkout.
+func newOrder(engine *pricing.Engine, userID string, lines []models.ProductUser, coupon *models.Coupon, shipping *models.Address) (models.Order, error) {
+	order := models.Order{
+		Order_id:         primitive.NewObjectID(),
+		User_id:          userID,
+		Ordered_at:       time.Now(),
+		Shipping_address: shipping,
+	}
+
+	quote, err := engine.Quote(lines, coupon, userID, shipping, order.Ordered_at)
+	if err!=nil {
+		return order, err
+	}
+
+	if coupon != nil {
+		discount := quote.Discount
+		order.Discount = &discount
+		order.Coupon_code = quote.Coupon_code
+	}
+
+	// The order lines keep the tax worked out for them
+	order.Order_cart = make([]models.ProductUser, len(quote.Lines))
+	for i, line := range quote.Lines {
+		order.Order_cart[i] = line.ProductUser
 	}
+	order.Subtotal = quote.Subtotal
+	order.Shipping_fee = quote.Shipping_fee
+	order.Tax = quote.Tax
+	order.Tax_included = quote.Tax_included
+	order.Tax_lines = quote.Tax_lines
+	order.Price = quote.Total
+	orders.New(&order, order.Ordered_at)
+
+	return order, nil
+}
 
-	return nil 
-}
\ No newline at end of file
+// attachPayment puts the payment on the order. The payment was authorized for
+// the total the customer was shown, so a total that moved since then is refused.
+func attachPayment(order *models.Order, payment models.Payment) error {
+	if payment.Amount != order.Price {
+		return ErrPaymentMismatch
+	}
+
+	order.Payment_method = payment
+	return nil
+}
+
+// quoteCart prices a cart for showing it. A coupon that no longer applies to
+// the cart is left out of the quote, which says why instead of failing.
+// couponErr is what looking the coupon up returned.
+func quoteCart(engine *pricing.Engine, userID string, lines []models.ProductUser, coupon *models.Coupon, couponErr error, address *models.Address) (models.Quote, error) {
+	if couponErr == nil {
+		quote, err := engine.Quote(lines, coupon, userID, address, time.Now())
+		if !couponError(err) {
+			return quote, err
+		}
+		couponErr = err
+	}
+	if !couponError(couponErr) {
+		return models.Quote{}, couponErr
+	}
+
+	quote, err := engine.Quote(lines, nil, userID, address, time.Now())
+	if err!=nil {
+		return models.Quote{}, err
+	}
+	reason := couponErr.Error()
+	quote.Coupon_error = &reason
+	return quote, nil
+}
+
+// couponError reports whether err says the coupon on a cart doesn't apply to it.
+// A fixed amount coupon in another currency than the cart doesn't either.
+func couponError(err error) bool {
+	for _, couponErr := range []error{ErrCouponNotFound, coupons.ErrCouponInactive, coupons.ErrCouponExpired, coupons.ErrCouponUsedUp, coupons.ErrCouponUserLimit, coupons.ErrBelowMinimum, models.ErrCurrencyMismatch} {
+		if errors.Is(err, couponErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkoutError keeps the errors callers can act on and folds everything else,
+// after logging it, into ErrCantBuyCartItem
+func checkoutError(err error) error {
+	for _, known := range []error{ErrUserNotFound, ErrCartIsEmpty, ErrCantFindProduct, ErrNotEnoughStock, models.ErrCurrencyMismatch, models.ErrMoneyOverflow, ErrCouponNotFound, ErrPaymentMismatch, ErrProductArchived, catalog.ErrVariantRequired, catalog.ErrVariantNotFound} {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+
+	// Coupon problems are passed on as they are, they tell the customer what's wrong
+	for _, couponErr := range []error{coupons.ErrCouponInactive, coupons.ErrCouponExpired, coupons.ErrCouponUsedUp, coupons.ErrCouponUserLimit, coupons.ErrBelowMinimum} {
+		if errors.Is(err, couponErr) {
+			return err
+		}
+	}
+
+	log.Println(err)
+	return ErrCantBuyCartItem
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+	"go-com/pricing"
+	"go-com/taxes"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// usTax charges 8.25% in the US, except on food
+func usTax() *taxes.Registry {
+	registry := taxes.NewRegistry(taxes.NoTax{})
+	registry.Register("US", &taxes.Table{Country: "US", Rates: []taxes.Rate{
+		{Name: "Sales tax", Basis_points: 825},
+		{Name: "Groceries", Class: "food", Basis_points: 0},
+	}})
+
+	return registry
+}
+
+// TestNewOrderChargesTheQuote makes sure an order is priced the way its cart
+// was quoted, with a coupon, shipping and tax on top of the prices
+func TestNewOrderChargesTheQuote(t *testing.T) {
+	engine := &pricing.Engine{Shipping: pricing.FlatRate{Amount: 499, Free_over: 10000}, Taxes: usTax()}
+
+	lines := []models.ProductUser{
+		{Product_id: primitive.NewObjectID(), Price: models.NewMoney(1999, "USD"), Quantity: 3},
+		{Product_id: primitive.NewObjectID(), Price: models.NewMoney(349, "USD"), Quantity: 2, Tax_class: "food"},
+	}
+	coupon := &models.Coupon{Code: "SAVE15", Type: models.CouponPercentage, Percent: 15, Active: true}
+	address := &models.Address{Country: "US"}
+
+	for _, test := range []struct {
+		name    string
+		coupon  *models.Coupon
+		address *models.Address
+	}{
+		{"plain", nil, nil},
+		{"with a coupon", coupon, nil},
+		{"with a coupon and tax", coupon, address},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			quote, err := engine.Quote(lines, test.coupon, "user", test.address, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			order, err := newOrder(engine, "user", lines, test.coupon, test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if order.Price != quote.Total {
+				t.Errorf("order total = %v, quoted %v", order.Price, quote.Total)
+			}
+			if order.Subtotal != quote.Subtotal || order.Shipping_fee != quote.Shipping_fee || order.Tax != quote.Tax {
+				t.Errorf("order = %v + %v shipping + %v tax, quoted %v + %v shipping + %v tax",
+					order.Subtotal, order.Shipping_fee, order.Tax, quote.Subtotal, quote.Shipping_fee, quote.Tax)
+			}
+			if (order.Discount == nil) != (test.coupon == nil) || order.Discount != nil && *order.Discount != quote.Discount {
+				t.Errorf("order discount = %v, quoted %v", order.Discount, quote.Discount)
+			}
+			if len(order.Order_cart) != len(lines) || order.Status != models.OrderPending {
+				t.Errorf("order = %+v, want a pending order of the cart's lines", order)
+			}
+		})
+	}
+}
+
+// TestCartTaxedByCurrentClass changes a product's tax class after it went into
+// the cart, the quote and the order go by the new class
+func TestCartTaxedByCurrentClass(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(&pricing.Engine{Shipping: pricing.FreeShipping{}, Taxes: usTax()})
+
+	name := "Oats"
+	product := models.Product{Product_id: primitive.NewObjectID(), Product_name: &name, Price: models.NewMoney(1000, "USD"), Stock: 10}
+	user := models.User{ID: primitive.NewObjectID()}
+	user.User_id = user.ID.Hex()
+	if err := store.InsertProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddProductToCart(ctx, product.Product_id, "", user.User_id, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	address := &models.Address{Country: "US"}
+	quote, err := store.QuoteCart(ctx, user.User_id, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Tax != models.NewMoney(165, "USD") {
+		t.Fatalf("tax before the class changed = %v, want 1.65 USD", quote.Tax)
+	}
+
+	if _, err = store.UpdateProduct(ctx, product.Product_id, func(product *models.Product) error {
+		product.Tax_class = "food"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if quote, err = store.QuoteCart(ctx, user.User_id, address); err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Tax.IsZero() || quote.Lines[0].Tax_class != "food" {
+		t.Errorf("quote after the class changed = %v tax on class %q, want no tax on food", quote.Tax, quote.Lines[0].Tax_class)
+	}
+
+	preview, err := store.PreviewCart(ctx, user.User_id, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Tax.IsZero() || preview.Price != quote.Total {
+		t.Errorf("order after the class changed = %v with %v tax, want the quoted %v without tax", preview.Price, preview.Tax, quote.Total)
+	}
+}
+
+// TestQuoteCartDropsCouponThatDoesntApply shows the cart without a coupon that
+// no longer applies to it, saying why, instead of failing
+func TestQuoteCartDropsCouponThatDoesntApply(t *testing.T) {
+	engine := &pricing.Engine{Shipping: pricing.FreeShipping{}, Taxes: usTax()}
+	lines := []models.ProductUser{{Product_id: primitive.NewObjectID(), Price: models.NewMoney(2000, "USD"), Quantity: 1}}
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		coupon    *models.Coupon
+		couponErr error
+	}{
+		{"coupon deleted", nil, ErrCouponNotFound},
+		{"expired", &models.Coupon{Code: "OLD", Type: models.CouponPercentage, Percent: 10, Active: true, Expires_at: &expired}, nil},
+		{"used up", &models.Coupon{Code: "GONE", Type: models.CouponPercentage, Percent: 10, Active: true, Max_uses: 1, Used_count: 1}, nil},
+		{"fixed amount in another currency", &models.Coupon{Code: "EURO5", Type: models.CouponFixed, Amount: models.NewMoney(500, "EUR"), Active: true}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quote, err := quoteCart(engine, "user", lines, test.coupon, test.couponErr, nil)
+			if err != nil {
+				t.Fatalf("quoteCart() error = %v, want the cart without the coupon", err)
+			}
+			if quote.Coupon_error == nil || !quote.Discount.IsZero() || quote.Total != models.NewMoney(2000, "USD") {
+				t.Errorf("quote = %+v, want the full price and a coupon error", quote)
+			}
+		})
+	}
+
+	// Lines in mixed currencies fail with or without the coupon
+	mixed := append(lines, models.ProductUser{Product_id: primitive.NewObjectID(), Price: models.NewMoney(100, "EUR"), Quantity: 1})
+	if _, err := quoteCart(engine, "user", mixed, tests[3].coupon, nil, nil); !errors.Is(err, models.ErrCurrencyMismatch) {
+		t.Errorf("quoteCart() of mixed currencies error = %v, want %v", err, models.ErrCurrencyMismatch)
+	}
+}
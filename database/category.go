@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("Category not found")
+	ErrCategorySlugTaken   = errors.New("A category with this slug already exists")
+	ErrCategoryHasChildren = errors.New("Category still has categories under it")
+	ErrCantUpdateCategory  = errors.New("Cannot update the category")
+)
+
+func (store *MongoStore) InsertCategory(ctx context.Context, category models.Category) error {
+	count, err := store.category_collection.CountDocuments(ctx, bson.M{"slug": category.Slug})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+	if count > 0 {
+		return ErrCategorySlugTaken
+	}
+
+	if _, err = store.category_collection.InsertOne(ctx, category); err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+
+	return nil
+}
+
+func (store *MongoStore) FindCategory(ctx context.Context, categoryID primitive.ObjectID) (models.Category, error) {
+	return store.findCategory(ctx, bson.M{"_id": categoryID})
+}
+
+func (store *MongoStore) FindCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	return store.findCategory(ctx, bson.M{"slug": slug})
+}
+
+func (store *MongoStore) findCategory(ctx context.Context, filter interface{}) (models.Category, error) {
+	var category models.Category
+	err := store.category_collection.FindOne(ctx, filter).Decode(&category)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return category, ErrCategoryNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return category, err
+	}
+
+	return category, nil
+}
+
+func (store *MongoStore) ListCategories(ctx context.Context) ([]models.Category, error) {
+	cursor, err := store.category_collection.Find(ctx, bson.D{{}})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := make([]models.Category, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// UpdateCategory renames or moves a category. Whether the new parent keeps the
+// tree a tree is for the caller to check with catalog.ValidParent.
+func (store *MongoStore) UpdateCategory(ctx context.Context, category models.Category) error {
+	count, err := store.category_collection.CountDocuments(ctx, bson.M{"slug": category.Slug, "_id": bson.M{"$ne": category.Category_id}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+	if count > 0 {
+		return ErrCategorySlugTaken
+	}
+
+	update := bson.M{"$set": bson.M{
+		"name":       category.Name,
+		"slug":       category.Slug,
+		"parent_id":  category.Parent_id,
+		"updated_at": category.Updated_at,
+	}}
+	result, err := store.category_collection.UpdateOne(ctx, bson.M{"_id": category.Category_id}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+	if result.MatchedCount == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// DeleteCategory removes a category that has nothing under it and takes it off
+// the products that were in it
+func (store *MongoStore) DeleteCategory(ctx context.Context, categoryID primitive.ObjectID) error {
+	children, err := store.category_collection.CountDocuments(ctx, bson.M{"parent_id": categoryID})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+	if children > 0 {
+		return ErrCategoryHasChildren
+	}
+
+	result, err := store.category_collection.DeleteOne(ctx, bson.M{"_id": categoryID})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+	if result.DeletedCount == 0 {
+		return ErrCategoryNotFound
+	}
+
+	pull := bson.M{"$pull": bson.M{"categories": categoryID}}
+	if _, err = store.prod_collection.UpdateMany(ctx, bson.M{"categories": categoryID}, pull); err != nil {
+		log.Println(err)
+		return ErrCantUpdateCategory
+	}
+
+	return nil
+}
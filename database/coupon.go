@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/coupons"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCouponNotFound   = errors.New("Coupon not found")
+	ErrCouponCodeTaken  = errors.New("A coupon with this code already exists")
+	ErrCantUpdateCoupon = errors.New("Cannot update the coupon")
+)
+
+func (store *MongoStore) InsertCoupon(ctx context.Context, coupon models.Coupon) error {
+	count, err := store.coupon_collection.CountDocuments(ctx, bson.M{"code": coupon.Code})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCoupon
+	}
+	if count > 0 {
+		return ErrCouponCodeTaken
+	}
+
+	// used_by has to be a document for the $inc at checkout to work
+	if coupon.Used_by == nil {
+		coupon.Used_by = make(map[string]int)
+	}
+
+	if _, err = store.coupon_collection.InsertOne(ctx, coupon); err != nil {
+		log.Println(err)
+		return ErrCantUpdateCoupon
+	}
+
+	return nil
+}
+
+func (store *MongoStore) FindCoupon(ctx context.Context, couponID primitive.ObjectID) (models.Coupon, error) {
+	return store.findCoupon(ctx, bson.M{"_id": couponID})
+}
+
+func (store *MongoStore) FindCouponByCode(ctx context.Context, code string) (models.Coupon, error) {
+	return store.findCoupon(ctx, bson.M{"code": code})
+}
+
+func (store *MongoStore) findCoupon(ctx context.Context, filter interface{}) (models.Coupon, error) {
+	var coupon models.Coupon
+	err := store.coupon_collection.FindOne(ctx, filter).Decode(&coupon)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return coupon, ErrCouponNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return coupon, err
+	}
+
+	return coupon, nil
+}
+
+func (store *MongoStore) ListCoupons(ctx context.Context) ([]models.Coupon, error) {
+	cursor, err := store.coupon_collection.Find(ctx, bson.D{{}})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := make([]models.Coupon, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// UpdateCoupon replaces the rules of a coupon. The usage counters are left alone.
+func (store *MongoStore) UpdateCoupon(ctx context.Context, coupon models.Coupon) error {
+	count, err := store.coupon_collection.CountDocuments(ctx, bson.M{"code": coupon.Code, "_id": bson.M{"$ne": coupon.Coupon_id}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCoupon
+	}
+	if count > 0 {
+		return ErrCouponCodeTaken
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "code", Value: coupon.Code},
+		{Key: "type", Value: coupon.Type},
+		{Key: "percent", Value: coupon.Percent},
+		{Key: "amount", Value: coupon.Amount},
+		{Key: "min_cart_value", Value: coupon.Min_cart_value},
+		{Key: "expires_at", Value: coupon.Expires_at},
+		{Key: "max_uses", Value: coupon.Max_uses},
+		{Key: "max_uses_per_user", Value: coupon.Max_uses_per_user},
+		{Key: "active", Value: coupon.Active},
+		{Key: "updated_at", Value: coupon.Updated_at},
+	}}}
+	result, err := store.coupon_collection.UpdateOne(ctx, bson.M{"_id": coupon.Coupon_id}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCoupon
+	}
+	if result.MatchedCount == 0 {
+		return ErrCouponNotFound
+	}
+
+	return nil
+}
+
+func (store *MongoStore) DeleteCoupon(ctx context.Context, couponID primitive.ObjectID) error {
+	result, err := store.coupon_collection.DeleteOne(ctx, bson.M{"_id": couponID})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateCoupon
+	}
+	if result.DeletedCount == 0 {
+		return ErrCouponNotFound
+	}
+
+	return nil
+}
+
+// redeemCoupon counts one use of the coupon by the user. The filter repeats the
+// limits so two checkouts racing for the last use can't both get it.
+func (store *MongoStore) redeemCoupon(sessCtx mongo.SessionContext, coupon models.Coupon, userID string) error {
+	filter := bson.M{"_id": coupon.Coupon_id, "active": true}
+	if coupon.Max_uses > 0 {
+		filter["used_count"] = bson.M{"$lt": coupon.Max_uses}
+	}
+	if coupon.Max_uses_per_user > 0 {
+		filter["used_by."+userID] = bson.M{"$not": bson.M{"$gte": coupon.Max_uses_per_user}}
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"used_count": 1, "used_by." + userID: 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	result, err := store.coupon_collection.UpdateOne(sessCtx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return coupons.ErrCouponUsedUp
+	}
+
+	return nil
+}
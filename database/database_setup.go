@@ -7,6 +7,10 @@ import (
 	"time"
 	"fmt"
 
+	"go-com/carts"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -57,8 +61,6 @@ func DBSet() *mongo.Client {
 
 }
 
-var Client *mongo.Client = DBSet()
-
 func UserData(client *mongo.Client, collectionName string) *mongo.Collection{
 	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
 	return collection 
@@ -67,4 +69,93 @@ func UserData(client *mongo.Client, collectionName string) *mongo.Collection{
 func ProductData(client *mongo.Client, collectionName string) *mongo.Collection{
 	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
 	return collection
-}
\ No newline at end of file
+}
+
+func OrderData(client *mongo.Client, collectionName string) *mongo.Collection{
+	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
+	return collection
+}
+
+func CouponData(client *mongo.Client, collectionName string) *mongo.Collection{
+	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
+	return collection
+}
+
+func CategoryData(client *mongo.Client, collectionName string) *mongo.Collection{
+	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
+	return collection
+}
+
+func GuestCartData(client *mongo.Client, collectionName string) *mongo.Collection{
+	var collection *mongo.Collection = client.Database("Ecommerce").Collection(collectionName)
+	return collection
+}
+
+// MongoStore implements Store on top of the Ecommerce database
+type MongoStore struct {
+	client              *mongo.Client
+	prod_collection     *mongo.Collection
+	user_collection     *mongo.Collection
+	order_collection    *mongo.Collection
+	coupon_collection   *mongo.Collection
+	category_collection *mongo.Collection
+	guest_collection    *mongo.Collection
+	pricing             *pricing.Engine
+}
+
+// NewMongoStore keeps its data in the client's Ecommerce database and prices
+// carts and orders with the engine
+func NewMongoStore(client *mongo.Client, engine *pricing.Engine) *MongoStore {
+	return &MongoStore{
+		client:              client,
+		prod_collection:     ProductData(client, "Products"),
+		user_collection:     UserData(client, "Users"),
+		order_collection:    OrderData(client, "Orders"),
+		coupon_collection:   CouponData(client, "Coupons"),
+		category_collection: CategoryData(client, "Categories"),
+		guest_collection:    GuestCartData(client, "GuestCarts"),
+		pricing:             engine,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on. Creating an index that
+// already exists does nothing, so it is safe to run on every start.
+func (store *MongoStore) EnsureIndexes(ctx context.Context) error {
+	// Product search ranks name matches above description matches
+	search := mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_name", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().SetName("product_search").SetWeights(bson.M{"product_name": 10, "description": 2}),
+	}
+	if _, err := store.prod_collection.Indexes().CreateOne(ctx, search); err != nil {
+		return err
+	}
+
+	// The order history lists a user's orders latest first
+	history := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "ordered_at", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("order_history"),
+	}
+	if _, err := store.order_collection.Indexes().CreateOne(ctx, history); err != nil {
+		return err
+	}
+
+	// The reminder worker looks for carts that have been idle the longest
+	abandoned := mongo.IndexModel{
+		Keys:    bson.D{{Key: "cart_updated_at", Value: 1}},
+		Options: options.Index().SetName("abandoned_carts"),
+	}
+	if _, err := store.user_collection.Indexes().CreateOne(ctx, abandoned); err != nil {
+		return err
+	}
+
+	// Guest carts nobody touched for carts.GuestLifetime are deleted by MongoDB
+	expiry := mongo.IndexModel{
+		Keys:    bson.D{{Key: "updated_at", Value: 1}},
+		Options: options.Index().SetName("guest_cart_expiry").SetExpireAfterSeconds(int32(carts.GuestLifetime / time.Second)),
+	}
+	if _, err := store.guest_collection.Indexes().CreateOne(ctx, expiry); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrGuestCartNotFound   = errors.New("Guest cart not found, it may have expired")
+	ErrCantUpdateGuestCart = errors.New("Cannot update the guest cart")
+)
+
+// guestCartBackend is what a store provides for guest carts, guestCarts builds
+// the cart operations on top of it the same way for every store
+type guestCartBackend interface {
+	FindProduct(ctx context.Context, productID primitive.ObjectID) (models.Product, error)
+	FindProducts(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error)
+	FindCouponByCode(ctx context.Context, code string) (models.Coupon, error)
+	pricingEngine() *pricing.Engine
+	findGuestCart(ctx context.Context, token string) (models.GuestCart, error)
+	updateGuestCart(ctx context.Context, token string, mutate func(*models.GuestCart) error) (models.GuestCart, error)
+}
+
+// guestCarts is the CartStore of guest carts, where the user ID of every call
+// is the guest token
+type guestCarts struct {
+	backend guestCartBackend
+}
+
+func (guests guestCarts) AddProductToCart(ctx context.Context, productID primitive.ObjectID, sku string, token string, quantity int) error {
+	product, err := guests.backend.FindProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if product.Archived {
+		return ErrProductArchived
+	}
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return err
+	}
+
+	if quantity < 1 {
+		return ErrInvalidQuantity
+	}
+
+	_, err = guests.backend.updateGuestCart(ctx, token, func(cart *models.GuestCart) error {
+		line := carts.Find(cart.UserCart, productID, sku)
+		inCart := 0
+		if line >= 0 {
+			inCart = cart.UserCart[line].Quantity
+		}
+		if err := checkStock(product, sku, inCart+quantity); err != nil {
+			return err
+		}
+
+		if line >= 0 {
+			cart.UserCart[line].Quantity += quantity
+			return nil
+		}
+
+		item := productToCartItem(product, variant)
+		item.Quantity = quantity
+		cart.UserCart = append(cart.UserCart, item)
+		return nil
+	})
+	return err
+}
+
+func (guests guestCarts) RemoveCartItem(ctx context.Context, productID primitive.ObjectID, sku string, token string) error {
+	_, err := guests.backend.updateGuestCart(ctx, token, func(cart *models.GuestCart) error {
+		cart.UserCart = carts.Remove(cart.UserCart, productID, sku)
+		return nil
+	})
+	return err
+}
+
+func (guests guestCarts) SetCartItemQuantity(ctx context.Context, productID primitive.ObjectID, sku string, token string, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return guests.RemoveCartItem(ctx, productID, sku, token)
+	}
+
+	product, err := guests.backend.FindProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if err = checkStock(product, sku, quantity); err != nil {
+		return err
+	}
+
+	_, err = guests.backend.updateGuestCart(ctx, token, func(cart *models.GuestCart) error {
+		line := carts.Find(cart.UserCart, productID, sku)
+		if line < 0 {
+			return ErrItemNotInCart
+		}
+
+		cart.UserCart[line].Quantity = quantity
+		return nil
+	})
+	return err
+}
+
+func (guests guestCarts) DecrementCartItem(ctx context.Context, productID primitive.ObjectID, sku string, token string) error {
+	_, err := guests.backend.updateGuestCart(ctx, token, func(cart *models.GuestCart) error {
+		line := carts.Find(cart.UserCart, productID, sku)
+		if line < 0 {
+			return ErrItemNotInCart
+		}
+
+		if cart.UserCart[line].Quantity > 1 {
+			cart.UserCart[line].Quantity--
+			return nil
+		}
+
+		cart.UserCart = carts.Remove(cart.UserCart, productID, sku)
+		return nil
+	})
+	return err
+}
+
+func (guests guestCarts) GetCart(ctx context.Context, token string) ([]models.ProductUser, error) {
+	cart, err := guests.backend.findGuestCart(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return cart.UserCart, nil
+}
+
+func (guests guestCarts) CartTotal(ctx context.Context, token string) (models.Money, error) {
+	cart, err := guests.GetCart(ctx, token)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	return pricing.Subtotal(cart)
+}
+
+func (guests guestCarts) QuoteCart(ctx context.Context, token string, address *models.Address) (models.Quote, error) {
+	cart, err := guests.backend.findGuestCart(ctx, token)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	var coupon *models.Coupon
+	if cart.Cart_coupon != nil {
+		var found models.Coupon
+		if found, err = guests.backend.FindCouponByCode(ctx, *cart.Cart_coupon); err == nil {
+			coupon = &found
+		}
+	}
+	lines, linesErr := currentTaxClasses(ctx, guests.backend.FindProducts, cart.UserCart)
+	if linesErr != nil {
+		return models.Quote{}, linesErr
+	}
+	return quoteCart(guests.backend.pricingEngine(), token, lines, coupon, err, address)
+}
+
+func (guests guestCarts) SetCartCoupon(ctx context.Context, token string, code *string) error {
+	_, err := guests.backend.updateGuestCart(ctx, token, func(cart *models.GuestCart) error {
+		cart.Cart_coupon = code
+		return nil
+	})
+	return err
+}
+
+// guestStock looks up what is left in stock of every line of a guest cart, for
+// carts.Merge. Products that are gone, archived or no longer have the variant
+// can't be merged.
+func guestStock(ctx context.Context, products ProductStore, lines []models.ProductUser) func(models.ProductUser) (int, bool) {
+	found := make(map[primitive.ObjectID]models.Product, len(lines))
+	for _, item := range lines {
+		if _, seen := found[item.Product_id]; seen {
+			continue
+		}
+		product, err := products.FindProduct(ctx, item.Product_id)
+		if err != nil {
+			continue
+		}
+		found[item.Product_id] = product
+	}
+
+	return func(item models.ProductUser) (int, bool) {
+		product, ok := found[item.Product_id]
+		if !ok || product.Archived {
+			return 0, false
+		}
+		variant, err := catalog.FindVariant(product, item.Sku)
+		if err != nil {
+			return 0, false
+		}
+		if variant != nil {
+			return variant.Stock, true
+		}
+
+		return product.Stock, true
+	}
+}
+
+func (store *MongoStore) InsertGuestCart(ctx context.Context, cart models.GuestCart) error {
+	if _, err := store.guest_collection.InsertOne(ctx, cart); err != nil {
+		log.Println(err)
+		return ErrCantUpdateGuestCart
+	}
+
+	return nil
+}
+
+func (store *MongoStore) GuestCarts() CartStore {
+	return guestCarts{backend: store}
+}
+
+func (store *MongoStore) pricingEngine() *pricing.Engine {
+	return store.pricing
+}
+
+// findGuestCart reads a guest cart. Expired carts are not found, also before
+// the TTL index got around to deleting them.
+func (store *MongoStore) findGuestCart(ctx context.Context, token string) (models.GuestCart, error) {
+	var cart models.GuestCart
+	err := store.guest_collection.FindOne(ctx, bson.M{"_id": token}).Decode(&cart)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return cart, ErrGuestCartNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return cart, ErrCantUpdateGuestCart
+	}
+	if carts.Expired(cart, time.Now()) {
+		return models.GuestCart{}, ErrGuestCartNotFound
+	}
+
+	return cart, nil
+}
+
+// updateGuestCart reads the guest cart, lets mutate change it and writes it
+// back while it is still the way it was read, trying again a few times when
+// another request changed it in between
+func (store *MongoStore) updateGuestCart(ctx context.Context, token string, mutate func(*models.GuestCart) error) (models.GuestCart, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		cart, err := store.findGuestCart(ctx, token)
+		if err != nil {
+			return cart, err
+		}
+
+		read := cart.Updated_at
+		if err = mutate(&cart); err != nil {
+			return cart, err
+		}
+		cart.Updated_at = time.Now()
+
+		result, err := store.guest_collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: token}, {Key: "updated_at", Value: read}}, cart)
+		if err != nil {
+			log.Println(err)
+			return cart, ErrCantUpdateGuestCart
+		}
+		if result.MatchedCount > 0 {
+			return cart, nil
+		}
+	}
+
+	return models.GuestCart{}, ErrCantUpdateGuestCart
+}
+
+// MergeGuestCart moves the guest cart into the user's cart following the
+// strategy and carries its coupon over when the user's cart has none. The guest
+// cart is claimed by deleting it before anything is merged, so two logins with
+// the same token can't both merge it. The user's cart is written while it is
+// still the way it was read, going by cart_updated_at, which every change to
+// the cart moves. It returns the user's cart as it is after the merge.
+func (store *MongoStore) MergeGuestCart(ctx context.Context, token string, userID string, strategy carts.MergeStrategy) ([]models.ProductUser, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIDIsNotValid
+	}
+	if _, err = store.FindUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var guest models.GuestCart
+	err = store.guest_collection.FindOneAndDelete(ctx, bson.M{"_id": token}).Decode(&guest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrGuestCartNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantUpdateGuestCart
+	}
+	if carts.Expired(guest, time.Now()) {
+		return nil, ErrGuestCartNotFound
+	}
+
+	merged, err := store.mergeIntoUser(ctx, id, userID, guest, strategy)
+	if err != nil {
+		// Nothing was merged, give the guest their cart back
+		if _, insertErr := store.guest_collection.InsertOne(ctx, guest); insertErr != nil {
+			log.Println(insertErr)
+		}
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+func (store *MongoStore) mergeIntoUser(ctx context.Context, id primitive.ObjectID, userID string, guest models.GuestCart, strategy carts.MergeStrategy) ([]models.ProductUser, error) {
+	stock := guestStock(ctx, store, guest.UserCart)
+	for attempt := 0; attempt < 3; attempt++ {
+		user, err := store.FindUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		merged := carts.Merge(user.UserCart, guest.UserCart, strategy, stock)
+		now := time.Now()
+		set := bson.D{{Key: "usercart", Value: merged}, {Key: "updated_at", Value: now}, {Key: "cart_updated_at", Value: now}}
+		if user.Cart_coupon == nil && guest.Cart_coupon != nil {
+			set = append(set, bson.E{Key: "cart_coupon", Value: guest.Cart_coupon})
+		}
+
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "cart_updated_at", Value: user.Cart_updated_at}}
+		result, err := store.user_collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}})
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantUpdateUser
+		}
+		if result.MatchedCount > 0 {
+			return merged, nil
+		}
+	}
+
+	return nil, ErrCantUpdateUser
+}
@@ -0,0 +1,647 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore implements Store with plain maps guarded by a single lock.
+// Nothing is persisted, it is meant for running the API and its tests locally.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	products   map[primitive.ObjectID]models.Product
+	users      map[primitive.ObjectID]*models.User
+	orders     map[primitive.ObjectID]*models.Order
+	coupons    map[primitive.ObjectID]*models.Coupon
+	categories map[primitive.ObjectID]models.Category
+	guests     map[string]*models.GuestCart
+	pricing    *pricing.Engine
+}
+
+func NewMemoryStore(engine *pricing.Engine) *MemoryStore {
+	return &MemoryStore{
+		products:   make(map[primitive.ObjectID]models.Product),
+		users:      make(map[primitive.ObjectID]*models.User),
+		orders:     make(map[primitive.ObjectID]*models.Order),
+		coupons:    make(map[primitive.ObjectID]*models.Coupon),
+		categories: make(map[primitive.ObjectID]models.Category),
+		guests:     make(map[string]*models.GuestCart),
+		pricing:    engine,
+	}
+}
+
+// user looks a user up by its hex ID. The caller must hold the lock.
+func (store *MemoryStore) user(userID string) (*models.User, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserIDIsNotValid
+	}
+
+	user, ok := store.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// copyUser returns a copy of the user that shares no slices with the store
+func copyUser(user *models.User) models.User {
+	copied := *user
+	copied.UserCart = append([]models.ProductUser{}, user.UserCart...)
+	copied.Wishlist = append([]models.WishlistItem{}, user.Wishlist...)
+	copied.Address_Details = append([]models.Address{}, user.Address_Details...)
+	copied.Token_families = append([]models.TokenFamily{}, user.Token_families...)
+	return copied
+}
+
+// touchUserCart records that the user's cart just changed
+func touchUserCart(user *models.User) {
+	now := time.Now()
+	user.Cart_updated_at = &now
+}
+
+// copyProduct returns a copy of the product whose variants can be changed
+// without changing the product in the store
+func copyProduct(product models.Product) models.Product {
+	copied := product
+	copied.Variants = append([]models.Variant(nil), product.Variants...)
+	return copied
+}
+
+func (store *MemoryStore) InsertProduct(ctx context.Context, product models.Product) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.products[product.Product_id] = product
+	return nil
+}
+
+func (store *MemoryStore) FindProduct(ctx context.Context, productID primitive.ObjectID) (models.Product, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	product, ok := store.products[productID]
+	if !ok {
+		return product, ErrCantFindProduct
+	}
+
+	return product, nil
+}
+
+func (store *MemoryStore) ListProducts(ctx context.Context, query catalog.Query) (catalog.Page, error) {
+	if err := query.Normalize(); err != nil {
+		return catalog.Page{}, err
+	}
+
+	var pattern *regexp.Regexp
+	if query.Name != "" {
+		var err error
+		if pattern, err = regexp.Compile("(?i)" + regexp.QuoteMeta(query.Name)); err != nil {
+			return catalog.Page{}, ErrCantFindProduct
+		}
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	matching := make([]models.Product, 0)
+	for _, product := range store.products {
+		if product.Archived || !catalog.Matches(product, query) {
+			continue
+		}
+		if pattern != nil && (product.Product_name == nil || !pattern.MatchString(*product.Product_name)) {
+			continue
+		}
+		matching = append(matching, product)
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return catalog.Less(matching[i], matching[j], query)
+	})
+
+	page := catalog.Page{Products: make([]models.Product, 0, query.Limit), Total: int64(len(matching))}
+	if query.Facets {
+		facets := catalog.CountFacets(matching, store.categoryList(), query.Currency)
+		page.Facets = &facets
+	}
+	for _, product := range matching {
+		if !catalog.After(product, query) {
+			continue
+		}
+		if len(page.Products) == query.Limit {
+			page.Next_cursor = catalog.CursorFor(page.Products[query.Limit-1], query).Encode()
+			break
+		}
+		page.Products = append(page.Products, product)
+	}
+
+	return page, nil
+}
+
+// SearchProducts scores the products for sale with catalog.Score, which weighs
+// matches the same way as the mongo text index
+func (store *MemoryStore) SearchProducts(ctx context.Context, query catalog.Query) (catalog.SearchPage, error) {
+	if err := query.Normalize(); err != nil {
+		return catalog.SearchPage{}, err
+	}
+	if len(query.Terms) == 0 {
+		return catalog.SearchPage{}, catalog.ErrInvalidSearch
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	matching := make([]catalog.SearchResult, 0)
+	found := make([]models.Product, 0)
+	for _, product := range store.products {
+		if product.Archived || !catalog.Matches(product, query) {
+			continue
+		}
+		if score := catalog.Score(product, query.Terms); score > 0 {
+			matching = append(matching, catalog.NewSearchResult(product, score, query.Terms))
+			found = append(found, product)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].Score != matching[j].Score {
+			return matching[i].Score > matching[j].Score
+		}
+		return catalog.Less(matching[i].Product, matching[j].Product, catalog.Query{Sort: catalog.SortNewest, Descending: true})
+	})
+
+	page := catalog.SearchPage{
+		Results: make([]catalog.SearchResult, 0, query.Limit),
+		Total:   int64(len(matching)),
+		Facets:  catalog.CountFacets(found, store.categoryList(), query.Currency),
+	}
+	for _, result := range matching {
+		if !catalog.AfterResult(result.Product, result.Score, query) {
+			continue
+		}
+		if len(page.Results) == query.Limit {
+			page.Next_cursor = catalog.ResultCursor(page.Results[query.Limit-1]).Encode()
+			break
+		}
+		page.Results = append(page.Results, result)
+	}
+
+	return page, nil
+}
+
+func (store *MemoryStore) SetStock(ctx context.Context, productID primitive.ObjectID, sku string, stock int) (models.Product, error) {
+	if stock < 0 {
+		return models.Product{}, ErrInvalidStock
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	product, ok := store.products[productID]
+	if !ok {
+		return product, ErrCantFindProduct
+	}
+
+	product = copyProduct(product)
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return product, err
+	}
+	if variant != nil {
+		variant.Stock, stock = stock, product.Stock+stock-variant.Stock
+	}
+
+	product.Stock = stock
+	store.products[productID] = product
+	return product, nil
+}
+
+func (store *MemoryStore) UpdateProduct(ctx context.Context, productID primitive.ObjectID, mutate func(*models.Product) error) (models.Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	product, ok := store.products[productID]
+	if !ok {
+		return product, ErrCantFindProduct
+	}
+
+	// Stock has its own methods, whatever mutate does to it is dropped
+	before := product
+	product = copyProduct(product)
+	if err := mutate(&product); err != nil {
+		return product, err
+	}
+	product.Product_id = productID
+	catalog.KeepStock(&product, before)
+	product.Updated_at = time.Now()
+
+	store.products[productID] = product
+	return product, nil
+}
+
+func (store *MemoryStore) DeleteProduct(ctx context.Context, productID primitive.ObjectID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.products[productID]; !ok {
+		return ErrCantFindProduct
+	}
+	delete(store.products, productID)
+
+	for _, user := range store.users {
+		user.UserCart = withoutProduct(user.UserCart, productID)
+	}
+	for _, guest := range store.guests {
+		guest.UserCart = withoutProduct(guest.UserCart, productID)
+	}
+
+	return nil
+}
+
+// withoutProduct returns the cart lines of other products
+func withoutProduct(cart []models.ProductUser, productID primitive.ObjectID) []models.ProductUser {
+	remaining := make([]models.ProductUser, 0, len(cart))
+	for _, item := range cart {
+		if item.Product_id != productID {
+			remaining = append(remaining, item)
+		}
+	}
+
+	return remaining
+}
+
+func (store *MemoryStore) AdjustStock(ctx context.Context, productID primitive.ObjectID, sku string, delta int) (models.Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	product, ok := store.products[productID]
+	if !ok {
+		return product, ErrCantFindProduct
+	}
+
+	product = copyProduct(product)
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return product, err
+	}
+	if variant != nil {
+		if variant.Stock+delta < 0 {
+			return product, ErrInvalidStock
+		}
+		variant.Stock += delta
+	}
+
+	if product.Stock+delta < 0 {
+		return product, ErrInvalidStock
+	}
+
+	product.Stock += delta
+	store.products[productID] = product
+	return product, nil
+}
+
+func (store *MemoryStore) InsertUser(ctx context.Context, user models.User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.users[user.ID] = &user
+	return nil
+}
+
+func (store *MemoryStore) FindUserByID(ctx context.Context, userID string) (models.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return copyUser(user), nil
+}
+
+func (store *MemoryStore) FindUserByEmail(ctx context.Context, email string) (models.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, user := range store.users {
+		if user.Email != nil && *user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+
+	return models.User{}, ErrUserNotFound
+}
+
+func (store *MemoryStore) CountUsersByEmail(ctx context.Context, email string) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var count int64
+	for _, user := range store.users {
+		if user.Email != nil && *user.Email == email {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (store *MemoryStore) CountUsersByPhone(ctx context.Context, phone string) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var count int64
+	for _, user := range store.users {
+		if user.Phone != nil && *user.Phone == phone {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (store *MemoryStore) UpdateAllTokens(ctx context.Context, signedToken, signedRefreshToken, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, user := range store.users {
+		if user.User_id == userID {
+			token, refreshToken := signedToken, signedRefreshToken
+			user.Token = &token
+			user.Refresh_Token = &refreshToken
+			user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			return nil
+		}
+	}
+
+	return ErrUserNotFound
+}
+
+func (store *MemoryStore) StartTokenFamily(ctx context.Context, userID string, family models.TokenFamily) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	families := make([]models.TokenFamily, 0, len(user.Token_families)+1)
+	for _, existing := range user.Token_families {
+		if !existing.Expires_at.Before(now) {
+			families = append(families, existing)
+		}
+	}
+	user.Token_families = append(families, family)
+	return nil
+}
+
+func (store *MemoryStore) RotateRefreshToken(ctx context.Context, userID, familyID, tokenID string, next models.TokenFamily) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range user.Token_families {
+		family := &user.Token_families[i]
+		if family.Family_id != familyID || family.Revoked {
+			continue
+		}
+
+		if family.Token_id != tokenID {
+			family.Revoked = true
+			return ErrRefreshTokenReused
+		}
+
+		family.Token_id = next.Token_id
+		family.Expires_at = next.Expires_at
+		return nil
+	}
+
+	return ErrTokenFamilyRevoked
+}
+
+func (store *MemoryStore) TokenFamilyActive(ctx context.Context, userID, familyID string) (bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, family := range user.Token_families {
+		if family.Family_id == familyID && !family.Revoked {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (store *MemoryStore) SetUserRole(ctx context.Context, userID string, role models.Role) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	for i := range user.Token_families {
+		user.Token_families[i].Revoked = true
+	}
+	return nil
+}
+
+func (store *MemoryStore) AddProductToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	product, ok := store.products[productID]
+	if !ok {
+		return ErrCantFindProduct
+	}
+	if product.Archived {
+		return ErrProductArchived
+	}
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return err
+	}
+
+	if quantity < 1 {
+		return ErrInvalidQuantity
+	}
+
+	line := carts.Find(user.UserCart, productID, sku)
+	inCart := 0
+	if line >= 0 {
+		inCart = user.UserCart[line].Quantity
+	}
+	if err = checkStock(product, sku, inCart+quantity); err != nil {
+		return err
+	}
+
+	touchUserCart(user)
+	if line >= 0 {
+		user.UserCart[line].Quantity += quantity
+		return nil
+	}
+
+	item := productToCartItem(product, variant)
+	item.Quantity = quantity
+	user.UserCart = append(user.UserCart, item)
+	return nil
+}
+
+func (store *MemoryStore) SetCartItemQuantity(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return store.RemoveCartItem(ctx, productID, sku, userID)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	line := carts.Find(user.UserCart, productID, sku)
+	if line < 0 {
+		return ErrItemNotInCart
+	}
+
+	product, ok := store.products[productID]
+	if !ok {
+		return ErrCantFindProduct
+	}
+	if err = checkStock(product, sku, quantity); err != nil {
+		return err
+	}
+
+	user.UserCart[line].Quantity = quantity
+	touchUserCart(user)
+	return nil
+}
+
+func (store *MemoryStore) DecrementCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	line := carts.Find(user.UserCart, productID, sku)
+	if line < 0 {
+		return ErrItemNotInCart
+	}
+
+	touchUserCart(user)
+	if user.UserCart[line].Quantity > 1 {
+		user.UserCart[line].Quantity--
+		return nil
+	}
+
+	user.UserCart = append(user.UserCart[:line:line], user.UserCart[line+1:]...)
+	return nil
+}
+
+func (store *MemoryStore) RemoveCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	user.UserCart = carts.Remove(user.UserCart, productID, sku)
+	touchUserCart(user)
+	return nil
+}
+
+func (store *MemoryStore) GetCart(ctx context.Context, userID string) ([]models.ProductUser, error) {
+	user, err := store.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.UserCart, nil
+}
+
+func (store *MemoryStore) CartTotal(ctx context.Context, userID string) (models.Money, error) {
+	cart, err := store.GetCart(ctx, userID)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	return pricing.Subtotal(cart)
+}
+
+func (store *MemoryStore) QuoteCart(ctx context.Context, userID string, address *models.Address) (models.Quote, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	coupon, err := store.cartCoupon(user.Cart_coupon)
+	return quoteCart(store.pricing, userID, store.withTaxClasses(user.UserCart), coupon, err, address)
+}
+
+// cartCoupon looks up the coupon applied to a cart, nil when there is none.
+// The caller must hold the lock.
+func (store *MemoryStore) cartCoupon(code *string) (*models.Coupon, error) {
+	if code == nil {
+		return nil, nil
+	}
+
+	coupon := store.couponByCode(*code)
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+	return coupon, nil
+}
+
+func (store *MemoryStore) SetCartCoupon(ctx context.Context, userID string, code *string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	user.Cart_coupon = code
+	touchUserCart(user)
+	return nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go-com/models"
+)
+
+func (store *MemoryStore) AbandonedCarts(ctx context.Context, idleSince time.Time, limit int) ([]models.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	users := make([]models.User, 0)
+	for _, user := range store.users {
+		if len(user.UserCart) == 0 || user.Cart_updated_at == nil || !user.Cart_updated_at.Before(idleSince) {
+			continue
+		}
+		if user.Cart_reminded_at != nil && !user.Cart_reminded_at.Before(*user.Cart_updated_at) {
+			continue
+		}
+		users = append(users, copyUser(user))
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Cart_updated_at.Before(*users[j].Cart_updated_at)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (store *MemoryStore) MarkCartReminded(ctx context.Context, userID string, at time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	user.Cart_reminded_at = &at
+	return nil
+}
+
+func (store *MemoryStore) PurgeGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var purged int64
+	for token, cart := range store.guests {
+		if cart.Updated_at.Before(before) {
+			delete(store.guests, token)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// updateAddresses runs change on the user's address book under the lock
+func (store *MemoryStore) updateAddresses(userID string, change func([]models.Address) ([]models.Address, error)) ([]models.Address, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := change(append([]models.Address{}, user.Address_Details...))
+	if err != nil {
+		return nil, err
+	}
+
+	user.Address_Details = book
+	return append([]models.Address{}, book...), nil
+}
+
+func (store *MemoryStore) AddAddress(ctx context.Context, userID string, address models.Address) (models.Address, error) {
+	book, err := store.updateAddresses(userID, func(book []models.Address) ([]models.Address, error) {
+		return addAddress(book, address), nil
+	})
+	if err != nil {
+		return address, err
+	}
+
+	return book[addressIndex(book, address.Address_id)], nil
+}
+
+func (store *MemoryStore) ListAddresses(ctx context.Context, userID string) ([]models.Address, error) {
+	user, err := store.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Address_Details, nil
+}
+
+func (store *MemoryStore) FindAddress(ctx context.Context, userID string, addressID primitive.ObjectID) (models.Address, error) {
+	book, err := store.ListAddresses(ctx, userID)
+	if err != nil {
+		return models.Address{}, err
+	}
+
+	index := addressIndex(book, addressID)
+	if index < 0 {
+		return models.Address{}, ErrAddressNotFound
+	}
+
+	return book[index], nil
+}
+
+func (store *MemoryStore) UpdateAddress(ctx context.Context, userID string, address models.Address) (models.Address, error) {
+	book, err := store.updateAddresses(userID, func(book []models.Address) ([]models.Address, error) {
+		return replaceAddress(book, address)
+	})
+	if err != nil {
+		return address, err
+	}
+
+	return book[addressIndex(book, address.Address_id)], nil
+}
+
+func (store *MemoryStore) DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error {
+	_, err := store.updateAddresses(userID, func(book []models.Address) ([]models.Address, error) {
+		return removeAddress(book, addressID)
+	})
+
+	return err
+}
+
+func (store *MemoryStore) DeleteAddresses(ctx context.Context, userID string) error {
+	_, err := store.updateAddresses(userID, func([]models.Address) ([]models.Address, error) {
+		return make([]models.Address, 0), nil
+	})
+
+	return err
+}
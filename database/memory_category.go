@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// slugTaken reports whether another category has the slug. The caller must hold the lock.
+func (store *MemoryStore) slugTaken(slug string, categoryID primitive.ObjectID) bool {
+	for _, category := range store.categories {
+		if category.Slug == slug && category.Category_id != categoryID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (store *MemoryStore) InsertCategory(ctx context.Context, category models.Category) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.slugTaken(category.Slug, category.Category_id) {
+		return ErrCategorySlugTaken
+	}
+
+	store.categories[category.Category_id] = category
+	return nil
+}
+
+func (store *MemoryStore) FindCategory(ctx context.Context, categoryID primitive.ObjectID) (models.Category, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	category, ok := store.categories[categoryID]
+	if !ok {
+		return category, ErrCategoryNotFound
+	}
+
+	return category, nil
+}
+
+func (store *MemoryStore) FindCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, category := range store.categories {
+		if category.Slug == slug {
+			return category, nil
+		}
+	}
+
+	return models.Category{}, ErrCategoryNotFound
+}
+
+func (store *MemoryStore) ListCategories(ctx context.Context) ([]models.Category, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.categoryList(), nil
+}
+
+// categoryList returns every category. The caller must hold the lock.
+func (store *MemoryStore) categoryList() []models.Category {
+	list := make([]models.Category, 0, len(store.categories))
+	for _, category := range store.categories {
+		list = append(list, category)
+	}
+
+	return list
+}
+
+func (store *MemoryStore) UpdateCategory(ctx context.Context, category models.Category) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	existing, ok := store.categories[category.Category_id]
+	if !ok {
+		return ErrCategoryNotFound
+	}
+	if store.slugTaken(category.Slug, category.Category_id) {
+		return ErrCategorySlugTaken
+	}
+
+	existing.Name = category.Name
+	existing.Slug = category.Slug
+	existing.Parent_id = category.Parent_id
+	existing.Updated_at = category.Updated_at
+	store.categories[category.Category_id] = existing
+	return nil
+}
+
+func (store *MemoryStore) DeleteCategory(ctx context.Context, categoryID primitive.ObjectID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.categories[categoryID]; !ok {
+		return ErrCategoryNotFound
+	}
+	for _, category := range store.categories {
+		if category.Parent_id != nil && *category.Parent_id == categoryID {
+			return ErrCategoryHasChildren
+		}
+	}
+
+	delete(store.categories, categoryID)
+	for productID, product := range store.products {
+		kept := make([]primitive.ObjectID, 0, len(product.Categories))
+		for _, id := range product.Categories {
+			if id != categoryID {
+				kept = append(kept, id)
+			}
+		}
+		product.Categories = kept
+		store.products[productID] = product
+	}
+
+	return nil
+}
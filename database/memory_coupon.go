@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// copyCoupon returns a copy of the coupon that shares no map with the store
+func copyCoupon(coupon *models.Coupon) models.Coupon {
+	copied := *coupon
+	copied.Used_by = make(map[string]int, len(coupon.Used_by))
+	for userID, uses := range coupon.Used_by {
+		copied.Used_by[userID] = uses
+	}
+	return copied
+}
+
+// couponByCode finds a coupon by its code. The caller must hold the lock.
+func (store *MemoryStore) couponByCode(code string) *models.Coupon {
+	for _, coupon := range store.coupons {
+		if coupon.Code == code {
+			return coupon
+		}
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) InsertCoupon(ctx context.Context, coupon models.Coupon) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.couponByCode(coupon.Code) != nil {
+		return ErrCouponCodeTaken
+	}
+
+	copied := copyCoupon(&coupon)
+	store.coupons[coupon.Coupon_id] = &copied
+	return nil
+}
+
+func (store *MemoryStore) FindCoupon(ctx context.Context, couponID primitive.ObjectID) (models.Coupon, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	coupon, ok := store.coupons[couponID]
+	if !ok {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+
+	return copyCoupon(coupon), nil
+}
+
+func (store *MemoryStore) FindCouponByCode(ctx context.Context, code string) (models.Coupon, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	coupon := store.couponByCode(code)
+	if coupon == nil {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+
+	return copyCoupon(coupon), nil
+}
+
+func (store *MemoryStore) ListCoupons(ctx context.Context) ([]models.Coupon, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	list := make([]models.Coupon, 0, len(store.coupons))
+	for _, coupon := range store.coupons {
+		list = append(list, copyCoupon(coupon))
+	}
+
+	return list, nil
+}
+
+func (store *MemoryStore) UpdateCoupon(ctx context.Context, coupon models.Coupon) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	existing, ok := store.coupons[coupon.Coupon_id]
+	if !ok {
+		return ErrCouponNotFound
+	}
+
+	if other := store.couponByCode(coupon.Code); other != nil && other != existing {
+		return ErrCouponCodeTaken
+	}
+
+	// Usage counters and the creation time stay as they are
+	updated := copyCoupon(existing)
+	updated.Code = coupon.Code
+	updated.Type = coupon.Type
+	updated.Percent = coupon.Percent
+	updated.Amount = coupon.Amount
+	updated.Min_cart_value = coupon.Min_cart_value
+	updated.Expires_at = coupon.Expires_at
+	updated.Max_uses = coupon.Max_uses
+	updated.Max_uses_per_user = coupon.Max_uses_per_user
+	updated.Active = coupon.Active
+	updated.Updated_at = coupon.Updated_at
+	*existing = updated
+	return nil
+}
+
+func (store *MemoryStore) DeleteCoupon(ctx context.Context, couponID primitive.ObjectID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.coupons[couponID]; !ok {
+		return ErrCouponNotFound
+	}
+
+	delete(store.coupons, couponID)
+	return nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-com/carts"
+	"go-com/models"
+	"go-com/pricing"
+)
+
+func (store *MemoryStore) InsertGuestCart(ctx context.Context, cart models.GuestCart) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cart.UserCart = append([]models.ProductUser{}, cart.UserCart...)
+	store.guests[cart.Token] = &cart
+	return nil
+}
+
+func (store *MemoryStore) GuestCarts() CartStore {
+	return guestCarts{backend: store}
+}
+
+func (store *MemoryStore) pricingEngine() *pricing.Engine {
+	return store.pricing
+}
+
+// guest looks a guest cart up by its token, dropping it once it expired. The
+// caller must hold the write lock.
+func (store *MemoryStore) guest(token string) (*models.GuestCart, error) {
+	cart, ok := store.guests[token]
+	if !ok {
+		return nil, ErrGuestCartNotFound
+	}
+	if carts.Expired(*cart, time.Now()) {
+		delete(store.guests, token)
+		return nil, ErrGuestCartNotFound
+	}
+
+	return cart, nil
+}
+
+func (store *MemoryStore) findGuestCart(ctx context.Context, token string) (models.GuestCart, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cart, err := store.guest(token)
+	if err != nil {
+		return models.GuestCart{}, err
+	}
+
+	copied := *cart
+	copied.UserCart = append([]models.ProductUser{}, cart.UserCart...)
+	return copied, nil
+}
+
+func (store *MemoryStore) updateGuestCart(ctx context.Context, token string, mutate func(*models.GuestCart) error) (models.GuestCart, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cart, err := store.guest(token)
+	if err != nil {
+		return models.GuestCart{}, err
+	}
+
+	updated := *cart
+	updated.UserCart = append([]models.ProductUser{}, cart.UserCart...)
+	if err = mutate(&updated); err != nil {
+		return updated, err
+	}
+	updated.Updated_at = time.Now()
+
+	*cart = updated
+	updated.UserCart = append([]models.ProductUser{}, cart.UserCart...)
+	return updated, nil
+}
+
+func (store *MemoryStore) MergeGuestCart(ctx context.Context, token string, userID string, strategy carts.MergeStrategy) ([]models.ProductUser, error) {
+	guest, err := store.claimGuestCart(token, userID)
+	if err != nil {
+		return nil, err
+	}
+	stock := guestStock(ctx, store, guest.UserCart)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.UserCart = carts.Merge(user.UserCart, guest.UserCart, strategy, stock)
+	if user.Cart_coupon == nil {
+		user.Cart_coupon = guest.Cart_coupon
+	}
+	now := time.Now()
+	user.Updated_at = now
+	user.Cart_updated_at = &now
+
+	return append([]models.ProductUser{}, user.UserCart...), nil
+}
+
+// claimGuestCart takes the guest cart out of the store for the user to merge
+// it, so it can only be merged once
+func (store *MemoryStore) claimGuestCart(token string, userID string) (models.GuestCart, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := store.user(userID); err != nil {
+		return models.GuestCart{}, err
+	}
+	cart, err := store.guest(token)
+	if err != nil {
+		return models.GuestCart{}, err
+	}
+	delete(store.guests, token)
+
+	return *cart, nil
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/orders"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// copyOrder returns a copy of the order that shares no slices with the store
+func copyOrder(order *models.Order) models.Order {
+	copied := *order
+	copied.Order_cart = append([]models.ProductUser{}, order.Order_cart...)
+	copied.Status_history = append([]models.StatusChange{}, order.Status_history...)
+	copied.Payment_method.Events = append([]models.PaymentEvent{}, order.Payment_method.Events...)
+	copied.History = append([]models.OrderEvent{}, order.History...)
+	copied.Tax_lines = append([]models.TaxLine{}, order.Tax_lines...)
+	return copied
+}
+
+// cartOrder prices the user's cart into an order. The caller must hold the lock.
+func (store *MemoryStore) cartOrder(userID string, shipping *models.Address) (models.Order, *models.Coupon, error) {
+	user, err := store.user(userID)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if len(user.UserCart) == 0 {
+		return models.Order{}, nil, ErrCartIsEmpty
+	}
+
+	coupon, err := store.cartCoupon(user.Cart_coupon)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	order, err := newOrder(store.pricing, userID, store.withTaxClasses(user.UserCart), coupon, shipping)
+	return order, coupon, err
+}
+
+// withTaxClasses gives the lines the tax class their products have now. The
+// caller must hold the lock.
+func (store *MemoryStore) withTaxClasses(lines []models.ProductUser) []models.ProductUser {
+	products := make([]models.Product, 0, len(lines))
+	for _, item := range lines {
+		if product, ok := store.products[item.Product_id]; ok {
+			products = append(products, product)
+		}
+	}
+
+	return withTaxClasses(lines, products)
+}
+
+// instantOrder prices a single product, or variant, into an order. The caller must hold the lock.
+func (store *MemoryStore) instantOrder(productID primitive.ObjectID, sku string, userID string, shipping *models.Address) (models.Order, error) {
+	if _, err := store.user(userID); err != nil {
+		return models.Order{}, err
+	}
+
+	product, ok := store.products[productID]
+	if !ok {
+		return models.Order{}, ErrCantFindProduct
+	}
+	if product.Archived {
+		return models.Order{}, ErrProductArchived
+	}
+
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	item := productToCartItem(product, variant)
+	item.Quantity = 1
+	return newOrder(store.pricing, userID, []models.ProductUser{item}, nil, shipping)
+}
+
+func (store *MemoryStore) PreviewCart(ctx context.Context, userID string, shipping *models.Address) (models.Order, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	order, _, err := store.cartOrder(userID, shipping)
+	return order, err
+}
+
+func (store *MemoryStore) PreviewInstantBuy(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address) (models.Order, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.instantOrder(productID, sku, userID, shipping)
+}
+
+// The memory store holds its lock for the whole checkout, which gives the same
+// all-or-nothing behaviour as the mongo transaction
+func (store *MemoryStore) BuyItemFromCart(ctx context.Context, userID string, shipping *models.Address, payment models.Payment) (models.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	order, coupon, err := store.cartOrder(userID, shipping)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if err = attachPayment(&order, payment); err != nil {
+		return models.Order{}, err
+	}
+
+	if err = store.reserveStock(order.Order_cart); err != nil {
+		return models.Order{}, err
+	}
+
+	// Nothing can fail from here on, so the coupon use is counted last
+	if coupon != nil {
+		coupon.Used_count++
+		coupon.Used_by[userID]++
+	}
+
+	user, _ := store.user(userID)
+	store.orders[order.Order_id] = &order
+	user.UserCart = make([]models.ProductUser, 0)
+	user.Cart_coupon = nil
+	touchUserCart(user)
+	return copyOrder(&order), nil
+}
+
+func (store *MemoryStore) InstantBuyer(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address, payment models.Payment) (models.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	order, err := store.instantOrder(productID, sku, userID, shipping)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if err = attachPayment(&order, payment); err != nil {
+		return models.Order{}, err
+	}
+
+	if err = store.reserveStock(order.Order_cart); err != nil {
+		return models.Order{}, err
+	}
+
+	store.orders[order.Order_id] = &order
+	return copyOrder(&order), nil
+}
+
+// reserveStock takes the lines off the product and variant stock, either all
+// of them or, when anything is short, none. The caller must hold the lock.
+func (store *MemoryStore) reserveStock(lines []models.ProductUser) error {
+	type stockKey struct {
+		productID primitive.ObjectID
+		sku       string
+	}
+	wanted := make(map[stockKey]int)
+	for _, item := range lines {
+		wanted[stockKey{item.Product_id, item.Sku}] += item.Quantity
+	}
+
+	for key, quantity := range wanted {
+		product, ok := store.products[key.productID]
+		if !ok {
+			return ErrCantFindProduct
+		}
+		if product.Archived {
+			return ErrProductArchived
+		}
+		if err := checkStock(product, key.sku, quantity); err != nil {
+			return err
+		}
+	}
+
+	for key, quantity := range wanted {
+		product := copyProduct(store.products[key.productID])
+		product.Stock -= quantity
+		if variant, _ := catalog.FindVariant(product, key.sku); variant != nil {
+			variant.Stock -= quantity
+		}
+		store.products[key.productID] = product
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) FindOrder(ctx context.Context, orderID primitive.ObjectID) (models.Order, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	order, ok := store.orders[orderID]
+	if !ok {
+		return models.Order{}, ErrOrderNotFound
+	}
+
+	return copyOrder(order), nil
+}
+
+func (store *MemoryStore) UpdateOrderStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus) (models.Order, error) {
+	return store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+		return orders.Transition(order, status, time.Now())
+	})
+}
+
+func (store *MemoryStore) UpdateOrder(ctx context.Context, orderID primitive.ObjectID, mutate func(*models.Order) error) (models.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	order, ok := store.orders[orderID]
+	if !ok {
+		return models.Order{}, ErrOrderNotFound
+	}
+
+	updated := copyOrder(order)
+	if err := mutate(&updated); err != nil {
+		return updated, err
+	}
+	updated.Order_id = orderID
+
+	*order = updated
+	return copyOrder(order), nil
+}
+
+func (store *MemoryStore) ListOrders(ctx context.Context, query orders.Query) (orders.Page, error) {
+	if err := query.Normalize(); err != nil {
+		return orders.Page{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	matching := make([]models.Order, 0)
+	for _, order := range store.orders {
+		if orders.Matches(*order, query) {
+			matching = append(matching, copyOrder(order))
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return orders.Less(matching[i], matching[j])
+	})
+
+	page := orders.Page{Orders: make([]models.Order, 0, query.Limit), Total: int64(len(matching))}
+	for _, order := range matching {
+		if !orders.After(order, query) {
+			continue
+		}
+		if len(page.Orders) == query.Limit {
+			page.Next_cursor = orders.CursorFor(page.Orders[query.Limit-1]).Encode()
+			break
+		}
+		page.Orders = append(page.Orders, order)
+	}
+
+	return page, nil
+}
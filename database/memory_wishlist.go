@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (store *MemoryStore) FindProducts(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	products := make([]models.Product, 0, len(productIDs))
+	for _, productID := range productIDs {
+		if product, ok := store.products[productID]; ok {
+			products = append(products, copyProduct(product))
+		}
+	}
+
+	return products, nil
+}
+
+// wishlistIndex returns the index of the product, or its variant, on the wishlist or -1
+func wishlistIndex(wishlist []models.WishlistItem, productID primitive.ObjectID, sku string) int {
+	for i, item := range wishlist {
+		if item.Product_id == productID && item.Sku == sku {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (store *MemoryStore) AddToWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	product, ok := store.products[productID]
+	if !ok {
+		return ErrCantFindProduct
+	}
+	if err = wishlistProduct(product, sku); err != nil {
+		return err
+	}
+
+	if wishlistIndex(user.Wishlist, productID, sku) < 0 {
+		user.Wishlist = append(user.Wishlist, models.WishlistItem{Product_id: productID, Sku: sku, Added_at: time.Now()})
+	}
+	return nil
+}
+
+func (store *MemoryStore) RemoveFromWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	line := wishlistIndex(user.Wishlist, productID, sku)
+	if line < 0 {
+		return ErrItemNotInWishlist
+	}
+
+	user.Wishlist = append(user.Wishlist[:line:line], user.Wishlist[line+1:]...)
+	return nil
+}
+
+func (store *MemoryStore) GetWishlist(ctx context.Context, userID string) ([]models.WishlistItem, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.WishlistItem{}, user.Wishlist...), nil
+}
+
+func (store *MemoryStore) MoveToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	if quantity < 1 {
+		return ErrInvalidQuantity
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	wished := wishlistIndex(user.Wishlist, productID, sku)
+	if wished < 0 {
+		return ErrItemNotInWishlist
+	}
+
+	product, ok := store.products[productID]
+	if !ok {
+		return ErrCantFindProduct
+	}
+	if product.Archived {
+		return ErrProductArchived
+	}
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return err
+	}
+
+	line := carts.Find(user.UserCart, productID, sku)
+	inCart := 0
+	if line >= 0 {
+		inCart = user.UserCart[line].Quantity
+	}
+	if err = checkStock(product, sku, inCart+quantity); err != nil {
+		return err
+	}
+
+	user.Wishlist = append(user.Wishlist[:wished:wished], user.Wishlist[wished+1:]...)
+	touchUserCart(user)
+	if line >= 0 {
+		user.UserCart[line].Quantity += quantity
+		return nil
+	}
+
+	item := productToCartItem(product, variant)
+	item.Quantity = quantity
+	user.UserCart = append(user.UserCart, item)
+	return nil
+}
+
+func (store *MemoryStore) SaveForLater(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, err := store.user(userID)
+	if err != nil {
+		return err
+	}
+
+	if carts.Find(user.UserCart, productID, sku) < 0 {
+		return ErrItemNotInCart
+	}
+
+	user.UserCart = carts.Remove(user.UserCart, productID, sku)
+	touchUserCart(user)
+	if wishlistIndex(user.Wishlist, productID, sku) < 0 {
+		user.Wishlist = append(user.Wishlist, models.WishlistItem{Product_id: productID, Sku: sku, Added_at: time.Now()})
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/models"
+	"go-com/orders"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("Order not found")
+	ErrCantUpdateOrder = errors.New("Cannot update the order")
+	ErrOrderChanged    = errors.New("Order was changed by another request")
+	ErrCantFindOrders  = errors.New("Cannot list the orders")
+)
+
+func (store *MongoStore) FindOrder(ctx context.Context, orderID primitive.ObjectID) (models.Order, error) {
+	var order models.Order
+	err := store.order_collection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, ErrOrderNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return order, ErrCantUpdateOrder
+	}
+
+	return order, nil
+}
+
+// UpdateOrderStatus moves the order to a new status following the rules in the orders package
+func (store *MongoStore) UpdateOrderStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus) (models.Order, error) {
+	return store.UpdateOrder(ctx, orderID, func(order *models.Order) error {
+		return orders.Transition(order, status, time.Now())
+	})
+}
+
+// UpdateOrder reads the order, lets mutate change it and writes it back. The
+// write only goes through while the order is still the way it was read, which
+// updated_at tells, so two admins can't overwrite each other's changes.
+func (store *MongoStore) UpdateOrder(ctx context.Context, orderID primitive.ObjectID, mutate func(*models.Order) error) (models.Order, error) {
+	order, err := store.FindOrder(ctx, orderID)
+	if err != nil {
+		return order, err
+	}
+
+	read := order.Updated_at
+	if err = mutate(&order); err != nil {
+		return order, err
+	}
+	order.Order_id = orderID
+
+	filter := bson.D{{Key: "_id", Value: orderID}, {Key: "updated_at", Value: read}}
+	result, err := store.order_collection.ReplaceOne(ctx, filter, order)
+	if err != nil {
+		log.Println(err)
+		return order, ErrCantUpdateOrder
+	}
+	if result.MatchedCount == 0 {
+		return order, ErrOrderChanged
+	}
+
+	return order, nil
+}
+
+// ListOrders returns one page of a user's orders, latest first
+func (store *MongoStore) ListOrders(ctx context.Context, query orders.Query) (orders.Page, error) {
+	if err := query.Normalize(); err != nil {
+		return orders.Page{}, err
+	}
+
+	filter := bson.M{"user_id": query.User_id}
+	if len(query.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": query.Statuses}
+	}
+	if query.From != nil || query.To != nil {
+		placed := bson.M{}
+		if query.From != nil {
+			placed["$gte"] = *query.From
+		}
+		if query.To != nil {
+			placed["$lt"] = *query.To
+		}
+		filter["ordered_at"] = placed
+	}
+
+	total, err := store.order_collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return orders.Page{}, ErrCantFindOrders
+	}
+
+	if last := query.After; last != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"ordered_at": bson.M{"$lt": last.Ordered_at}},
+			bson.M{"ordered_at": last.Ordered_at, "_id": bson.M{"$lt": last.ID}},
+		}}}}
+	}
+
+	// One more than the page tells whether there is a next page
+	opts := options.Find().SetSort(bson.D{{Key: "ordered_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(query.Limit) + 1)
+	cursor, err := store.order_collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return orders.Page{}, ErrCantFindOrders
+	}
+	defer cursor.Close(ctx)
+
+	found := make([]models.Order, 0)
+	if err = cursor.All(ctx, &found); err != nil {
+		log.Println(err)
+		return orders.Page{}, ErrCantFindOrders
+	}
+
+	page := orders.Page{Orders: found, Total: total}
+	if len(found) > query.Limit {
+		page.Orders = found[:query.Limit]
+		page.Next_cursor = orders.CursorFor(page.Orders[query.Limit-1]).Encode()
+	}
+
+	return page, nil
+}
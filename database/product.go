@@ -0,0 +1,505 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-com/catalog"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidStock    = errors.New("Stock can't go below zero")
+	ErrProductArchived = errors.New("Product is no longer sold")
+	ErrProductChanged  = errors.New("Product was changed by another request")
+)
+
+// forSale leaves out archived products. Products from before archiving existed have no archived field.
+var forSale = bson.M{"archived": bson.M{"$ne": true}}
+
+func (store *MongoStore) InsertProduct(ctx context.Context, product models.Product) error {
+	_, err := store.prod_collection.InsertOne(ctx, product)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (store *MongoStore) FindProduct(ctx context.Context, productID primitive.ObjectID) (models.Product, error) {
+	var product models.Product
+	err := store.prod_collection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return product, ErrCantFindProduct
+	}
+	if err != nil {
+		log.Println(err)
+		return product, ErrCantDecodeProducts
+	}
+
+	return product, nil
+}
+
+// sortFields are the document fields behind each sort
+var sortFields = map[catalog.SortField]string{
+	catalog.SortPrice:  "price.amount",
+	catalog.SortRating: "rating",
+	catalog.SortName:   "product_name",
+}
+
+// ListProducts returns one page of the products for sale that match the query.
+// Prices stored as bare numbers, from before prices had a currency, have no
+// price.amount and only show up in listings that don't sort or filter on price.
+func (store *MongoStore) ListProducts(ctx context.Context, query catalog.Query) (catalog.Page, error) {
+	if err := query.Normalize(); err != nil {
+		return catalog.Page{}, err
+	}
+
+	filter := productFilter(query)
+	total, err := store.prod_collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return catalog.Page{}, ErrCantFindProduct
+	}
+
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+	sort := bson.D{}
+	field, keyed := sortFields[query.Sort]
+	if keyed {
+		sort = append(sort, bson.E{Key: field, Value: direction})
+	}
+	sort = append(sort, bson.E{Key: "_id", Value: direction})
+
+	if query.After != nil {
+		filter = bson.M{"$and": bson.A{filter, afterCursor(field, keyed, *query.After)}}
+	}
+
+	// One more than the page tells whether there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(int64(query.Limit) + 1)
+	products, err := store.findProducts(ctx, filter, opts)
+	if err != nil {
+		return catalog.Page{}, err
+	}
+
+	page := catalog.Page{Products: products, Total: total}
+	if len(products) > query.Limit {
+		page.Products = products[:query.Limit]
+		page.Next_cursor = catalog.CursorFor(page.Products[query.Limit-1], query).Encode()
+	}
+	if query.Facets {
+		facets, err := store.searchFacets(ctx, productFilter(query), query.Currency)
+		if err != nil {
+			return catalog.Page{}, err
+		}
+		page.Facets = &facets
+	}
+
+	return page, nil
+}
+
+// productFilter matches the products for sale that pass the query's filters.
+// The name is escaped, so it is only ever matched as plain text.
+func productFilter(query catalog.Query) bson.M {
+	filter := bson.M{"archived": forSale["archived"]}
+	if query.Name != "" {
+		filter["product_name"] = bson.M{"$regex": regexp.QuoteMeta(query.Name), "$options": "i"}
+	}
+	if query.Min_price != nil || query.Max_price != nil {
+		amount := bson.M{}
+		if query.Min_price != nil {
+			amount["$gte"] = *query.Min_price
+		}
+		if query.Max_price != nil {
+			amount["$lte"] = *query.Max_price
+		}
+		filter["price.amount"] = amount
+		filter["price.currency"] = query.Currency
+	}
+	if query.Min_rating != nil {
+		filter["rating"] = bson.M{"$gte": *query.Min_rating}
+	}
+	if len(query.Categories) > 0 {
+		filter["categories"] = bson.M{"$in": query.Categories}
+	}
+
+	return filter
+}
+
+// SearchProducts ranks the products for sale by MongoDB's text score over their
+// name and description. It needs the text index EnsureIndexes creates.
+func (store *MongoStore) SearchProducts(ctx context.Context, query catalog.Query) (catalog.SearchPage, error) {
+	if err := query.Normalize(); err != nil {
+		return catalog.SearchPage{}, err
+	}
+	if len(query.Terms) == 0 {
+		return catalog.SearchPage{}, catalog.ErrInvalidSearch
+	}
+
+	// The terms are plain words, joined by spaces any of them can match
+	filter := productFilter(query)
+	filter["$text"] = bson.M{"$search": strings.Join(query.Terms, " ")}
+
+	total, err := store.prod_collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return catalog.SearchPage{}, ErrCantFindProduct
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+	}
+	if last := query.After; last != nil {
+		if last.Score == nil {
+			return catalog.SearchPage{}, catalog.ErrInvalidCursor
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"score": bson.M{"$lt": *last.Score}},
+			bson.M{"score": *last.Score, "_id": bson.M{"$lt": last.ID}},
+		}}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}}},
+		bson.D{{Key: "$limit", Value: query.Limit + 1}},
+	)
+
+	cursor, err := store.prod_collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		return catalog.SearchPage{}, ErrCantFindProduct
+	}
+	defer cursor.Close(ctx)
+
+	var scored []struct {
+		models.Product `bson:",inline"`
+		Score          float64 `bson:"score"`
+	}
+	if err = cursor.All(ctx, &scored); err != nil {
+		log.Println(err)
+		return catalog.SearchPage{}, ErrCantDecodeProducts
+	}
+
+	facets, err := store.searchFacets(ctx, filter, query.Currency)
+	if err != nil {
+		return catalog.SearchPage{}, err
+	}
+
+	page := catalog.SearchPage{Results: make([]catalog.SearchResult, 0, len(scored)), Total: total, Facets: facets}
+	for _, found := range scored {
+		if len(page.Results) == query.Limit {
+			page.Next_cursor = catalog.ResultCursor(page.Results[query.Limit-1]).Encode()
+			break
+		}
+		page.Results = append(page.Results, catalog.NewSearchResult(found.Product, found.Score, query.Terms))
+	}
+
+	return page, nil
+}
+
+// searchFacets counts everything the filter matches in one $facet stage. Products
+// are grouped by their exact set of categories, which catalog.NewFacets rolls up
+// the category tree.
+func (store *MongoStore) searchFacets(ctx context.Context, filter bson.M, currency string) (catalog.Facets, error) {
+	boundaries := catalog.PriceBoundaries(currency)
+	bucketBoundaries := bson.A{}
+	for _, boundary := range boundaries {
+		bucketBoundaries = append(bucketBoundaries, boundary)
+	}
+	bucketBoundaries = append(bucketBoundaries, int64(math.MaxInt64))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"categories": bson.A{
+				bson.M{"$group": bson.M{"_id": "$categories", "count": bson.M{"$sum": 1}}},
+			},
+			"price": bson.A{
+				bson.M{"$match": bson.M{"price.currency": currency, "price.amount": bson.M{"$gte": 0}}},
+				bson.M{"$bucket": bson.M{"groupBy": "$price.amount", "boundaries": bucketBoundaries, "output": bson.M{"count": bson.M{"$sum": 1}}}},
+			},
+			"rating": bson.A{
+				bson.M{"$match": bson.M{"rating": bson.M{"$ne": nil}}},
+				bson.M{"$group": bson.M{"_id": "$rating", "count": bson.M{"$sum": 1}}},
+			},
+		}}},
+	}
+
+	cursor, err := store.prod_collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		return catalog.Facets{}, ErrCantFindProduct
+	}
+	defer cursor.Close(ctx)
+
+	var counted []struct {
+		Categories []catalog.CategoryCombination `bson:"categories"`
+		Price      []struct {
+			Min   int64 `bson:"_id"`
+			Count int64 `bson:"count"`
+		} `bson:"price"`
+		Rating []struct {
+			Rating int   `bson:"_id"`
+			Count  int64 `bson:"count"`
+		} `bson:"rating"`
+	}
+	if err = cursor.All(ctx, &counted); err != nil || len(counted) != 1 {
+		log.Println(err)
+		return catalog.Facets{}, ErrCantDecodeProducts
+	}
+
+	categories, err := store.ListCategories(ctx)
+	if err != nil {
+		return catalog.Facets{}, err
+	}
+
+	priceCounts := make(map[int64]int64)
+	for _, bucket := range counted[0].Price {
+		priceCounts[bucket.Min] = bucket.Count
+	}
+	ratingCounts := make(map[int]int64)
+	for _, rating := range counted[0].Rating {
+		ratingCounts[rating.Rating] = rating.Count
+	}
+
+	return catalog.NewFacets(counted[0].Categories, priceCounts, ratingCounts, categories, currency), nil
+}
+
+// afterCursor matches the products that sort after the cursor. MongoDB sorts a
+// missing value before every other value, so in a descending listing products
+// without the field come last.
+func afterCursor(field string, keyed bool, cursor catalog.Cursor) bson.M {
+	after := "$gt"
+	if cursor.Descending {
+		after = "$lt"
+	}
+	if !keyed {
+		return bson.M{"_id": bson.M{after: cursor.ID}}
+	}
+
+	var value interface{}
+	switch {
+	case cursor.Number != nil:
+		value = *cursor.Number
+	case cursor.Text != nil:
+		value = *cursor.Text
+	}
+
+	if value == nil {
+		if cursor.Descending {
+			return bson.M{field: nil, "_id": bson.M{after: cursor.ID}}
+		}
+		return bson.M{"$or": bson.A{
+			bson.M{field: bson.M{"$ne": nil}},
+			bson.M{field: nil, "_id": bson.M{after: cursor.ID}},
+		}}
+	}
+
+	branches := bson.A{
+		bson.M{field: bson.M{after: value}},
+		bson.M{field: value, "_id": bson.M{after: cursor.ID}},
+	}
+	if cursor.Descending {
+		branches = append(branches, bson.M{field: nil})
+	}
+	return bson.M{"$or": branches}
+}
+
+func (store *MongoStore) findProducts(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]models.Product, error) {
+	cursor, err := store.prod_collection.Find(ctx, filter, opts...)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantFindProduct
+	}
+	defer cursor.Close(ctx)
+
+	products := make([]models.Product, 0)
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	return products, nil
+}
+
+// SetStock overwrites the stock level of a product, or of one of its variants.
+// The product's own stock is the total of its variants and moves along with them.
+func (store *MongoStore) SetStock(ctx context.Context, productID primitive.ObjectID, sku string, stock int) (models.Product, error) {
+	if stock < 0 {
+		return models.Product{}, ErrInvalidStock
+	}
+
+	product, err := store.FindProduct(ctx, productID)
+	if err != nil {
+		return product, err
+	}
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return product, err
+	}
+	if variant == nil {
+		return store.updateStock(ctx, bson.M{"_id": productID}, bson.M{"$set": bson.M{"stock": stock}})
+	}
+
+	// The variant is only set while it still has the stock the total was worked out from
+	filter := bson.M{"_id": productID, "variants": bson.M{"$elemMatch": bson.M{"sku": sku, "stock": variant.Stock}}}
+	update := bson.M{"$set": bson.M{"variants.$.stock": stock}, "$inc": bson.M{"stock": stock - variant.Stock}}
+	product, err = store.updateStock(ctx, filter, update)
+	if errors.Is(err, ErrCantFindProduct) {
+		return product, ErrProductChanged
+	}
+
+	return product, err
+}
+
+// AdjustStock adds delta to the stock level of a product, or of one of its
+// variants. A negative delta is only applied when enough stock is left, so
+// stock never drops below zero.
+func (store *MongoStore) AdjustStock(ctx context.Context, productID primitive.ObjectID, sku string, delta int) (models.Product, error) {
+	product, err := store.FindProduct(ctx, productID)
+	if err != nil {
+		return product, err
+	}
+	if _, err = catalog.FindVariant(product, sku); err != nil {
+		return product, err
+	}
+
+	filter := bson.M{"_id": productID}
+	update := bson.M{"$inc": bson.M{"stock": delta}}
+	if delta < 0 {
+		filter["stock"] = bson.M{"$gte": -delta}
+	}
+	if sku != "" {
+		variant := bson.M{"sku": sku}
+		if delta < 0 {
+			variant["stock"] = bson.M{"$gte": -delta}
+		}
+		filter["variants"] = bson.M{"$elemMatch": variant}
+		update = bson.M{"$inc": bson.M{"stock": delta, "variants.$.stock": delta}}
+	}
+
+	product, err = store.updateStock(ctx, filter, update)
+	if errors.Is(err, ErrCantFindProduct) {
+		// The product was there a moment ago, so there wasn't enough stock left
+		return product, ErrInvalidStock
+	}
+
+	return product, err
+}
+
+func (store *MongoStore) updateStock(ctx context.Context, filter, update interface{}) (models.Product, error) {
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := store.prod_collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return product, ErrCantFindProduct
+	}
+	if err != nil {
+		log.Println(err)
+		return product, err
+	}
+
+	return product, nil
+}
+
+// UpdateProduct reads the product, lets mutate change it and writes back the fields
+// admins edit. Stock has its own methods and is left alone, variants keep the
+// stock they had. The write only goes through while the product is still the
+// way it was read, including the stock of every variant.
+func (store *MongoStore) UpdateProduct(ctx context.Context, productID primitive.ObjectID, mutate func(*models.Product) error) (models.Product, error) {
+	product, err := store.FindProduct(ctx, productID)
+	if err != nil {
+		return product, err
+	}
+
+	before := product
+	product.Variants = append([]models.Variant(nil), before.Variants...)
+	read := product.Updated_at
+	if err = mutate(&product); err != nil {
+		return product, err
+	}
+	product.Product_id = productID
+	catalog.KeepStock(&product, before)
+	product.Updated_at = time.Now()
+
+	filter := bson.M{"_id": productID, "updated_at": read}
+	if read.IsZero() {
+		filter["updated_at"] = bson.M{"$exists": false}
+	}
+	if len(before.Variants) > 0 {
+		unchanged := bson.A{bson.M{"variants": bson.M{"$size": len(before.Variants)}}}
+		for _, variant := range before.Variants {
+			unchanged = append(unchanged, bson.M{"variants": bson.M{"$elemMatch": bson.M{"sku": variant.Sku, "stock": variant.Stock}}})
+		}
+		filter["$and"] = unchanged
+	}
+	set := bson.M{
+		"product_name": product.Product_name,
+		"price":        product.Price,
+		"rating":       product.Rating,
+		"image":        product.Image,
+		"description":  product.Description,
+		"categories":   product.Categories,
+		"tax_class":    product.Tax_class,
+		"attributes":   product.Attributes,
+		"variants":     product.Variants,
+		"archived":     product.Archived,
+		"archived_at":  product.Archived_at,
+		"updated_at":   product.Updated_at,
+	}
+	if len(before.Variants) > 0 || len(product.Variants) > 0 {
+		// The total follows the variants that were added or taken away
+		set["stock"] = product.Stock
+	}
+	update := bson.M{"$set": set}
+	result, err := store.prod_collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return product, err
+	}
+	if result.MatchedCount == 0 {
+		return product, ErrProductChanged
+	}
+
+	return product, nil
+}
+
+// DeleteProduct removes the product for good and takes it out of every cart,
+// guest carts included. Orders hold their own copy of the product and are not
+// affected. Guest carts keep their updated_at, so this doesn't put off their
+// expiry, and merging one leaves out products that are gone in any case.
+func (store *MongoStore) DeleteProduct(ctx context.Context, productID primitive.ObjectID) error {
+	result, err := store.prod_collection.DeleteOne(ctx, bson.M{"_id": productID})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrCantFindProduct
+	}
+
+	pull := bson.M{"$pull": bson.M{"usercart": bson.M{"_id": productID}}}
+	if _, err = store.user_collection.UpdateMany(ctx, bson.M{"usercart._id": productID}, pull); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if _, err = store.guest_collection.UpdateMany(ctx, bson.M{"usercart._id": productID}, pull); err != nil {
+		log.Println(err)
+		return ErrCantUpdateGuestCart
+	}
+
+	return nil
+}
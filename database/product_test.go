@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func insertProduct(t *testing.T, store *MemoryStore, name string, price int64) models.Product {
+	t.Helper()
+	product := models.Product{Product_id: primitive.NewObjectID(), Product_name: &name, Price: models.NewMoney(price, "USD"), Stock: 1}
+	if err := store.InsertProduct(context.Background(), product); err != nil {
+		t.Fatal(err)
+	}
+
+	return product
+}
+
+// listAll pages through the listing two products at a time and returns the ids
+// in the order they were listed. between runs once after the first page.
+func listAll(t *testing.T, store *MemoryStore, query catalog.Query, between func()) []primitive.ObjectID {
+	t.Helper()
+	var ids []primitive.ObjectID
+	query.Limit = 2
+	for {
+		page, err := store.ListProducts(context.Background(), query)
+		if err != nil {
+			t.Fatalf("ListProducts() error = %v", err)
+		}
+		for _, product := range page.Products {
+			ids = append(ids, product.Product_id)
+		}
+		if page.Next_cursor == "" {
+			return ids
+		}
+		if query.After, err = catalog.DecodeCursor(page.Next_cursor); err != nil {
+			t.Fatalf("DecodeCursor() of the next cursor error = %v", err)
+		}
+		if between != nil {
+			between()
+			between = nil
+		}
+	}
+}
+
+func TestListProductsPagesWithEqualKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		sort       catalog.SortField
+		descending bool
+	}{
+		{"price", catalog.SortPrice, false},
+		{"price descending", catalog.SortPrice, true},
+		{"name", catalog.SortName, false},
+		{"rating", catalog.SortRating, true},
+		{"newest", catalog.SortNewest, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore(pricing.Default())
+			for i := 0; i < 7; i++ {
+				insertProduct(t, store, "Mug", 1250)
+			}
+			query := catalog.Query{Sort: test.sort, Descending: test.descending}
+
+			whole, err := store.ListProducts(context.Background(), catalog.Query{Sort: test.sort, Descending: test.descending, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged := listAll(t, store, query, nil)
+			if len(paged) != len(whole.Products) {
+				t.Fatalf("paging listed %d products, want %d", len(paged), len(whole.Products))
+			}
+			for i, id := range paged {
+				if id != whole.Products[i].Product_id {
+					t.Fatalf("paging listed %v at %d, want %v as on a single page", id, i, whole.Products[i].Product_id)
+				}
+			}
+
+			// Another product with the same key arriving between pages is
+			// listed at most once and doesn't push any other product out
+			seen := make(map[primitive.ObjectID]int)
+			for _, id := range listAll(t, store, query, func() { insertProduct(t, store, "Mug", 1250) }) {
+				seen[id]++
+			}
+			for id, count := range seen {
+				if count > 1 {
+					t.Errorf("product %v listed %d times", id, count)
+				}
+			}
+			for _, id := range paged {
+				if seen[id] == 0 {
+					t.Errorf("product %v went missing when another was added", id)
+				}
+			}
+		})
+	}
+}
+
+func TestListProductsMatchesNameLiterally(t *testing.T) {
+	store := NewMemoryStore(pricing.Default())
+	for _, name := range []string{"Blue Mug", "Mug (large)", "Price $where", "Mug.*", "Teapot"} {
+		insertProduct(t, store, name, 1250)
+	}
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"mug", 3},
+		{".*", 1},
+		{"(", 1},
+		{"(large", 1},
+		{"$where", 1},
+		{"[a-z]", 0},
+		{"Mug|Teapot", 0},
+		{`\`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := store.ListProducts(context.Background(), catalog.Query{Name: test.name})
+			if err != nil {
+				t.Fatalf("ListProducts() error = %v", err)
+			}
+			if len(page.Products) != test.want {
+				t.Errorf("ListProducts(%q) found %d products, want %d", test.name, len(page.Products), test.want)
+			}
+		})
+	}
+}
+
+func TestAdjustStockOfVariants(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(pricing.Default())
+	name := "Shirt"
+	product := models.Product{
+		Product_id:   primitive.NewObjectID(),
+		Product_name: &name,
+		Attributes:   []models.ProductAttribute{{Name: "size", Values: []string{"S", "M"}}},
+		Variants: []models.Variant{
+			{Sku: "S", Attributes: map[string]string{"size": "S"}, Price: models.NewMoney(1500, "USD"), Stock: 3},
+			{Sku: "M", Attributes: map[string]string{"size": "M"}, Price: models.NewMoney(1500, "USD"), Stock: 5},
+		},
+	}
+	catalog.RollUp(&product)
+	if err := store.InsertProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		do    func() (models.Product, error)
+		err   error
+		stock map[string]int
+	}{
+		{"sell", func() (models.Product, error) { return store.AdjustStock(ctx, product.Product_id, "S", -2) }, nil, map[string]int{"S": 1, "M": 5}},
+		{"restock", func() (models.Product, error) { return store.AdjustStock(ctx, product.Product_id, "M", 4) }, nil, map[string]int{"S": 1, "M": 9}},
+		{"oversell", func() (models.Product, error) { return store.AdjustStock(ctx, product.Product_id, "S", -2) }, ErrInvalidStock, map[string]int{"S": 1, "M": 9}},
+		{"no sku", func() (models.Product, error) { return store.AdjustStock(ctx, product.Product_id, "", -1) }, catalog.ErrVariantRequired, map[string]int{"S": 1, "M": 9}},
+		{"unknown sku", func() (models.Product, error) { return store.AdjustStock(ctx, product.Product_id, "L", 1) }, catalog.ErrVariantNotFound, map[string]int{"S": 1, "M": 9}},
+		{"set", func() (models.Product, error) { return store.SetStock(ctx, product.Product_id, "S", 6) }, nil, map[string]int{"S": 6, "M": 9}},
+	}
+
+	for _, step := range steps {
+		if _, err := step.do(); !errors.Is(err, step.err) {
+			t.Fatalf("%s: error = %v, want %v", step.name, err, step.err)
+		}
+
+		stored, err := store.FindProduct(ctx, product.Product_id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for _, variant := range stored.Variants {
+			sum += variant.Stock
+			if variant.Stock != step.stock[variant.Sku] {
+				t.Errorf("%s: stock of %s = %d, want %d", step.name, variant.Sku, variant.Stock, step.stock[variant.Sku])
+			}
+		}
+		if stored.Stock != sum {
+			t.Errorf("%s: product stock = %d, want the %d its variants add up to", step.name, stored.Stock, sum)
+		}
+	}
+}
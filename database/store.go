@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-com/carts"
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/orders"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The controllers only talk to these interfaces. MongoStore keeps everything in
+// MongoDB and MemoryStore keeps it in process, so the API can run without a database.
+
+type ProductStore interface {
+	InsertProduct(ctx context.Context, product models.Product) error
+	FindProduct(ctx context.Context, productID primitive.ObjectID) (models.Product, error)
+	FindProducts(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error)
+	ListProducts(ctx context.Context, query catalog.Query) (catalog.Page, error)
+	SearchProducts(ctx context.Context, query catalog.Query) (catalog.SearchPage, error)
+	SetStock(ctx context.Context, productID primitive.ObjectID, sku string, stock int) (models.Product, error)
+	AdjustStock(ctx context.Context, productID primitive.ObjectID, sku string, delta int) (models.Product, error)
+	UpdateProduct(ctx context.Context, productID primitive.ObjectID, mutate func(*models.Product) error) (models.Product, error)
+	DeleteProduct(ctx context.Context, productID primitive.ObjectID) error
+}
+
+type UserStore interface {
+	InsertUser(ctx context.Context, user models.User) error
+	FindUserByID(ctx context.Context, userID string) (models.User, error)
+	FindUserByEmail(ctx context.Context, email string) (models.User, error)
+	CountUsersByEmail(ctx context.Context, email string) (int64, error)
+	CountUsersByPhone(ctx context.Context, phone string) (int64, error)
+	UpdateAllTokens(ctx context.Context, signedToken, signedRefreshToken, userID string) error
+	StartTokenFamily(ctx context.Context, userID string, family models.TokenFamily) error
+	RotateRefreshToken(ctx context.Context, userID, familyID, tokenID string, next models.TokenFamily) error
+	TokenFamilyActive(ctx context.Context, userID, familyID string) (bool, error)
+	SetUserRole(ctx context.Context, userID string, role models.Role) error
+	AddAddress(ctx context.Context, userID string, address models.Address) (models.Address, error)
+	ListAddresses(ctx context.Context, userID string) ([]models.Address, error)
+	FindAddress(ctx context.Context, userID string, addressID primitive.ObjectID) (models.Address, error)
+	UpdateAddress(ctx context.Context, userID string, address models.Address) (models.Address, error)
+	DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error
+	DeleteAddresses(ctx context.Context, userID string) error
+}
+
+type CartStore interface {
+	AddProductToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error
+	RemoveCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error
+	SetCartItemQuantity(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error
+	DecrementCartItem(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error
+	GetCart(ctx context.Context, userID string) ([]models.ProductUser, error)
+	CartTotal(ctx context.Context, userID string) (models.Money, error)
+	QuoteCart(ctx context.Context, userID string, address *models.Address) (models.Quote, error)
+	SetCartCoupon(ctx context.Context, userID string, code *string) error
+}
+
+// WishlistStore keeps the products users parked for later. MoveToCart and
+// SaveForLater move an item between the wishlist and the cart in one step.
+type WishlistStore interface {
+	AddToWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error
+	RemoveFromWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error
+	GetWishlist(ctx context.Context, userID string) ([]models.WishlistItem, error)
+	MoveToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error
+	SaveForLater(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error
+}
+
+// GuestCartStore keeps the carts of visitors who haven't logged in. GuestCarts
+// works on them with the usual cart operations, taking the guest token where
+// those take the user ID, and MergeGuestCart moves one into a user's cart.
+type GuestCartStore interface {
+	InsertGuestCart(ctx context.Context, cart models.GuestCart) error
+	GuestCarts() CartStore
+	MergeGuestCart(ctx context.Context, token string, userID string, strategy carts.MergeStrategy) ([]models.ProductUser, error)
+}
+
+// AbandonedCartStore finds the carts people stopped working on, for reminding
+// them, and clears out guest carts nobody will come back for
+type AbandonedCartStore interface {
+	AbandonedCarts(ctx context.Context, idleSince time.Time, limit int) ([]models.User, error)
+	MarkCartReminded(ctx context.Context, userID string, at time.Time) error
+	PurgeGuestCarts(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OrderStore interface {
+	PreviewCart(ctx context.Context, userID string, shipping *models.Address) (models.Order, error)
+	PreviewInstantBuy(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address) (models.Order, error)
+	BuyItemFromCart(ctx context.Context, userID string, shipping *models.Address, payment models.Payment) (models.Order, error)
+	InstantBuyer(ctx context.Context, productID primitive.ObjectID, sku string, userID string, shipping *models.Address, payment models.Payment) (models.Order, error)
+	FindOrder(ctx context.Context, orderID primitive.ObjectID) (models.Order, error)
+	UpdateOrderStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus) (models.Order, error)
+	UpdateOrder(ctx context.Context, orderID primitive.ObjectID, mutate func(*models.Order) error) (models.Order, error)
+	ListOrders(ctx context.Context, query orders.Query) (orders.Page, error)
+}
+
+type CouponStore interface {
+	InsertCoupon(ctx context.Context, coupon models.Coupon) error
+	FindCoupon(ctx context.Context, couponID primitive.ObjectID) (models.Coupon, error)
+	FindCouponByCode(ctx context.Context, code string) (models.Coupon, error)
+	ListCoupons(ctx context.Context) ([]models.Coupon, error)
+	UpdateCoupon(ctx context.Context, coupon models.Coupon) error
+	DeleteCoupon(ctx context.Context, couponID primitive.ObjectID) error
+}
+
+type CategoryStore interface {
+	InsertCategory(ctx context.Context, category models.Category) error
+	FindCategory(ctx context.Context, categoryID primitive.ObjectID) (models.Category, error)
+	FindCategoryBySlug(ctx context.Context, slug string) (models.Category, error)
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	UpdateCategory(ctx context.Context, category models.Category) error
+	DeleteCategory(ctx context.Context, categoryID primitive.ObjectID) error
+}
+
+// Store is everything the Application needs. Both MongoStore and MemoryStore implement it.
+type Store interface {
+	ProductStore
+	UserStore
+	CartStore
+	WishlistStore
+	GuestCartStore
+	AbandonedCartStore
+	OrderStore
+	CouponStore
+	CategoryStore
+}
+
+var (
+	_ Store = (*MongoStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("Refresh token was already used, log in again")
+	ErrTokenFamilyRevoked = errors.New("Refresh token is no longer valid, log in again")
+)
+
+func (store *MongoStore) InsertUser(ctx context.Context, user models.User) error {
+	_, err := store.user_collection.InsertOne(ctx, user)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (store *MongoStore) FindUserByID(ctx context.Context, userID string) (models.User, error) {
+	var user models.User
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return user, ErrUserIDIsNotValid
+	}
+
+	return store.findUser(ctx, bson.M{"_id": id})
+}
+
+func (store *MongoStore) FindUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return store.findUser(ctx, bson.M{"email": email})
+}
+
+func (store *MongoStore) findUser(ctx context.Context, filter interface{}) (models.User, error) {
+	var user models.User
+	err := store.user_collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (store *MongoStore) CountUsersByEmail(ctx context.Context, email string) (int64, error) {
+	return store.user_collection.CountDocuments(ctx, bson.M{"email": email})
+}
+
+func (store *MongoStore) CountUsersByPhone(ctx context.Context, phone string) (int64, error) {
+	return store.user_collection.CountDocuments(ctx, bson.M{"phone": phone})
+}
+
+func (store *MongoStore) UpdateAllTokens(ctx context.Context, signedToken, signedRefreshToken, userID string) error {
+	var updateObj primitive.D
+
+	updateObj = append(updateObj, bson.E{Key: "token", Value: signedToken})
+	updateObj = append(updateObj, bson.E{Key: "refresh_token", Value: signedRefreshToken})
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
+
+	// Upsert: when true a document will be inserted if no documents match the filter
+	upsert := true
+	filter := bson.M{"user_id": userID}
+	opt := options.UpdateOptions{
+		Upsert: &upsert,
+	}
+
+	_, err := store.user_collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// StartTokenFamily remembers a new login, dropping the ones that ran out
+func (store *MongoStore) StartTokenFamily(ctx context.Context, userID string, family models.TokenFamily) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserIDIsNotValid
+	}
+
+	// A field can't be pulled from and pushed to in the same update
+	expired := bson.M{"$pull": bson.M{"token_families": bson.M{"expires_at": bson.M{"$lt": time.Now()}}}}
+	if _, err = store.user_collection.UpdateOne(ctx, bson.M{"_id": id}, expired); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	result, err := store.user_collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$push": bson.M{"token_families": family}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RotateRefreshToken replaces tokenID, which must be the latest refresh token of the
+// family, with next. The swap only happens while tokenID is still current, so of two
+// requests racing with the same token only one wins. Any other token of a live family
+// means it was stolen or replayed, and the whole family is revoked.
+func (store *MongoStore) RotateRefreshToken(ctx context.Context, userID, familyID, tokenID string, next models.TokenFamily) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserIDIsNotValid
+	}
+
+	current := bson.M{"_id": id, "token_families": bson.M{"$elemMatch": bson.M{"family_id": familyID, "token_id": tokenID, "revoked": false}}}
+	update := bson.M{"$set": bson.M{"token_families.$.token_id": next.Token_id, "token_families.$.expires_at": next.Expires_at}}
+	result, err := store.user_collection.UpdateOne(ctx, current, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	live := bson.M{"_id": id, "token_families": bson.M{"$elemMatch": bson.M{"family_id": familyID, "revoked": false}}}
+	result, err = store.user_collection.UpdateOne(ctx, live, bson.M{"$set": bson.M{"token_families.$.revoked": true}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 1 {
+		return ErrRefreshTokenReused
+	}
+
+	return ErrTokenFamilyRevoked
+}
+
+// TokenFamilyActive reports whether tokens of the family may still be used
+func (store *MongoStore) TokenFamilyActive(ctx context.Context, userID, familyID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, ErrUserIDIsNotValid
+	}
+
+	filter := bson.M{"_id": id, "token_families": bson.M{"$elemMatch": bson.M{"family_id": familyID, "revoked": false}}}
+	count, err := store.user_collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// SetUserRole changes the role and revokes every login of the user, so no token
+// with the old role stays in use
+func (store *MongoStore) SetUserRole(ctx context.Context, userID string, role models.Role) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserIDIsNotValid
+	}
+
+	update := bson.M{"$set": bson.M{"role": role, "token_families.$[].revoked": true}}
+	result, err := store.user_collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
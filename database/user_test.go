@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(pricing.Default())
+	id := primitive.NewObjectID()
+	if err := store.InsertUser(ctx, models.User{ID: id, User_id: id.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	family := func(familyID, tokenID string) models.TokenFamily {
+		return models.TokenFamily{Family_id: familyID, Token_id: tokenID, Expires_at: expires}
+	}
+	active := func(familyID string) bool {
+		t.Helper()
+		ok, err := store.TokenFamilyActive(ctx, id.Hex(), familyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	for _, login := range []string{"phone", "laptop"} {
+		if err := store.StartTokenFamily(ctx, id.Hex(), family(login, login+"-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		family  string
+		token   string
+		next    string
+		err     error
+		revoked bool
+	}{
+		{"rotate", "phone", "phone-1", "phone-2", nil, false},
+		{"rotate the new token", "phone", "phone-2", "phone-3", nil, false},
+		{"reuse an old token", "phone", "phone-1", "phone-4", ErrRefreshTokenReused, true},
+		{"current token after the reuse", "phone", "phone-3", "phone-4", ErrTokenFamilyRevoked, true},
+		{"unknown family", "tablet", "tablet-1", "tablet-2", ErrTokenFamilyRevoked, true},
+	}
+	for _, step := range steps {
+		err := store.RotateRefreshToken(ctx, id.Hex(), step.family, step.token, family(step.family, step.next))
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: RotateRefreshToken() error = %v, want %v", step.name, err, step.err)
+		}
+		if got := active(step.family); got == step.revoked {
+			t.Errorf("%s: family %s active = %v, want %v", step.name, step.family, got, !step.revoked)
+		}
+	}
+
+	// Revoking one login leaves the others alone
+	if !active("laptop") {
+		t.Error("laptop family was revoked along with the phone's")
+	}
+}
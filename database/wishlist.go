@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-com/catalog"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrItemNotInWishlist  = errors.New("Item is not in the wishlist")
+	ErrCantUpdateWishlist = errors.New("Cannot update the wishlist")
+)
+
+// FindProducts returns the products with the given IDs that exist, in no particular order
+func (store *MongoStore) FindProducts(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error) {
+	products := make([]models.Product, 0, len(productIDs))
+	if len(productIDs) == 0 {
+		return products, nil
+	}
+
+	cursor, err := store.prod_collection.Find(ctx, bson.M{"_id": bson.M{"$in": productIDs}})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantFindProduct
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	return products, nil
+}
+
+// wishlistProduct checks the product, or its variant, can go on a wishlist
+func wishlistProduct(product models.Product, sku string) error {
+	if product.Archived {
+		return ErrProductArchived
+	}
+
+	_, err := catalog.FindVariant(product, sku)
+	return err
+}
+
+// AddToWishlist parks the product, or one variant of it, on the user's
+// wishlist. Adding what is already there changes nothing.
+func (store *MongoStore) AddToWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
+
+	product, err := store.FindProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if err = wishlistProduct(product, sku); err != nil {
+		return err
+	}
+
+	item := models.WishlistItem{Product_id: productID, Sku: sku, Added_at: time.Now()}
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "wishlist", Value: bson.M{"$not": bson.M{"$elemMatch": cartItem(productID, sku)}}}}
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "wishlist", Value: item}}}}
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateWishlist
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Either the item is on the wishlist already or there is no such user
+	if _, err = store.FindUserByID(ctx, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (store *MongoStore) RemoveFromWishlist(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "wishlist", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+	update := bson.D{{Key: "$pull", Value: bson.M{"wishlist": cartItem(productID, sku)}}}
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateWishlist
+	}
+	if result.MatchedCount == 0 {
+		return ErrItemNotInWishlist
+	}
+
+	return nil
+}
+
+func (store *MongoStore) GetWishlist(ctx context.Context, userID string) ([]models.WishlistItem, error) {
+	user, err := store.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Wishlist == nil {
+		return make([]models.WishlistItem, 0), nil
+	}
+	return user.Wishlist, nil
+}
+
+// MoveToCart takes an item off the wishlist and puts quantity of it in the cart,
+// adding to the cart line when there is one. Both lists are in the user's
+// document and change in a single update, so the item is never in neither or
+// counted twice. The cart may not end up holding more than there is in stock.
+func (store *MongoStore) MoveToCart(ctx context.Context, productID primitive.ObjectID, sku string, userID string, quantity int) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
+	if quantity < 1 {
+		return ErrInvalidQuantity
+	}
+
+	product, err := store.FindProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	variant, err := catalog.FindVariant(product, sku)
+	if err != nil {
+		return err
+	}
+	if err = store.checkAvailability(ctx, productID, sku, userID, quantity); err != nil {
+		return err
+	}
+
+	onWishlist := bson.E{Key: "wishlist", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}
+	pull := bson.E{Key: "$pull", Value: bson.M{"wishlist": cartItem(productID, sku)}}
+
+	// The line is already in the cart and only its quantity goes up
+	filter := bson.D{{Key: "_id", Value: id}, onWishlist, {Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}}
+	update := touchCart(bson.D{pull, {Key: "$inc", Value: bson.D{{Key: "usercart.$[line].quantity", Value: quantity}}}})
+	lineFilter := bson.M{"line._id": productID, "line.sku": nil}
+	if sku != "" {
+		lineFilter["line.sku"] = sku
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{lineFilter}})
+	result, err := store.user_collection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Otherwise a new line is pushed
+	item := productToCartItem(product, variant)
+	item.Quantity = quantity
+	filter = bson.D{{Key: "_id", Value: id}, onWishlist, {Key: "usercart", Value: bson.M{"$not": bson.M{"$elemMatch": cartItem(productID, sku)}}}}
+	update = touchCart(bson.D{pull, {Key: "$push", Value: bson.D{{Key: "usercart", Value: item}}}})
+	result, err = store.user_collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		if _, err = store.FindUserByID(ctx, userID); err != nil {
+			return err
+		}
+		return ErrItemNotInWishlist
+	}
+
+	return nil
+}
+
+// SaveForLater takes a line out of the cart and parks its product on the
+// wishlist, in a single update like MoveToCart. The wishlist doesn't keep the
+// quantity and an item that is on it already stays as it is.
+func (store *MongoStore) SaveForLater(ctx context.Context, productID primitive.ObjectID, sku string, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIDIsNotValid
+	}
+
+	inCart := bson.E{Key: "usercart", Value: bson.M{"$elemMatch": cartItem(productID, sku)}}
+	pull := bson.E{Key: "$pull", Value: bson.M{"usercart": cartItem(productID, sku)}}
+
+	item := models.WishlistItem{Product_id: productID, Sku: sku, Added_at: time.Now()}
+	filter := bson.D{{Key: "_id", Value: id}, inCart, {Key: "wishlist", Value: bson.M{"$not": bson.M{"$elemMatch": cartItem(productID, sku)}}}}
+	update := touchCart(bson.D{pull, {Key: "$push", Value: bson.D{{Key: "wishlist", Value: item}}}})
+	result, err := store.user_collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// The item is on the wishlist already, so it only leaves the cart
+	filter = bson.D{{Key: "_id", Value: id}, inCart}
+	result, err = store.user_collection.UpdateOne(ctx, filter, touchCart(bson.D{pull}))
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount == 0 {
+		if _, err = store.FindUserByID(ctx, userID); err != nil {
+			return err
+		}
+		return ErrItemNotInCart
+	}
+
+	return nil
+}
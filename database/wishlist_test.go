@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-com/catalog"
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWishlistMoves(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(pricing.Default())
+	id := primitive.NewObjectID()
+	user := id.Hex()
+	if err := store.InsertUser(ctx, models.User{ID: id, User_id: user}); err != nil {
+		t.Fatal(err)
+	}
+	mug := insertProduct(t, store, "Mug", 1250)
+	if _, err := store.SetStock(ctx, mug.Product_id, "", 3); err != nil {
+		t.Fatal(err)
+	}
+	name := "Shirt"
+	shirt := models.Product{
+		Product_id:   primitive.NewObjectID(),
+		Product_name: &name,
+		Attributes:   []models.ProductAttribute{{Name: "size", Values: []string{"S", "M"}}},
+		Variants: []models.Variant{
+			{Sku: "S", Attributes: map[string]string{"size": "S"}, Price: models.NewMoney(1500, "USD"), Stock: 1},
+			{Sku: "M", Attributes: map[string]string{"size": "M"}, Price: models.NewMoney(1500, "USD"), Stock: 5},
+		},
+	}
+	catalog.RollUp(&shirt)
+	if err := store.InsertProduct(ctx, shirt); err != nil {
+		t.Fatal(err)
+	}
+
+	type lists struct {
+		cart     map[string]int
+		wishlist []string
+	}
+	key := func(productID primitive.ObjectID, sku string) string {
+		if productID == mug.Product_id {
+			return "mug" + sku
+		}
+		return "shirt" + sku
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		err  error
+		want lists
+	}{
+		{"wish for a mug", func() error { return store.AddToWishlist(ctx, mug.Product_id, "", user) }, nil,
+			lists{map[string]int{}, []string{"mug"}}},
+		{"wish for it again", func() error { return store.AddToWishlist(ctx, mug.Product_id, "", user) }, nil,
+			lists{map[string]int{}, []string{"mug"}}},
+		{"wish for a shirt without a size", func() error { return store.AddToWishlist(ctx, shirt.Product_id, "", user) }, catalog.ErrVariantRequired,
+			lists{map[string]int{}, []string{"mug"}}},
+		{"wish for a small shirt", func() error { return store.AddToWishlist(ctx, shirt.Product_id, "S", user) }, nil,
+			lists{map[string]int{}, []string{"mug", "shirtS"}}},
+		{"move more than in stock", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 4) }, ErrNotEnoughStock,
+			lists{map[string]int{}, []string{"mug", "shirtS"}}},
+		{"move nothing", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 0) }, ErrInvalidQuantity,
+			lists{map[string]int{}, []string{"mug", "shirtS"}}},
+		{"move the mug", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 2) }, nil,
+			lists{map[string]int{"mug": 2}, []string{"shirtS"}}},
+		{"move it again", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 1) }, ErrItemNotInWishlist,
+			lists{map[string]int{"mug": 2}, []string{"shirtS"}}},
+		{"save the mug for later", func() error { return store.SaveForLater(ctx, mug.Product_id, "", user) }, nil,
+			lists{map[string]int{}, []string{"shirtS", "mug"}}},
+		{"save what isn't in the cart", func() error { return store.SaveForLater(ctx, mug.Product_id, "", user) }, ErrItemNotInCart,
+			lists{map[string]int{}, []string{"shirtS", "mug"}}},
+		{"add the mug to the cart", func() error { return store.AddProductToCart(ctx, mug.Product_id, "", user, 2) }, nil,
+			lists{map[string]int{"mug": 2}, []string{"shirtS", "mug"}}},
+		{"move onto the cart line past the stock", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 2) }, ErrNotEnoughStock,
+			lists{map[string]int{"mug": 2}, []string{"shirtS", "mug"}}},
+		{"move onto the cart line", func() error { return store.MoveToCart(ctx, mug.Product_id, "", user, 1) }, nil,
+			lists{map[string]int{"mug": 3}, []string{"shirtS"}}},
+		{"save the mug while it is on the wishlist", func() error {
+			if err := store.AddToWishlist(ctx, mug.Product_id, "", user); err != nil {
+				return err
+			}
+			return store.SaveForLater(ctx, mug.Product_id, "", user)
+		}, nil, lists{map[string]int{}, []string{"shirtS", "mug"}}},
+		{"move the small shirt", func() error { return store.MoveToCart(ctx, shirt.Product_id, "S", user, 1) }, nil,
+			lists{map[string]int{"shirtS": 1}, []string{"mug"}}},
+		{"archived mug", func() error {
+			if _, err := store.UpdateProduct(ctx, mug.Product_id, func(product *models.Product) error {
+				product.Archived = true
+				return nil
+			}); err != nil {
+				return err
+			}
+			return store.MoveToCart(ctx, mug.Product_id, "", user, 1)
+		}, ErrProductArchived, lists{map[string]int{"shirtS": 1}, []string{"mug"}}},
+		{"deleted mug", func() error {
+			if err := store.DeleteProduct(ctx, mug.Product_id); err != nil {
+				return err
+			}
+			return store.MoveToCart(ctx, mug.Product_id, "", user, 1)
+		}, ErrCantFindProduct, lists{map[string]int{"shirtS": 1}, []string{"mug"}}},
+	}
+
+	for _, step := range steps {
+		if err := step.do(); !errors.Is(err, step.err) {
+			t.Fatalf("%s: error = %v, want %v", step.name, err, step.err)
+		}
+
+		cart, err := store.GetCart(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wishlist, err := store.GetWishlist(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := lists{make(map[string]int), nil}
+		for _, item := range cart {
+			got.cart[key(item.Product_id, item.Sku)] = item.Quantity
+		}
+		for _, item := range wishlist {
+			got.wishlist = append(got.wishlist, key(item.Product_id, item.Sku))
+		}
+		if len(got.cart) != len(step.want.cart) || len(got.wishlist) != len(step.want.wishlist) {
+			t.Fatalf("%s: cart %v and wishlist %v, want %v and %v", step.name, got.cart, got.wishlist, step.want.cart, step.want.wishlist)
+		}
+		for line, quantity := range step.want.cart {
+			if got.cart[line] != quantity {
+				t.Errorf("%s: cart %v, want %v", step.name, got.cart, step.want.cart)
+			}
+		}
+		for i, item := range step.want.wishlist {
+			if got.wishlist[i] != item {
+				t.Errorf("%s: wishlist %v, want %v", step.name, got.wishlist, step.want.wishlist)
+			}
+		}
+	}
+}
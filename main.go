@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"go-com/controllers"
 	"go-com/database"
 	"go-com/middleware"
+	"go-com/models"
+	"go-com/payments"
+	"go-com/pricing"
+	"go-com/reminders"
 	"go-com/routes"
 	"os"
 	"log"
@@ -18,23 +23,126 @@ func main() {
 		port = "8000"
 	}
 
-	app := controllers.NewApplication(database.ProductData(database.Client, "Products"), database.UserData(database.Client, "Users"))
+	// Carts and orders are priced the same way, see pricing.FromEnv for the settings
+	engine, err := pricing.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// STORAGE=memory runs the whole API without MongoDB
+	var store database.Store
+	if os.Getenv("STORAGE") == "memory" {
+		store = database.NewMemoryStore(engine)
+	} else {
+		client := database.DBSet()
+		if client == nil {
+			log.Fatal("could not connect to mongodb")
+		}
+		mongoStore := database.NewMongoStore(client, engine)
+		if err := mongoStore.EnsureIndexes(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		store = mongoStore
+	}
+
+	// Reminds users of the carts they left behind, see reminders.FromEnv for the settings
+	worker, err := reminders.FromEnv(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go worker.Run(context.Background())
+
+	router := newRouter(store)
+	log.Fatal(router.Run(":" + port))
 	
+}
+
+// newRouter sets up every route of the API on top of the store
+func newRouter(store database.Store) *gin.Engine {
+	app := controllers.NewApplication(store, payments.NewCashOnDelivery(), payments.NewFakeCard())
+
 	router := gin.New()
 	router.Use(gin.Logger())
 
-	routes.UserRoutes(router)
-	router.Use(middleware.Authentication())
+	routes.UserRoutes(router, app)
+	routes.GuestRoutes(router, app)
+	router.Use(middleware.Authentication(store))
 	router.GET("/addtocart", app.AddToCart())
 	router.GET("/removeitem", app.RemoveItem())
-	router.GET("/listcart", controllers.GetItemFromCart())
-	router.POST("/addaddress", controllers.AddAddress())
-	router.PUT("/edithomeaddress", controllers.EditHomeAddress())
-	router.PUT("/editworkaddress", controllers.EditWorkAddress())
-	router.POST("/deleteaddresses", controllers.DeleteAddress())
+	router.PUT("/setquantity", app.SetItemQuantity())
+	router.GET("/decrementitem", app.DecrementItem())
+	router.GET("/listcart", app.GetItemFromCart())
+	router.GET("/wishlist", app.ListWishlist())
+	router.POST("/wishlist", app.AddToWishlist())
+	router.DELETE("/wishlist", app.RemoveFromWishlist())
+	router.POST("/wishlist/movetocart", app.MoveToCart())
+	router.POST("/saveforlater", app.SaveForLater())
+	router.POST("/addaddress", app.AddAddress())
+	router.PUT("/edithomeaddress", app.EditHomeAddress())
+	router.PUT("/editworkaddress", app.EditWorkAddress())
+	router.POST("/deleteaddresses", app.DeleteAddress())
+	router.GET("/addresses", app.ListAddresses())
+	router.POST("/addresses", app.CreateAddress())
+	router.GET("/addresses/:addressID", app.GetAddress())
+	router.PUT("/addresses/:addressID", app.UpdateAddress())
+	router.DELETE("/addresses/:addressID", app.RemoveAddress())
 	router.GET("/cartcheckout", app.BuyFromCart())
 	router.GET("/instantbuy", app.InstantBuy())
+	router.GET("/orders", app.ListOrders())
+	router.GET("/orders/:id", app.GetOrder())
+	router.POST("/orders/:id/cancel", app.CancelOrder())
+	router.POST("/applycoupon", app.ApplyCoupon())
+	router.POST("/removecoupon", app.RemoveCoupon())
 
-	log.Fatal(router.Run(":" + port))
-	
+	// Everything under /admin is for admins only
+	admin := router.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+	admin.POST("/addproduct", app.ProductViewerAdmin())
+	admin.PUT("/products/:id", app.UpdateProduct())
+	admin.PATCH("/products/:id", app.PatchProduct())
+	admin.DELETE("/products/:id", app.DeleteProduct())
+	admin.POST("/products/:id/archive", app.ArchiveProduct())
+	admin.POST("/products/:id/unarchive", app.UnarchiveProduct())
+	admin.PUT("/products/:id/stock", app.UpdateStock())
+	admin.PUT("/orders/:id/status", app.UpdateOrderStatus())
+	admin.POST("/orders/:id/refunds", app.RefundOrder())
+	admin.POST("/orders/:id/settle", app.SettleOrder())
+	admin.POST("/categories", app.CreateCategory())
+	admin.PUT("/categories/:id", app.UpdateCategory())
+	admin.DELETE("/categories/:id", app.DeleteCategory())
+	admin.POST("/coupons", app.CreateCoupon())
+	admin.GET("/coupons", app.ListCoupons())
+	admin.PUT("/coupons/:id", app.UpdateCoupon())
+	admin.DELETE("/coupons/:id", app.DeleteCoupon())
+	admin.PUT("/users/:userID/role", app.SetUserRole())
+
+	// The same cart, address and checkout routes, for the user named in the path
+	onBehalf := admin.Group("/users/:userID")
+	onBehalf.GET("/addtocart", app.AddToCart())
+	onBehalf.GET("/removeitem", app.RemoveItem())
+	onBehalf.PUT("/setquantity", app.SetItemQuantity())
+	onBehalf.GET("/decrementitem", app.DecrementItem())
+	onBehalf.GET("/listcart", app.GetItemFromCart())
+	onBehalf.GET("/wishlist", app.ListWishlist())
+	onBehalf.POST("/wishlist", app.AddToWishlist())
+	onBehalf.DELETE("/wishlist", app.RemoveFromWishlist())
+	onBehalf.POST("/wishlist/movetocart", app.MoveToCart())
+	onBehalf.POST("/saveforlater", app.SaveForLater())
+	onBehalf.POST("/addaddress", app.AddAddress())
+	onBehalf.PUT("/edithomeaddress", app.EditHomeAddress())
+	onBehalf.PUT("/editworkaddress", app.EditWorkAddress())
+	onBehalf.POST("/deleteaddresses", app.DeleteAddress())
+	onBehalf.GET("/addresses", app.ListAddresses())
+	onBehalf.POST("/addresses", app.CreateAddress())
+	onBehalf.GET("/addresses/:addressID", app.GetAddress())
+	onBehalf.PUT("/addresses/:addressID", app.UpdateAddress())
+	onBehalf.DELETE("/addresses/:addressID", app.RemoveAddress())
+	onBehalf.GET("/cartcheckout", app.BuyFromCart())
+	onBehalf.GET("/instantbuy", app.InstantBuy())
+	onBehalf.GET("/orders", app.ListOrders())
+	onBehalf.GET("/orders/:id", app.GetOrder())
+	onBehalf.POST("/orders/:id/cancel", app.CancelOrder())
+	onBehalf.POST("/applycoupon", app.ApplyCoupon())
+	onBehalf.POST("/removecoupon", app.RemoveCoupon())
+
+	return router
 }
\ No newline at end of file
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-com/controllers"
+	"go-com/database"
+	"go-com/pricing"
+	"go-com/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// api drives the whole API against the in-memory store, the same one
+// STORAGE=memory runs on
+type api struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+func newAPI(t *testing.T) *api {
+	gin.SetMode(gin.TestMode)
+	tokens.SECRET_KEY = "test-secret"
+	controllers.ADMIN_EMAILS = "admin@example.com"
+
+	return &api{t: t, router: newRouter(database.NewMemoryStore(pricing.Default()))}
+}
+
+// call sends the request and decodes the JSON response into out, when given.
+// It fails the test unless the response has the wanted status.
+func (a *api) call(method, path, token string, body interface{}, want int, out interface{}) {
+	a.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("token", token)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+
+	if rec.Code != want {
+		a.t.Fatalf("%s %s = %d %s, want %d", method, path, rec.Code, rec.Body.String(), want)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("%s %s: %v in %s", method, path, err, rec.Body.String())
+		}
+	}
+}
+
+// signup signs a user up and logs them in, returning their token
+func (a *api) signup(email, phone string) string {
+	a.t.Helper()
+
+	a.call(http.MethodPost, "/users/signup", "", map[string]string{
+		"first_name": "Ann", "last_name": "Lee", "password": "secret1", "email": email, "phone": phone,
+	}, http.StatusCreated, nil)
+
+	token, _ := a.login(email)
+	return token
+}
+
+// login logs a user in, returning their token and refresh token
+func (a *api) login(email string) (string, string) {
+	a.t.Helper()
+
+	var user struct {
+		Token         string `json:"token"`
+		Refresh_token string `json:"refresh_token"`
+	}
+	a.call(http.MethodPost, "/users/login", "", map[string]string{"email": email, "password": "secret1"}, http.StatusFound, &user)
+	if user.Token == "" || user.Refresh_token == "" {
+		a.t.Fatalf("login of %s returned no tokens", email)
+	}
+
+	return user.Token, user.Refresh_token
+}
+
+type money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type order struct {
+	ID     string `json:"_id"`
+	Status string `json:"status"`
+	Price  money  `json:"total_price"`
+	Lines  []struct {
+		Quantity int `json:"quantity"`
+	} `json:"order_list"`
+	Payment struct {
+		Provider string `json:"provider"`
+		Status   string `json:"status"`
+	} `json:"payment_method"`
+}
+
+func TestCheckout(t *testing.T) {
+	a := newAPI(t)
+	admin := a.signup("admin@example.com", "5550000001")
+	ann := a.signup("ann@example.com", "5550000002")
+	a.call(http.MethodPost, "/users/signup", "", map[string]string{
+		"first_name": "Ann", "last_name": "Lee", "password": "secret1", "email": "ann@example.com", "phone": "5550000003",
+	}, http.StatusBadRequest, nil)
+
+	a.call(http.MethodPost, "/admin/addproduct", admin, map[string]interface{}{
+		"product_name": "Mug", "price": money{1250, "USD"}, "stock": 5,
+	}, http.StatusOK, nil)
+	a.call(http.MethodPost, "/admin/addproduct", ann, map[string]interface{}{
+		"product_name": "Teapot", "price": money{2500, "USD"}, "stock": 5,
+	}, http.StatusForbidden, nil)
+
+	var catalog struct {
+		Products []struct {
+			ID    string `json:"_id"`
+			Stock int    `json:"stock"`
+		} `json:"products"`
+	}
+	a.call(http.MethodGet, "/users/productview", "", nil, http.StatusOK, &catalog)
+	if len(catalog.Products) != 1 {
+		t.Fatalf("productview returned %d products, want 1", len(catalog.Products))
+	}
+	mug := catalog.Products[0].ID
+
+	a.call(http.MethodGet, "/addtocart?id="+mug+"&quantity=2", "", nil, http.StatusUnauthorized, nil)
+	a.call(http.MethodGet, "/addtocart?id="+mug+"&quantity=2", ann, nil, http.StatusOK, nil)
+
+	var quote struct {
+		Total money `json:"total"`
+	}
+	a.call(http.MethodGet, "/listcart", ann, nil, http.StatusOK, &quote)
+	if quote.Total != (money{2500, "USD"}) {
+		t.Errorf("cart total = %+v, want 25.00 USD", quote.Total)
+	}
+
+	var placed struct {
+		Order order `json:"order"`
+	}
+	a.call(http.MethodGet, "/cartcheckout", ann, nil, http.StatusOK, &placed)
+	if placed.Order.Price != quote.Total || placed.Order.Status != "pending" || placed.Order.Payment.Provider != "cod" || placed.Order.Lines[0].Quantity != 2 {
+		t.Errorf("cart checkout placed %+v, want a pending cash on delivery order of 2 mugs for the quoted total", placed.Order)
+	}
+	a.call(http.MethodGet, "/cartcheckout", ann, nil, http.StatusBadRequest, nil)
+
+	a.call(http.MethodGet, "/instantbuy?pid="+mug+"&payment=card&card_token=tok_visa", ann, nil, http.StatusOK, &placed)
+	if placed.Order.Price != (money{1250, "USD"}) || placed.Order.Status != "paid" || placed.Order.Payment.Status != "captured" {
+		t.Errorf("card checkout placed %+v, want a paid order with the payment captured", placed.Order)
+	}
+	a.call(http.MethodGet, "/instantbuy?pid="+mug+"&payment=card&card_token=tok_declined", ann, nil, http.StatusPaymentRequired, nil)
+
+	var page struct {
+		Orders []order `json:"orders"`
+	}
+	a.call(http.MethodGet, "/orders", ann, nil, http.StatusOK, &page)
+	if len(page.Orders) != 2 {
+		t.Fatalf("order list has %d orders, want 2", len(page.Orders))
+	}
+	if page.Orders[0].ID != placed.Order.ID || page.Orders[1].Lines[0].Quantity != 2 {
+		t.Errorf("order list = %+v, want the card order first and then the cart of 2 mugs", page.Orders)
+	}
+
+	a.call(http.MethodGet, "/orders", admin, nil, http.StatusOK, &page)
+	if len(page.Orders) != 0 {
+		t.Errorf("admin's order list has %d orders, want none", len(page.Orders))
+	}
+
+	a.call(http.MethodGet, "/users/productview", "", nil, http.StatusOK, &catalog)
+	if catalog.Products[0].Stock != 2 {
+		t.Errorf("stock = %d after buying 3 mugs, want 2", catalog.Products[0].Stock)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	a := newAPI(t)
+	laptop := a.signup("ann@example.com", "5550000002")
+	token, refresh := a.login("ann@example.com")
+
+	type pair struct {
+		Token         string `json:"token"`
+		Refresh_token string `json:"refresh_token"`
+	}
+	a.call(http.MethodPost, "/users/refresh", "", map[string]string{"refresh_token": token}, http.StatusUnauthorized, nil)
+
+	var rotated pair
+	a.call(http.MethodPost, "/users/refresh", "", map[string]string{"refresh_token": refresh}, http.StatusOK, &rotated)
+	if rotated.Token == "" || rotated.Refresh_token == "" || rotated.Refresh_token == refresh {
+		t.Fatalf("refresh returned %+v, want new tokens", rotated)
+	}
+	a.call(http.MethodGet, "/orders", rotated.Token, nil, http.StatusOK, nil)
+
+	// Reusing the old refresh token revokes every token of that login
+	a.call(http.MethodPost, "/users/refresh", "", map[string]string{"refresh_token": refresh}, http.StatusUnauthorized, nil)
+	a.call(http.MethodGet, "/orders", rotated.Token, nil, http.StatusUnauthorized, nil)
+	a.call(http.MethodGet, "/orders", token, nil, http.StatusUnauthorized, nil)
+	a.call(http.MethodPost, "/users/refresh", "", map[string]string{"refresh_token": rotated.Refresh_token}, http.StatusUnauthorized, nil)
+
+	a.call(http.MethodGet, "/orders", laptop, nil, http.StatusOK, nil)
+}
+
+func TestListingCursor(t *testing.T) {
+	a := newAPI(t)
+	admin := a.signup("admin@example.com", "5550000001")
+	for _, name := range []string{"Mug", "Cup", "Bowl"} {
+		a.call(http.MethodPost, "/admin/addproduct", admin, map[string]interface{}{
+			"product_name": name, "price": money{1250, "USD"}, "stock": 5,
+		}, http.StatusOK, nil)
+	}
+
+	var page struct {
+		Products []struct {
+			ID string `json:"_id"`
+		} `json:"products"`
+		Next_cursor string `json:"next_cursor"`
+	}
+	a.call(http.MethodGet, "/users/productview?sort=price&limit=2", "", nil, http.StatusOK, &page)
+	if len(page.Products) != 2 || page.Next_cursor == "" {
+		t.Fatalf("first page = %+v, want 2 products and a cursor", page)
+	}
+	cursor := page.Next_cursor
+
+	for _, bad := range []string{"garbage", cursor[:len(cursor)-3], cursor + "AAAA"} {
+		a.call(http.MethodGet, "/users/productview?sort=price&limit=2&cursor="+bad, "", nil, http.StatusBadRequest, nil)
+	}
+	a.call(http.MethodGet, "/users/productview?sort=name&limit=2&cursor="+cursor, "", nil, http.StatusBadRequest, nil)
+
+	a.call(http.MethodGet, "/users/productview?sort=price&limit=2&cursor="+cursor, "", nil, http.StatusOK, &page)
+	if len(page.Products) != 1 || page.Next_cursor != "" {
+		t.Errorf("last page = %+v, want the one product left and no cursor", page)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	a := newAPI(t)
+	admin := a.signup("admin@example.com", "5550000001")
+
+	var kitchen, cups struct {
+		ID string `json:"_id"`
+	}
+	a.call(http.MethodPost, "/admin/categories", admin, map[string]string{"name": "Kitchen"}, http.StatusCreated, &kitchen)
+	a.call(http.MethodPost, "/admin/categories", admin, map[string]string{"name": "Cups", "parent_id": kitchen.ID}, http.StatusCreated, &cups)
+	a.call(http.MethodPut, "/admin/categories/"+kitchen.ID, admin, map[string]string{"name": "Kitchen", "parent_id": cups.ID}, http.StatusBadRequest, nil)
+
+	for _, product := range []struct {
+		name     string
+		category string
+	}{{"Blue Mug", cups.ID}, {"Red Mug", kitchen.ID}, {"Teapot", kitchen.ID}} {
+		a.call(http.MethodPost, "/admin/addproduct", admin, map[string]interface{}{
+			"product_name": product.name, "price": money{1250, "USD"}, "stock": 5, "categories": []string{product.category},
+		}, http.StatusOK, nil)
+	}
+
+	for _, path := range []string{"/users/search?name=mug", "/users/search?q=mug"} {
+		var page struct {
+			Facets struct {
+				Categories []struct {
+					Name  string `json:"name"`
+					Count int    `json:"count"`
+				} `json:"categories"`
+			} `json:"facets"`
+		}
+		a.call(http.MethodGet, path, "", nil, http.StatusOK, &page)
+
+		counts := make(map[string]int)
+		for _, facet := range page.Facets.Categories {
+			counts[facet.Name] = facet.Count
+		}
+		if len(counts) != 2 || counts["Kitchen"] != 2 || counts["Cups"] != 1 {
+			t.Errorf("%s category facets = %+v, want Kitchen 2 and Cups 1", path, page.Facets.Categories)
+		}
+	}
+}
+
+func TestAddressRules(t *testing.T) {
+	a := newAPI(t)
+	ann := a.signup("ann@example.com", "5550000002")
+
+	var invalid struct {
+		Fields []struct {
+			Field string `json:"field"`
+		} `json:"fields"`
+	}
+	a.call(http.MethodPost, "/addresses", ann, map[string]string{
+		"house_name": "1", "street_name": "Main Street", "city_name": "Springfield", "country": "US", "postcode": "6270",
+	}, http.StatusBadRequest, &invalid)
+	if len(invalid.Fields) != 2 || invalid.Fields[0].Field != "postcode" || invalid.Fields[1].Field != "region" {
+		t.Errorf("invalid US address fields = %+v, want postcode and region", invalid.Fields)
+	}
+
+	var created struct {
+		Postcode         string `json:"postcode"`
+		Region           string `json:"region"`
+		Default_shipping bool   `json:"default_shipping"`
+	}
+	a.call(http.MethodPost, "/addresses", ann, map[string]string{
+		"house_name": "24", "street_name": "Sussex Drive", "city_name": "Ottawa", "country": "ca", "region": "on", "postcode": "k1a0b1",
+	}, http.StatusCreated, &created)
+	if created.Postcode != "K1A 0B1" || created.Region != "ON" || !created.Default_shipping {
+		t.Errorf("created address = %+v, want it normalized and the default", created)
+	}
+}
+
+func TestWishlist(t *testing.T) {
+	a := newAPI(t)
+	admin := a.signup("admin@example.com", "5550000001")
+	ann := a.signup("ann@example.com", "5550000002")
+	for _, name := range []string{"Bowl", "Cup", "Mug"} {
+		a.call(http.MethodPost, "/admin/addproduct", admin, map[string]interface{}{
+			"product_name": name, "price": money{1250, "USD"}, "stock": 5,
+		}, http.StatusOK, nil)
+	}
+
+	var catalog struct {
+		Products []struct {
+			ID string `json:"_id"`
+		} `json:"products"`
+	}
+	a.call(http.MethodGet, "/users/productview?sort=name", "", nil, http.StatusOK, &catalog)
+	if len(catalog.Products) != 3 {
+		t.Fatalf("productview returned %d products, want 3", len(catalog.Products))
+	}
+	bowl, cup, mug := catalog.Products[0].ID, catalog.Products[1].ID, catalog.Products[2].ID
+
+	for _, id := range []string{bowl, cup, mug} {
+		a.call(http.MethodPost, "/wishlist?id="+id, ann, nil, http.StatusOK, nil)
+	}
+	a.call(http.MethodPost, "/wishlist/movetocart?id="+mug+"&quantity=6", ann, nil, http.StatusConflict, nil)
+	a.call(http.MethodPost, "/wishlist/movetocart?id="+mug+"&quantity=2", ann, nil, http.StatusOK, nil)
+	a.call(http.MethodPost, "/wishlist/movetocart?id="+mug, ann, nil, http.StatusNotFound, nil)
+	a.call(http.MethodPost, "/saveforlater?id="+mug, ann, nil, http.StatusOK, nil)
+	a.call(http.MethodPost, "/saveforlater?id="+mug, ann, nil, http.StatusNotFound, nil)
+
+	a.call(http.MethodDelete, "/admin/products/"+bowl, admin, nil, http.StatusOK, nil)
+	a.call(http.MethodPost, "/admin/products/"+cup+"/archive", admin, nil, http.StatusOK, nil)
+	a.call(http.MethodPost, "/wishlist?id="+cup, ann, nil, http.StatusConflict, nil)
+
+	var wishlist []struct {
+		ID        string `json:"_id"`
+		Price     *money `json:"price"`
+		Available bool   `json:"available"`
+	}
+	a.call(http.MethodGet, "/wishlist", ann, nil, http.StatusOK, &wishlist)
+	if len(wishlist) != 3 {
+		t.Fatalf("wishlist = %+v, want the bowl, cup and mug", wishlist)
+	}
+	available := map[string]bool{bowl: false, cup: false, mug: true}
+	for _, line := range wishlist {
+		if line.Available != available[line.ID] || (line.Price != nil) != available[line.ID] {
+			t.Errorf("wishlist line %+v, want available %v", line, available[line.ID])
+		}
+	}
+	a.call(http.MethodPost, "/wishlist/movetocart?id="+bowl, ann, nil, http.StatusNotFound, nil)
+	a.call(http.MethodPost, "/wishlist/movetocart?id="+cup, ann, nil, http.StatusConflict, nil)
+}
@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"time"
+	"go-com/database"
+	"go-com/models"
 	"go-com/tokens"
 	"github.com/gin-gonic/gin"
 )
 
-func Authentication() gin.HandlerFunc {
+// Authentication lets requests with a valid access token through. Tokens from a
+// login whose token family was revoked are turned away even before they expire.
+func Authentication(users database.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Retrieves the token from the request header
 		ClientToken := c.Request.Header.Get("token")
@@ -14,7 +20,7 @@ func Authentication() gin.HandlerFunc {
 		// If no authorization provided, respond with an error message and 
 		// Abort() to ensure no other handlers are called by this request and return from the function
 		if ClientToken == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "No authorization header provided"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No authorization header provided"})
 			c.Abort()
 			return
 		}
@@ -22,17 +28,64 @@ func Authentication() gin.HandlerFunc {
 		// If the token is invalid, respond with an error message abort the context and return
 		claims, err := tokens.ValidateToken(ClientToken)
 		if err!="" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err})
 			c.Abort()
 			return 
 		}
 
+		// Tokens signed before token families existed carry none and run out within a day
+		if claims.Family != "" {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+			defer cancel()
+
+			active, err := users.TokenFamilyActive(ctx, claims.Uid, claims.Family)
+			if err!=nil || !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token was revoked, log in again"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Stores new key-value pairs exclusively for this context
 		c.Set("email", claims.Email)
 		c.Set("uid", claims.Uid)
+		c.Set("role", claims.Role)
 
 		// Executes the pending handlers inside the chain inside the calling handler
 		c.Next()
 
 	}
-}
\ No newline at end of file
+}
+
+// RequireRole only lets through users with one of the given roles. It goes after
+// Authentication, which puts the role of the token on the context.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := models.Role(c.GetString("role"))
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to do this"})
+		c.Abort()
+	}
+}
+
+// Guest lets visitors through with the guest token of their cart, which the
+// cart handlers then work on instead of a user's cart
+func Guest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		guestToken := c.Request.Header.Get("guest_token")
+		if guestToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No guest token provided"})
+			c.Abort()
+			return
+		}
+
+		c.Set("guest", guestToken)
+		c.Next()
+	}
+}
@@ -18,44 +18,311 @@ type User struct {
 	Updated_at		time.Time 					`json:"updated_at"`
 	User_id			string 						`json:"user_id"`
 	UserCart		[]ProductUser 				`json:"usercart" bson:"usercart"`		
+	Wishlist		[]WishlistItem 				`json:"wishlist" bson:"wishlist"`
 	Address_Details	[]Address  					`json:"address" bson:"address"`
-	Order_Status	[]Order 					`json:"orders" bson:"orders"`
+	Cart_coupon		*string 					`json:"cart_coupon" bson:"cart_coupon"`
+	Cart_updated_at	*time.Time 					`json:"cart_updated_at" bson:"cart_updated_at"`
+	Cart_reminded_at	*time.Time 				`json:"cart_reminded_at" bson:"cart_reminded_at"`
+	Token_families	[]TokenFamily 				`json:"-" bson:"token_families"`
+	Role			Role 						`json:"role" bson:"role"`
 }
 
+type Role string
+
+// Users without a role signed up before roles existed and are customers
+const (
+	RoleCustomer	Role = "customer"
+	RoleAdmin		Role = "admin"
+	RoleSupport		Role = "support"
+)
+
+func (role Role) Valid() bool {
+	return role == RoleCustomer || role == RoleAdmin || role == RoleSupport
+}
+
+// TokenFamily is one login of a user. Only the latest refresh token of the family
+// can be used, and presenting an older one revokes the family for good.
+type TokenFamily struct {
+	Family_id		string 						`json:"family_id" bson:"family_id"`
+	Token_id		string 						`json:"token_id" bson:"token_id"`
+	Revoked			bool 						`json:"revoked" bson:"revoked"`
+	Expires_at		time.Time 					`json:"expires_at" bson:"expires_at"`
+}
+
+// Archived products are no longer sold but stay around for the orders that hold them
 type Product struct {
 	Product_id			primitive.ObjectID		 `json:"_id" bson:"_id"`
-	Product_name		*string 			   	 `json:"product_name"`		
-	Price				*uint64 			   	 `json:"price"`
-	Rating				*uint8  			   	 `json:"rating"`
+	Product_name		*string 			   	 `json:"product_name" validate:"required,min=1,max=200"`		
+	Description			*string 				 `json:"description" bson:"description" validate:"omitempty,max=5000"`
+	Price				Money 				   	 `json:"price" bson:"price"`
+	Rating				*uint8  			   	 `json:"rating" validate:"omitempty,max=5"`
 	Image				*string  			   	 `json:"image"`
+	Stock				int 					 `json:"stock" bson:"stock" validate:"min=0"`
+	Categories			[]primitive.ObjectID 	 `json:"categories" bson:"categories"`
+	Tax_class			string 					 `json:"tax_class,omitempty" bson:"tax_class,omitempty" validate:"omitempty,max=50"`
+	Attributes			[]ProductAttribute 		 `json:"attributes" bson:"attributes" validate:"dive"`
+	Variants			[]Variant 				 `json:"variants" bson:"variants" validate:"dive"`
+	Archived			bool 					 `json:"archived" bson:"archived"`
+	Archived_at			*time.Time 				 `json:"archived_at" bson:"archived_at"`
+	Created_at			time.Time 				 `json:"created_at" bson:"created_at"`
+	Updated_at			time.Time 				 `json:"updated_at" bson:"updated_at"`
 }
 
+// ProductAttribute is something the variants of a product differ in, e.g. size,
+// along with the values it can take
+type ProductAttribute struct {
+	Name				string 					 `json:"name" bson:"name" validate:"required,max=50"`
+	Values				[]string 				 `json:"values" bson:"values" validate:"required,min=1,dive,required,max=50"`
+}
+
+// Variant is one version of a product that is sold on its own, with its own
+// price, image and stock. Attributes maps every attribute of the product to one of its values.
+type Variant struct {
+	Sku					string 					 `json:"sku" bson:"sku" validate:"required,max=64"`
+	Attributes			map[string]string 		 `json:"attributes" bson:"attributes"`
+	Price				Money 					 `json:"price" bson:"price"`
+	Image				*string 				 `json:"image" bson:"image"`
+	Stock				int 					 `json:"stock" bson:"stock" validate:"min=0"`
+}
+
+// Cart and order lines are a product, or one variant of it when Sku is set
 type ProductUser struct {
 	Product_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Sku					string 					 `json:"sku,omitempty" bson:"sku,omitempty"`
+	Attributes			map[string]string 		 `json:"attributes,omitempty" bson:"attributes,omitempty"`
 	Product_name		*string 			   	 `json:"product_name" bson:"product_name"` 
-	Price				int  			   	 	 `json:"price" bson:"price"`
+	Price				Money  			   	 	 `json:"price" bson:"price"`
 	Rating				*uint64  			   	 `json:"rating" bson:"rating"`
 	Image				*string	 			   	 `json:"image" bson:"image"`
+	Quantity			int 					 `json:"quantity" bson:"quantity"`
+	Tax_class			string 					 `json:"tax_class,omitempty" bson:"tax_class,omitempty"`
+	Tax					*Money 					 `json:"tax,omitempty" bson:"tax,omitempty"`
+	Refunded_quantity	int 					 `json:"refunded_quantity,omitempty" bson:"refunded_quantity,omitempty"`
+	Restocked_quantity	int 					 `json:"restocked_quantity,omitempty" bson:"restocked_quantity,omitempty"`
+}
+
+// QuoteLine is a cart line with what it comes to
+type QuoteLine struct {
+	ProductUser
+	Line_total			Money 					 `json:"line_total"`
 }
 
+// Quote is a cart priced by the pricing engine, everything that makes up its
+// total. Coupon_error says why the coupon on the cart was left out, checkout
+// refuses the cart until it is removed.
+type Quote struct {
+	Lines				[]QuoteLine 			 `json:"lines"`
+	Item_count			int 					 `json:"item_count"`
+	Subtotal			Money 					 `json:"subtotal"`
+	Discount			Money 					 `json:"discount"`
+	Coupon_code			*string 				 `json:"coupon_code"`
+	Coupon_error		*string 				 `json:"coupon_error,omitempty"`
+	Shipping_fee		Money 					 `json:"shipping_fee"`
+	Tax					Money 					 `json:"tax"`
+	Tax_included		bool 					 `json:"tax_included"`
+	Tax_lines			[]TaxLine 				 `json:"tax_lines"`
+	Total				Money 					 `json:"total"`
+}
+
+// TaxLine is the tax charged at one rate, with what it was charged on. Included
+// tax was part of the prices, the rest came on top of them.
+type TaxLine struct {
+	Name				string 					 `json:"name" bson:"name"`
+	Country				string 					 `json:"country" bson:"country"`
+	Region				string 					 `json:"region,omitempty" bson:"region,omitempty"`
+	Class				string 					 `json:"class,omitempty" bson:"class,omitempty"`
+	Basis_points		int64 					 `json:"basis_points" bson:"basis_points"`
+	Included			bool 					 `json:"included" bson:"included"`
+	Taxable				Money 					 `json:"taxable" bson:"taxable"`
+	Amount				Money 					 `json:"amount" bson:"amount"`
+}
+
+// WishlistItem is a product, or one variant of it, the user parked for later.
+// Only what it is gets stored, the wishlist is priced from the product when listed.
+type WishlistItem struct {
+	Product_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Sku					string 					 `json:"sku,omitempty" bson:"sku,omitempty"`
+	Added_at			time.Time 				 `json:"added_at" bson:"added_at"`
+}
+
+// WishlistLine is a wishlist item as it is listed, with the current name, price
+// and image of its product. Available is false once the product was archived or
+// deleted, or no longer has the variant, and its price is then left out.
+type WishlistLine struct {
+	Product_id			primitive.ObjectID 		 `json:"_id"`
+	Sku					string 					 `json:"sku,omitempty"`
+	Attributes			map[string]string 		 `json:"attributes,omitempty"`
+	Product_name		*string 				 `json:"product_name"`
+	Price				*Money 					 `json:"price"`
+	Image				*string 				 `json:"image"`
+	Available			bool 					 `json:"available"`
+	In_stock			bool 					 `json:"in_stock"`
+	Added_at			time.Time 				 `json:"added_at"`
+}
+
+// GuestCart is the cart of a visitor who hasn't logged in yet, found by the
+// opaque guest token handed out when it was created
+type GuestCart struct {
+	Token				string 					 `json:"guest_token" bson:"_id"`
+	UserCart			[]ProductUser 			 `json:"usercart" bson:"usercart"`
+	Cart_coupon			*string 				 `json:"cart_coupon" bson:"cart_coupon"`
+	Created_at			time.Time 				 `json:"created_at" bson:"created_at"`
+	Updated_at			time.Time 				 `json:"updated_at" bson:"updated_at"`
+}
+
+// Address is one entry of the user's address book. One address at most is the
+// default for shipping and one for billing, a lone address is both. Country is
+// an ISO 3166-1 alpha-2 code, the addresses package checks the rest against it.
 type Address struct {
 	Address_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Label				*string 				 `json:"label" bson:"label"`
+	Recipient_name		*string 				 `json:"recipient_name" bson:"recipient_name"`
+	Phone				*string 				 `json:"phone" bson:"phone"`
 	House				*string 				 `json:"house_name" bson:"house_name"`
 	Street				*string  				 `json:"street_name" bson:"street_name"`
+	Line2				*string 				 `json:"address_line2" bson:"address_line2"`
 	City				*string 				 `json:"city_name" bson:"city_name"`
+	Region				*string 				 `json:"region" bson:"region"`
 	PostCode			*string 				 `json:"postcode" bson:"postcode"`
+	Country				string 					 `json:"country" bson:"country"`
+	Default_shipping	bool 					 `json:"default_shipping" bson:"default_shipping"`
+	Default_billing		bool 					 `json:"default_billing" bson:"default_billing"`
 }
 
+// Orders live in their own collection and point back at the user through User_id
 type Order struct {
 	Order_id			primitive.ObjectID 		 `json:"_id" bson:"_id"` 
+	User_id				string 					 `json:"user_id" bson:"user_id"`
 	Order_cart			[]ProductUser 		 	 `json:"order_list" bson:"order_list"`
 	Ordered_at			time.Time  		 		 `json:"ordered_at" bson:"ordered_at"`
-	Price				int 		 			 `json:"total_price" bson:"total_price"`
-	Discount			*int 		  			 `json:"discount" bson:"discount"` 
+	Price				Money 		 			 `json:"total_price" bson:"total_price"`
+	Discount			*Money 		  			 `json:"discount" bson:"discount"` 
+	Coupon_code			*string 				 `json:"coupon_code" bson:"coupon_code"`
+	Subtotal			Money 					 `json:"subtotal" bson:"subtotal"`
+	Shipping_fee		Money 					 `json:"shipping_fee" bson:"shipping_fee"`
+	Tax					Money 					 `json:"tax" bson:"tax"`
+	Tax_included		bool 					 `json:"tax_included" bson:"tax_included"`
+	Tax_lines			[]TaxLine 				 `json:"tax_lines" bson:"tax_lines"`
 	Payment_method		Payment  		 		 `json:"payment_method" bson:"payment_method"`
+	Shipping_address	*Address 				 `json:"shipping_address" bson:"shipping_address"`
+	Status				OrderStatus 			 `json:"status" bson:"status"`
+	Status_history		[]StatusChange 			 `json:"status_history" bson:"status_history"`
+	History				[]OrderEvent 			 `json:"history" bson:"history"`
+	Updated_at			time.Time 				 `json:"updated_at" bson:"updated_at"`
 }
 
+type OrderStatus string
+
+const (
+	OrderPending	OrderStatus = "pending"
+	OrderPaid		OrderStatus = "paid"
+	OrderFulfilled	OrderStatus = "fulfilled"
+	OrderDelivered	OrderStatus = "delivered"
+	OrderCancelled	OrderStatus = "cancelled"
+	OrderRefunded	OrderStatus = "refunded"
+)
+
+// StatusChange records when an order entered a status
+type StatusChange struct {
+	Status				OrderStatus 			 `json:"status" bson:"status"`
+	At					time.Time 				 `json:"at" bson:"at"`
+}
+
+// OrderEvent is one thing done to an order after it was placed: cancelling it,
+// refunding it or putting its items back in stock. By is the user who did it
+// and Lines the quantities of the order lines it was about.
+type OrderEvent struct {
+	Action				string 					 `json:"action" bson:"action"`
+	By					string 					 `json:"by" bson:"by"`
+	Reason				*string 				 `json:"reason,omitempty" bson:"reason,omitempty"`
+	Lines				[]OrderLine 			 `json:"lines,omitempty" bson:"lines,omitempty"`
+	Amount				*Money 					 `json:"amount,omitempty" bson:"amount,omitempty"`
+	Tax					*Money 					 `json:"tax,omitempty" bson:"tax,omitempty"`
+	At					time.Time 				 `json:"at" bson:"at"`
+}
+
+// OrderLine points at a quantity of one line of an order
+type OrderLine struct {
+	Product_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Sku					string 					 `json:"sku,omitempty" bson:"sku,omitempty"`
+	Quantity			int 					 `json:"quantity" bson:"quantity"`
+}
+
+// Payment records how an order is paid for and everything that happened to
+// the money since it was authorized
 type Payment struct {
-	Digital bool
-	COD 	bool
-}
\ No newline at end of file
+	Digital 	bool
+	COD 		bool
+	Provider	string 			`json:"provider" bson:"provider"`
+	Reference	string 			`json:"reference" bson:"reference"`
+	Status		PaymentStatus 	`json:"status" bson:"status"`
+	Amount		Money 			`json:"amount" bson:"amount"`
+	Captured	Money 			`json:"captured" bson:"captured"`
+	Refunded	Money 			`json:"refunded" bson:"refunded"`
+	Events		[]PaymentEvent 	`json:"events" bson:"events"`
+	Pending		*PaymentOperation `json:"pending,omitempty" bson:"pending,omitempty"`
+}
+
+type PaymentStatus string
+
+const (
+	PaymentAuthorized		PaymentStatus = "authorized"
+	PaymentCaptured			PaymentStatus = "captured"
+	PaymentPartiallyRefunded	PaymentStatus = "partially_refunded"
+	PaymentRefunded			PaymentStatus = "refunded"
+	PaymentVoided			PaymentStatus = "voided"
+)
+
+type PaymentEvent struct {
+	Action		string 			`json:"action" bson:"action"`
+	Amount		Money 			`json:"amount" bson:"amount"`
+	Key			string 			`json:"key,omitempty" bson:"key,omitempty"`
+	At			time.Time 		`json:"at" bson:"at"`
+}
+
+// PaymentOperation is money an order still has to move at its provider: a
+// capture, void or refund. It is written to the order before the provider is
+// called, and Key goes along with the call, so running it again after a failure
+// can't move the money twice.
+type PaymentOperation struct {
+	Action		string 			`json:"action" bson:"action"`
+	Amount		Money 			`json:"amount" bson:"amount"`
+	Key			string 			`json:"key" bson:"key"`
+	At			time.Time 		`json:"at" bson:"at"`
+}
+
+type CouponType string
+
+const (
+	CouponPercentage	CouponType = "percentage"
+	CouponFixed			CouponType = "fixed"
+)
+
+// Coupon is a discount code managed by admins. Percent is used by percentage
+// coupons and Amount by fixed ones. Zero limits mean unlimited.
+type Coupon struct {
+	Coupon_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Code				string 					 `json:"code" bson:"code" validate:"required,min=3,max=32,alphanum"`
+	Type				CouponType 				 `json:"type" bson:"type" validate:"required,oneof=percentage fixed"`
+	Percent				int64 					 `json:"percent" bson:"percent" validate:"min=0,max=100"`
+	Amount				Money 					 `json:"amount" bson:"amount"`
+	Min_cart_value		*Money 					 `json:"min_cart_value" bson:"min_cart_value"`
+	Expires_at			*time.Time 				 `json:"expires_at" bson:"expires_at"`
+	Max_uses			int 					 `json:"max_uses" bson:"max_uses" validate:"min=0"`
+	Max_uses_per_user	int 					 `json:"max_uses_per_user" bson:"max_uses_per_user" validate:"min=0"`
+	Used_count			int 					 `json:"used_count" bson:"used_count"`
+	Used_by				map[string]int 			 `json:"used_by" bson:"used_by"`
+	Active				bool 					 `json:"active" bson:"active"`
+	Created_at			time.Time 				 `json:"created_at" bson:"created_at"`
+	Updated_at			time.Time 				 `json:"updated_at" bson:"updated_at"`
+}
+
+// Category is a node of the category tree. Top level categories have no parent.
+type Category struct {
+	Category_id			primitive.ObjectID 		 `json:"_id" bson:"_id"`
+	Name				string 					 `json:"name" bson:"name" validate:"required,min=1,max=100"`
+	Slug				string 					 `json:"slug" bson:"slug" validate:"omitempty,max=100"`
+	Parent_id			*primitive.ObjectID 	 `json:"parent_id" bson:"parent_id"`
+	Created_at			time.Time 				 `json:"created_at" bson:"created_at"`
+	Updated_at			time.Time 				 `json:"updated_at" bson:"updated_at"`
+}
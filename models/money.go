@@ -0,0 +1,258 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("Amounts are in different currencies")
+	ErrMoneyOverflow    = errors.New("Amount is too large")
+	ErrInvalidCurrency  = errors.New("Currency must be a three letter ISO 4217 code")
+)
+
+// DefaultCurrency is used for prices stored before amounts carried a currency
+const DefaultCurrency = "USD"
+
+// minorUnitDigits lists the currencies that don't have two decimal places
+var minorUnitDigits = map[string]int{
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "VND": 0,
+}
+
+// Money is an amount in the minor unit of its currency, e.g. cents for USD.
+// The zero value has no currency and adds to anything, which makes it a handy
+// starting point for totals.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// currencyWith returns the currency the result of combining m and other is in
+func (m Money) currencyWith(other Money) (string, error) {
+	switch {
+	case m.Currency == other.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return other.Currency, nil
+	case other.Currency == "" && other.Amount == 0:
+		return m.Currency, nil
+	}
+
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.currencyWith(other)
+	if err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: sum, Currency: currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Mul multiplies the amount, e.g. a unit price by a quantity
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Cmp returns -1, 0 or 1 depending on whether m is less than, equal to or more than other
+func (m Money) Cmp(other Money) (int, error) {
+	if _, err := m.currencyWith(other); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Sum adds all the amounts together, failing on mixed currencies or overflow
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+
+	return total, nil
+}
+
+// MinorUnitDigits is the number of decimal places the currency uses
+func MinorUnitDigits(currency string) int {
+	if digits, ok := minorUnitDigits[currency]; ok {
+		return digits
+	}
+
+	return 2
+}
+
+// String formats the amount in major units, e.g. "12.50 USD"
+func (m Money) String() string {
+	digits := MinorUnitDigits(m.Currency)
+	sign, amount := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, amount = "-", uint64(-(m.Amount+1))+1
+	}
+
+	if digits == 0 {
+		return fmt.Sprintf("%s%d %s", sign, amount, m.Currency)
+	}
+
+	scale := uint64(math.Pow10(digits))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, digits, amount%scale, m.Currency)
+}
+
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate checks the currency code and that the amount isn't negative
+func (m Money) Validate() error {
+	if !validCurrency(m.Currency) {
+		return ErrInvalidCurrency
+	}
+	if m.Amount < 0 {
+		return errors.New("Amount can't be negative")
+	}
+
+	return nil
+}
+
+// UnmarshalJSON upper-cases the currency so "usd" and "USD" are the same thing
+func (m *Money) UnmarshalJSON(data []byte) error {
+	type plain Money
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*m = NewMoney(decoded.Amount, decoded.Currency)
+	if m.Currency != "" && !validCurrency(m.Currency) {
+		return ErrInvalidCurrency
+	}
+
+	return nil
+}
+
+// UnmarshalBSONValue reads the {amount, currency} document, and also the bare
+// numbers that prices used to be stored as. Those were whole units of the
+// default currency.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bsontype.EmbeddedDocument {
+		type plain Money
+		var decoded plain
+		if err := bson.Unmarshal(data, &decoded); err != nil {
+			return err
+		}
+
+		*m = Money(decoded)
+		return nil
+	}
+
+	if t == bsontype.Null {
+		*m = Money{}
+		return nil
+	}
+
+	units, ok := bson.RawValue{Type: t, Value: data}.AsInt64OK()
+	if !ok {
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+
+	legacy, err := NewMoney(units, DefaultCurrency).Mul(int64(math.Pow10(MinorUnitDigits(DefaultCurrency))))
+	if err != nil {
+		return err
+	}
+
+	*m = legacy
+	return nil
+}
+
+// MulRatio multiplies the amount by num/den, rounding half away from zero.
+// It is meant for percentages and rates, e.g. MulRatio(15, 100) for 15%.
+func (m Money) MulRatio(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, errors.New("Ratio has a zero denominator")
+	}
+
+	result := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	denominator := big.NewInt(den)
+	if den < 0 {
+		result.Neg(result)
+		denominator.Neg(denominator)
+	}
+
+	// Add half the denominator before truncating, on the side of the sign
+	half := new(big.Int).Quo(denominator, big.NewInt(2))
+	if result.Sign() < 0 {
+		result.Sub(result, half)
+	} else {
+		result.Add(result, half)
+	}
+	result.Quo(result, denominator)
+
+	if !result.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: result.Int64(), Currency: m.Currency}, nil
+}
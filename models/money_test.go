@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func usd(amount int64) Money {
+	return NewMoney(amount, "USD")
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func() (Money, error)
+		want Money
+		err  error
+	}{
+		{"add", func() (Money, error) { return usd(1250).Add(usd(99)) }, usd(1349), nil},
+		{"add to the zero value", func() (Money, error) { return Money{}.Add(usd(99)) }, usd(99), nil},
+		{"add other currency", func() (Money, error) { return usd(1250).Add(NewMoney(99, "EUR")) }, Money{}, ErrCurrencyMismatch},
+		{"add overflow", func() (Money, error) { return usd(math.MaxInt64).Add(usd(1)) }, Money{}, ErrMoneyOverflow},
+		{"add negative overflow", func() (Money, error) { return usd(math.MinInt64).Add(usd(-1)) }, Money{}, ErrMoneyOverflow},
+		{"sub", func() (Money, error) { return usd(1250).Sub(usd(1300)) }, usd(-50), nil},
+		{"sub other currency", func() (Money, error) { return usd(1250).Sub(NewMoney(1, "JPY")) }, Money{}, ErrCurrencyMismatch},
+		{"sub overflow", func() (Money, error) { return usd(math.MinInt64).Sub(usd(1)) }, Money{}, ErrMoneyOverflow},
+		{"sub of the smallest amount", func() (Money, error) { return usd(0).Sub(usd(math.MinInt64)) }, Money{}, ErrMoneyOverflow},
+		{"mul", func() (Money, error) { return usd(1250).Mul(3) }, usd(3750), nil},
+		{"mul by zero", func() (Money, error) { return usd(math.MaxInt64).Mul(0) }, usd(0), nil},
+		{"mul overflow", func() (Money, error) { return usd(math.MaxInt64 / 2).Mul(3) }, Money{}, ErrMoneyOverflow},
+		{"mul overflow of the smallest amount", func() (Money, error) { return usd(math.MinInt64).Mul(-1) }, Money{}, ErrMoneyOverflow},
+		{"sum", func() (Money, error) { return Sum(usd(1), usd(2), usd(3)) }, usd(6), nil},
+		{"sum of nothing", func() (Money, error) { return Sum() }, Money{}, nil},
+		{"sum of mixed currencies", func() (Money, error) { return Sum(usd(1), NewMoney(2, "EUR")) }, Money{}, ErrCurrencyMismatch},
+		{"sum overflow", func() (Money, error) { return Sum(usd(math.MaxInt64), usd(1)) }, Money{}, ErrMoneyOverflow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.do()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{"exact", 1000, 15, 100, 150},
+		{"rounds down below half", 1001, 15, 100, 150},
+		{"rounds half up", 1010, 15, 100, 152},
+		{"negative rounds down below half", -1001, 15, 100, -150},
+		{"negative rounds half away from zero", -1010, 15, 100, -152},
+		{"negative denominator", 1010, 15, -100, -152},
+		{"third", 100, 1, 3, 33},
+		{"two thirds", 100, 2, 3, 67},
+		{"negative two thirds", -100, 2, 3, -67},
+		{"past int64 on the way", math.MaxInt64, 3, 4, 6917529027641081855},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := usd(test.amount).MulRatio(test.num, test.den)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != usd(test.want) {
+				t.Errorf("MulRatio(%d, %d) of %d = %v, want %v", test.num, test.den, test.amount, got, usd(test.want))
+			}
+		})
+	}
+
+	if _, err := usd(math.MaxInt64).MulRatio(3, 2); !errors.Is(err, ErrMoneyOverflow) {
+		t.Errorf("MulRatio() past int64 error = %v, want %v", err, ErrMoneyOverflow)
+	}
+	if _, err := usd(100).MulRatio(1, 0); err == nil {
+		t.Error("MulRatio() by a zero denominator returned no error")
+	}
+}
+
+func TestMoneyUnmarshalBSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		price interface{}
+		want  Money
+	}{
+		{"document", bson.M{"amount": int64(1250), "currency": "EUR"}, NewMoney(1250, "EUR")},
+		{"legacy int32 price", int32(12), usd(1200)},
+		{"legacy int64 price", int64(12), usd(1200)},
+		{"legacy float price", float64(12), usd(1200)},
+		{"null", nil, Money{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"price": test.price})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var product struct {
+				Price Money `bson:"price"`
+			}
+			if err = bson.Unmarshal(data, &product); err != nil {
+				t.Fatal(err)
+			}
+			if product.Price != test.want {
+				t.Errorf("decoded %+v, want %+v", product.Price, test.want)
+			}
+		})
+	}
+
+	data, err := bson.Marshal(bson.M{"price": "12.50"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var product struct {
+		Price Money `bson:"price"`
+	}
+	if err = bson.Unmarshal(data, &product); err == nil {
+		t.Errorf("decoded a string price into %+v, want an error", product.Price)
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want Money
+		err  bool
+	}{
+		{`{"amount": 1250, "currency": "usd"}`, usd(1250), false},
+		{`{"amount": 1250, "currency": "Eur"}`, NewMoney(1250, "EUR"), false},
+		{`{"amount": 0}`, Money{}, false},
+		{`{"amount": 1250, "currency": "dollars"}`, Money{}, true},
+		{`{"amount": 1250, "currency": "us1"}`, Money{}, true},
+		{`12.50`, Money{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(test.data), &got)
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			if !test.err && got != test.want {
+				t.Errorf("decoded %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
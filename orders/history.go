@@ -0,0 +1,143 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidCursor = errors.New("Cursor is not valid for this listing")
+	ErrInvalidQuery  = errors.New("Listing options are not valid")
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Query is one page of a user's orders, latest first. From is inclusive and
+// To exclusive, Statuses keeps the orders in any of them.
+type Query struct {
+	User_id  string
+	Statuses []models.OrderStatus
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	After    *Cursor
+}
+
+// Page is what the order history responds with. Next_cursor is empty on the last page.
+type Page struct {
+	Orders      []models.Order `json:"orders"`
+	Next_cursor string         `json:"next_cursor"`
+	Total       int64          `json:"total"`
+}
+
+// Cursor remembers the last order of a page
+type Cursor struct {
+	Ordered_at time.Time          `json:"at"`
+	ID         primitive.ObjectID `json:"id"`
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// Nothing may follow the cursor, it would have been tampered with
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (cursor Cursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Normalize fills in the defaults and checks the options fit together
+func (query *Query) Normalize() error {
+	if query.User_id == "" {
+		return ErrInvalidQuery
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit > MaxLimit {
+		query.Limit = MaxLimit
+	}
+	for _, status := range query.Statuses {
+		if !Valid(status) {
+			return ErrUnknownStatus
+		}
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return ErrInvalidQuery
+	}
+
+	return nil
+}
+
+// CursorFor is the cursor of the page that ends with the order
+func CursorFor(order models.Order) Cursor {
+	return Cursor{Ordered_at: order.Ordered_at, ID: order.Order_id}
+}
+
+// Matches applies the user, status and date filters
+func Matches(order models.Order, query Query) bool {
+	if order.User_id != query.User_id {
+		return false
+	}
+	if query.From != nil && order.Ordered_at.Before(*query.From) {
+		return false
+	}
+	if query.To != nil && !order.Ordered_at.Before(*query.To) {
+		return false
+	}
+	if len(query.Statuses) == 0 {
+		return true
+	}
+
+	for _, status := range query.Statuses {
+		if order.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Less reports whether a comes before b, which is when it was placed later
+func Less(a, b models.Order) bool {
+	if !a.Ordered_at.Equal(b.Ordered_at) {
+		return a.Ordered_at.After(b.Ordered_at)
+	}
+
+	return bytes.Compare(a.Order_id[:], b.Order_id[:]) > 0
+}
+
+// After reports whether the order comes after the query's cursor
+func After(order models.Order, query Query) bool {
+	if query.After == nil {
+		return true
+	}
+
+	return Less(models.Order{Ordered_at: query.After.Ordered_at, Order_id: query.After.ID}, order)
+}
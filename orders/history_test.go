@@ -0,0 +1,29 @@
+package orders
+
+import (
+	"errors"
+	"testing"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	cursor := CursorFor(models.Order{Order_id: primitive.NewObjectID(), Ordered_at: at})
+	encoded := cursor.Encode()
+
+	decoded, err := DecodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if !decoded.Ordered_at.Equal(at) || decoded.ID != cursor.ID {
+		t.Errorf("DecodeCursor() = %+v, want %+v", decoded, cursor)
+	}
+
+	for _, bad := range []string{"garbage", encoded[:len(encoded)-4], encoded + "AAAA"} {
+		if _, err := DecodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) error = %v, want %v", bad, err, ErrInvalidCursor)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-com/models"
+)
+
+var (
+	ErrInvalidTransition = errors.New("Order status transition is not allowed")
+	ErrUnknownStatus     = errors.New("Order status is not known")
+)
+
+// transitions lists, for every status, the statuses an order may move to next.
+// Cancelled and refunded are final.
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderPending:   {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderFulfilled, models.OrderCancelled, models.OrderRefunded},
+	models.OrderFulfilled: {models.OrderDelivered, models.OrderRefunded},
+	models.OrderDelivered: {models.OrderRefunded},
+	models.OrderCancelled: {},
+	models.OrderRefunded:  {},
+}
+
+// Valid reports whether status is one of the known order statuses
+func Valid(status models.OrderStatus) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// NextStatuses returns the statuses an order in the given status may move to
+func NextStatuses(from models.OrderStatus) []models.OrderStatus {
+	return append([]models.OrderStatus{}, transitions[from]...)
+}
+
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New puts a freshly created order into the pending status
+func New(order *models.Order, at time.Time) {
+	order.Status = models.OrderPending
+	order.Status_history = []models.StatusChange{{Status: models.OrderPending, At: at}}
+	order.Updated_at = at
+}
+
+// Transition moves the order to the given status and records when it happened.
+// The order is left untouched when the move is not allowed.
+func Transition(order *models.Order, to models.OrderStatus, at time.Time) error {
+	if !Valid(to) {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, to)
+	}
+
+	if !CanTransition(order.Status, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, to)
+	}
+
+	order.Status = to
+	order.Status_history = append(order.Status_history, models.StatusChange{Status: to, At: at})
+	order.Updated_at = at
+	return nil
+}
@@ -0,0 +1,110 @@
+package orders
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from, to models.OrderStatus
+		err      error
+	}{
+		{models.OrderPending, models.OrderPaid, nil},
+		{models.OrderPending, models.OrderCancelled, nil},
+		{models.OrderPaid, models.OrderFulfilled, nil},
+		{models.OrderPaid, models.OrderCancelled, nil},
+		{models.OrderPaid, models.OrderRefunded, nil},
+		{models.OrderFulfilled, models.OrderDelivered, nil},
+		{models.OrderFulfilled, models.OrderRefunded, nil},
+		{models.OrderDelivered, models.OrderRefunded, nil},
+		{models.OrderPending, models.OrderFulfilled, ErrInvalidTransition},
+		{models.OrderPending, models.OrderRefunded, ErrInvalidTransition},
+		{models.OrderPaid, models.OrderPending, ErrInvalidTransition},
+		{models.OrderFulfilled, models.OrderCancelled, ErrInvalidTransition},
+		{models.OrderDelivered, models.OrderFulfilled, ErrInvalidTransition},
+		{models.OrderCancelled, models.OrderPaid, ErrInvalidTransition},
+		{models.OrderRefunded, models.OrderPaid, ErrInvalidTransition},
+		{models.OrderPaid, models.OrderPaid, ErrInvalidTransition},
+		{models.OrderPaid, "shipped", ErrUnknownStatus},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.from)+" to "+string(test.to), func(t *testing.T) {
+			order := models.Order{}
+			New(&order, at)
+			order.Status = test.from
+			history := len(order.Status_history)
+
+			err := Transition(&order, test.to, at.Add(time.Hour))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Transition() error = %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				if order.Status != test.from || len(order.Status_history) != history || !order.Updated_at.Equal(at) {
+					t.Errorf("refused transition changed the order: %+v", order)
+				}
+				return
+			}
+			if order.Status != test.to {
+				t.Errorf("Status = %s, want %s", order.Status, test.to)
+			}
+			last := order.Status_history[len(order.Status_history)-1]
+			if last.Status != test.to || !last.At.Equal(at.Add(time.Hour)) || !order.Updated_at.Equal(at.Add(time.Hour)) {
+				t.Errorf("transition not recorded: %+v", order.Status_history)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	var order models.Order
+	New(&order, at)
+
+	if order.Status != models.OrderPending || len(order.Status_history) != 1 || !order.Updated_at.Equal(at) {
+		t.Errorf("New() = %+v, want a pending order with one status change", order)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	reason := "changed my mind"
+	tests := []struct {
+		status models.OrderStatus
+		err    error
+	}{
+		{models.OrderPending, nil},
+		{models.OrderPaid, nil},
+		{models.OrderFulfilled, ErrNotCancellable},
+		{models.OrderDelivered, ErrNotCancellable},
+		{models.OrderCancelled, ErrNotCancellable},
+		{models.OrderRefunded, ErrNotCancellable},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.status), func(t *testing.T) {
+			order := models.Order{Status: test.status}
+
+			err := Cancel(&order, "user", &reason, at)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Cancel() error = %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				if order.Status != test.status || len(order.History) != 0 {
+					t.Errorf("refused cancel changed the order: %+v", order)
+				}
+				return
+			}
+			if order.Status != models.OrderCancelled {
+				t.Errorf("Status = %s, want cancelled", order.Status)
+			}
+			if len(order.History) != 1 || order.History[0].Action != "cancel" || order.History[0].By != "user" || order.History[0].Reason != &reason {
+				t.Errorf("History = %+v, want one cancel by user with the reason", order.History)
+			}
+		})
+	}
+}
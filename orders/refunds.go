@@ -0,0 +1,296 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-com/models"
+)
+
+var (
+	ErrNotCancellable  = errors.New("Order can no longer be cancelled")
+	ErrNotRefundable   = errors.New("Order can only be refunded once it is paid")
+	ErrInvalidRefund   = errors.New("Refund is not valid for this order")
+	ErrNothingToRefund = errors.New("Order has nothing left to refund")
+)
+
+// Cancellable reports whether the customer can still cancel the order, which
+// is until it is fulfilled
+func Cancellable(order models.Order) bool {
+	return order.Status == models.OrderPending || order.Status == models.OrderPaid
+}
+
+// Refundable reports whether money can be given back for the order
+func Refundable(order models.Order) bool {
+	switch order.Status {
+	case models.OrderPaid, models.OrderFulfilled, models.OrderDelivered:
+		return true
+	}
+
+	return false
+}
+
+func record(order *models.Order, event models.OrderEvent) {
+	order.History = append(order.History, event)
+	order.Updated_at = event.At
+}
+
+// Cancel moves the order to cancelled and records who did it and why
+func Cancel(order *models.Order, by string, reason *string, at time.Time) error {
+	if !Cancellable(*order) {
+		return ErrNotCancellable
+	}
+	if err := Transition(order, models.OrderCancelled, at); err != nil {
+		return err
+	}
+
+	record(order, models.OrderEvent{Action: "cancel", By: by, Reason: reason, At: at})
+	return nil
+}
+
+// lineIndex finds the order line of a product, or of one variant of it
+func lineIndex(order models.Order, line models.OrderLine) int {
+	for i, item := range order.Order_cart {
+		if item.Product_id == line.Product_id && item.Sku == line.Sku {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Unrefunded is what is left of every order line after its refunds
+func Unrefunded(order models.Order) []models.OrderLine {
+	var lines []models.OrderLine
+	for _, item := range order.Order_cart {
+		if left := item.Quantity - item.Refunded_quantity; left > 0 {
+			lines = append(lines, models.OrderLine{Product_id: item.Product_id, Sku: item.Sku, Quantity: left})
+		}
+	}
+
+	return lines
+}
+
+// Unrestocked is what of every order line hasn't been put back in stock yet
+func Unrestocked(order models.Order) []models.OrderLine {
+	var lines []models.OrderLine
+	for _, item := range order.Order_cart {
+		if left := item.Quantity - item.Restocked_quantity; left > 0 {
+			lines = append(lines, models.OrderLine{Product_id: item.Product_id, Sku: item.Sku, Quantity: left})
+		}
+	}
+
+	return lines
+}
+
+// Refunded is how much has been given back for the order so far
+func Refunded(order models.Order) (models.Money, error) {
+	refunded := models.Money{Currency: order.Price.Currency}
+	for _, event := range order.History {
+		if event.Action != "refund" || event.Amount == nil {
+			continue
+		}
+		var err error
+		if refunded, err = refunded.Add(*event.Amount); err != nil {
+			return models.Money{}, err
+		}
+	}
+
+	return refunded, nil
+}
+
+// lineTax is the tax on the first quantity items of the order line. Taking the
+// tax of a refund as the difference between two of these makes the refunds of
+// a line add up to exactly its tax.
+func lineTax(item models.ProductUser, quantity int) (models.Money, error) {
+	if item.Tax == nil || item.Quantity == 0 {
+		return models.Money{Currency: item.Price.Currency}, nil
+	}
+
+	return item.Tax.MulRatio(int64(quantity), int64(item.Quantity))
+}
+
+// refundTax is the tax on quantity more items of the order line, on top of what
+// was refunded of it already
+func refundTax(item models.ProductUser, quantity int) (models.Money, error) {
+	before, err := lineTax(item, item.Refunded_quantity)
+	if err != nil {
+		return models.Money{}, err
+	}
+	after, err := lineTax(item, item.Refunded_quantity+quantity)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	return after.Sub(before)
+}
+
+// PlanRefund works out how much to give back for the given quantities of the
+// order's lines. Without lines it refunds everything that hasn't been yet.
+// Lines are worth their share of the total after the discount, tax charged on
+// top of their price included, and the refund that leaves nothing behind takes
+// whatever the earlier ones rounded away.
+func PlanRefund(order models.Order, lines []models.OrderLine) ([]models.OrderLine, models.Money, error) {
+	if !Refundable(order) {
+		return nil, models.Money{}, ErrNotRefundable
+	}
+
+	full := len(lines) == 0
+	if full {
+		lines = Unrefunded(order)
+	}
+
+	// Merge the lines that name the same order line before checking them
+	requested := make([]int, len(order.Order_cart))
+	merged := make([]models.OrderLine, 0, len(lines))
+	for _, line := range lines {
+		i := lineIndex(order, line)
+		if i < 0 {
+			return nil, models.Money{}, fmt.Errorf("%w: product %s %q is not in the order", ErrInvalidRefund, line.Product_id.Hex(), line.Sku)
+		}
+		if line.Quantity <= 0 {
+			return nil, models.Money{}, fmt.Errorf("%w: quantities must be positive", ErrInvalidRefund)
+		}
+		if requested[i] == 0 {
+			merged = append(merged, models.OrderLine{Product_id: line.Product_id, Sku: line.Sku})
+		}
+		requested[i] += line.Quantity
+	}
+
+	value := models.Money{Currency: order.Price.Currency}
+	subtotal := models.Money{Currency: order.Price.Currency}
+	everything := true
+	for i, item := range order.Order_cart {
+		left := item.Quantity - item.Refunded_quantity
+		if requested[i] > left {
+			return nil, models.Money{}, fmt.Errorf("%w: only %d of product %s %q are left to refund", ErrInvalidRefund, left, item.Product_id.Hex(), item.Sku)
+		}
+		if requested[i] < left {
+			everything = false
+		}
+
+		line, err := item.Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return nil, models.Money{}, err
+		}
+		if subtotal, err = subtotal.Add(line); err != nil {
+			return nil, models.Money{}, err
+		}
+		refunding, err := item.Price.Mul(int64(requested[i]))
+		if err != nil {
+			return nil, models.Money{}, err
+		}
+		if value, err = value.Add(refunding); err != nil {
+			return nil, models.Money{}, err
+		}
+
+		if order.Tax_included {
+			continue
+		}
+		tax, err := lineTax(item, item.Quantity)
+		if err != nil {
+			return nil, models.Money{}, err
+		}
+		if subtotal, err = subtotal.Add(tax); err != nil {
+			return nil, models.Money{}, err
+		}
+		if tax, err = refundTax(item, requested[i]); err != nil {
+			return nil, models.Money{}, err
+		}
+		if value, err = value.Add(tax); err != nil {
+			return nil, models.Money{}, err
+		}
+	}
+	for j := range merged {
+		merged[j].Quantity = requested[lineIndex(order, merged[j])]
+	}
+
+	refunded, err := Refunded(order)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	remaining, err := order.Price.Sub(refunded)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	if len(merged) == 0 && (!full || remaining.IsZero()) {
+		return nil, models.Money{}, ErrNothingToRefund
+	}
+	if everything {
+		return merged, remaining, nil
+	}
+
+	amount := value
+	if !subtotal.IsZero() {
+		if amount, err = value.MulRatio(order.Price.Amount, subtotal.Amount); err != nil {
+			return nil, models.Money{}, err
+		}
+	}
+	if cmp, err := amount.Cmp(remaining); err != nil {
+		return nil, models.Money{}, err
+	} else if cmp > 0 {
+		amount = remaining
+	}
+
+	return merged, amount, nil
+}
+
+// ApplyRefund records a refund worked out by PlanRefund against the order's
+// lines, along with the part of it that was tax. Once every line is refunded in
+// full the order moves to refunded.
+func ApplyRefund(order *models.Order, lines []models.OrderLine, amount models.Money, by string, reason *string, at time.Time) error {
+	tax := models.Money{Currency: order.Price.Currency}
+	for _, line := range lines {
+		item := &order.Order_cart[lineIndex(*order, line)]
+		lineTax, err := refundTax(*item, line.Quantity)
+		if err != nil {
+			return err
+		}
+		if tax, err = tax.Add(lineTax); err != nil {
+			return err
+		}
+		item.Refunded_quantity += line.Quantity
+	}
+
+	if len(Unrefunded(*order)) == 0 {
+		if err := Transition(order, models.OrderRefunded, at); err != nil {
+			return err
+		}
+	}
+
+	event := models.OrderEvent{Action: "refund", By: by, Reason: reason, Lines: lines, Amount: &amount, At: at}
+	if len(order.Tax_lines) > 0 {
+		event.Tax = &tax
+	}
+	record(order, event)
+	return nil
+}
+
+// Restock marks the lines as back in stock, as much of them as wasn't yet, and
+// returns what the caller should add to the stock levels
+func Restock(order *models.Order, lines []models.OrderLine, by string, at time.Time) []models.OrderLine {
+	var restocked []models.OrderLine
+	for _, line := range lines {
+		i := lineIndex(*order, line)
+		if i < 0 {
+			continue
+		}
+		item := &order.Order_cart[i]
+		quantity := line.Quantity
+		if left := item.Quantity - item.Restocked_quantity; quantity > left {
+			quantity = left
+		}
+		if quantity <= 0 {
+			continue
+		}
+		item.Restocked_quantity += quantity
+		restocked = append(restocked, models.OrderLine{Product_id: line.Product_id, Sku: line.Sku, Quantity: quantity})
+	}
+
+	if len(restocked) > 0 {
+		record(order, models.OrderEvent{Action: "restock", By: by, Lines: restocked, At: at})
+	}
+
+	return restocked
+}
@@ -0,0 +1,233 @@
+package orders
+
+import (
+	"errors"
+	"testing"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+// paidOrder is a paid order for three mugs at 10.00 and a teapot at 25.00,
+// 55.00 in all, sold for 40.00 after a coupon
+func paidOrder() (models.Order, primitive.ObjectID, primitive.ObjectID) {
+	mug, teapot := primitive.NewObjectID(), primitive.NewObjectID()
+	order := models.Order{
+		Order_cart: []models.ProductUser{
+			{Product_id: mug, Price: usd(1000), Quantity: 3},
+			{Product_id: teapot, Price: usd(2500), Quantity: 1},
+		},
+		Price: usd(4000),
+	}
+	New(&order, at)
+	order.Status = models.OrderPaid
+
+	return order, mug, teapot
+}
+
+func refund(t *testing.T, order *models.Order, lines []models.OrderLine) models.Money {
+	t.Helper()
+	refunding, amount, err := PlanRefund(*order, lines)
+	if err != nil {
+		t.Fatalf("PlanRefund(%v) error = %v", lines, err)
+	}
+	if err = ApplyRefund(order, refunding, amount, "admin", nil, at); err != nil {
+		t.Fatalf("ApplyRefund() error = %v", err)
+	}
+
+	return amount
+}
+
+func TestPartialRefundsAddUpToThePrice(t *testing.T) {
+	order, mug, teapot := paidOrder()
+
+	// A mug is worth 10.00 of 55.00 before the discount, 7.27 of the 40.00 paid
+	var amounts []models.Money
+	for i := 0; i < 3; i++ {
+		amounts = append(amounts, refund(t, &order, []models.OrderLine{{Product_id: mug, Quantity: 1}}))
+		if order.Status != models.OrderPaid {
+			t.Fatalf("Status = %s after a partial refund, want paid", order.Status)
+		}
+	}
+	for _, amount := range amounts {
+		if amount != usd(727) {
+			t.Errorf("mug refund = %v, want 7.27 USD", amount)
+		}
+	}
+
+	// The last refund takes whatever the earlier ones rounded away
+	last := refund(t, &order, []models.OrderLine{{Product_id: teapot, Quantity: 1}})
+	if last != usd(4000-3*727) {
+		t.Errorf("last refund = %v, want %v", last, usd(4000-3*727))
+	}
+
+	refunded, err := Refunded(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunded != order.Price {
+		t.Errorf("Refunded() = %v, want the price %v", refunded, order.Price)
+	}
+	if order.Status != models.OrderRefunded {
+		t.Errorf("Status = %s, want refunded", order.Status)
+	}
+
+	if _, _, err = PlanRefund(order, nil); !errors.Is(err, ErrNotRefundable) {
+		t.Errorf("PlanRefund() of a refunded order error = %v, want %v", err, ErrNotRefundable)
+	}
+}
+
+func TestFullRefundAfterPartialRefund(t *testing.T) {
+	order, mug, _ := paidOrder()
+
+	first := refund(t, &order, []models.OrderLine{{Product_id: mug, Quantity: 2}})
+	rest := refund(t, &order, nil)
+
+	total, err := first.Add(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != order.Price {
+		t.Errorf("refunds add up to %v, want the price %v", total, order.Price)
+	}
+	if order.Status != models.OrderRefunded {
+		t.Errorf("Status = %s, want refunded", order.Status)
+	}
+	if lines := order.History[len(order.History)-1].Lines; len(lines) != 2 || lines[0].Quantity != 1 || lines[1].Quantity != 1 {
+		t.Errorf("full refund lines = %+v, want what was left of both lines", lines)
+	}
+}
+
+func TestPlanRefundRejects(t *testing.T) {
+	order, mug, teapot := paidOrder()
+	pending, _, _ := paidOrder()
+	pending.Status = models.OrderPending
+
+	tests := []struct {
+		name  string
+		order models.Order
+		lines []models.OrderLine
+		err   error
+	}{
+		{"unpaid order", pending, nil, ErrNotRefundable},
+		{"product not in the order", order, []models.OrderLine{{Product_id: primitive.NewObjectID(), Quantity: 1}}, ErrInvalidRefund},
+		{"zero quantity", order, []models.OrderLine{{Product_id: mug, Quantity: 0}}, ErrInvalidRefund},
+		{"more than was ordered", order, []models.OrderLine{{Product_id: teapot, Quantity: 2}}, ErrInvalidRefund},
+		{"same line twice adding up to too many", order, []models.OrderLine{{Product_id: mug, Quantity: 2}, {Product_id: mug, Quantity: 2}}, ErrInvalidRefund},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := PlanRefund(test.order, test.lines); !errors.Is(err, test.err) {
+				t.Errorf("PlanRefund() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRestock(t *testing.T) {
+	order, mug, teapot := paidOrder()
+
+	restocked := Restock(&order, []models.OrderLine{{Product_id: mug, Quantity: 2}}, "admin", at)
+	if len(restocked) != 1 || restocked[0].Quantity != 2 {
+		t.Fatalf("Restock() = %+v, want 2 mugs", restocked)
+	}
+
+	// Only what wasn't put back yet is restocked, and lines not in the order are skipped
+	restocked = Restock(&order, append(Unrestocked(order), models.OrderLine{Product_id: primitive.NewObjectID(), Quantity: 1}), "admin", at)
+	want := []models.OrderLine{{Product_id: mug, Quantity: 1}, {Product_id: teapot, Quantity: 1}}
+	if len(restocked) != len(want) {
+		t.Fatalf("Restock() = %+v, want %+v", restocked, want)
+	}
+	for i := range want {
+		if restocked[i] != want[i] {
+			t.Errorf("Restock()[%d] = %+v, want %+v", i, restocked[i], want[i])
+		}
+	}
+
+	if restocked = Restock(&order, []models.OrderLine{{Product_id: mug, Quantity: 1}}, "admin", at); len(restocked) != 0 {
+		t.Errorf("Restock() of a line back in stock = %+v, want nothing", restocked)
+	}
+	if events := len(order.History); events != 2 {
+		t.Errorf("History has %d events, want a restock event for each restock that did something", events)
+	}
+}
+
+func TestRefundTaxAddsUpToTheLineTax(t *testing.T) {
+	kettle := primitive.NewObjectID()
+	kettleTax := usd(248)
+	order := models.Order{
+		Order_cart: []models.ProductUser{{Product_id: kettle, Price: usd(1000), Quantity: 3, Tax: &kettleTax}},
+		Tax:        kettleTax,
+		Tax_lines:  []models.TaxLine{{Name: "Sales tax", Country: "US", Basis_points: 825, Taxable: usd(3000), Amount: kettleTax}},
+		Price:      usd(3248),
+	}
+	New(&order, at)
+	order.Status = models.OrderPaid
+
+	// A third of 2.48 doesn't divide evenly, the refunds take 0.83, 0.82 and 0.83
+	wantTax := []int64{83, 82, 83}
+	var total, tax models.Money
+	for i := range wantTax {
+		amount := refund(t, &order, []models.OrderLine{{Product_id: kettle, Quantity: 1}})
+		event := order.History[len(order.History)-1]
+		if event.Tax == nil || *event.Tax != usd(wantTax[i]) {
+			t.Errorf("refund %d tax = %v, want %v", i, event.Tax, usd(wantTax[i]))
+		}
+		if amount != usd(1000+wantTax[i]) {
+			t.Errorf("refund %d = %v, want the price with its tax %v", i, amount, usd(1000+wantTax[i]))
+		}
+
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			t.Fatal(err)
+		}
+		if event.Tax != nil {
+			if tax, err = tax.Add(*event.Tax); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if tax != kettleTax {
+		t.Errorf("refunded tax = %v, want the line's tax %v", tax, kettleTax)
+	}
+	if total != order.Price {
+		t.Errorf("refunds add up to %v, want the price %v", total, order.Price)
+	}
+}
+
+func TestRefundTaxIncluded(t *testing.T) {
+	teapot := primitive.NewObjectID()
+	teapotTax := models.NewMoney(479, "EUR")
+	order := models.Order{
+		Order_cart:   []models.ProductUser{{Product_id: teapot, Price: models.NewMoney(1500, "EUR"), Quantity: 2, Tax: &teapotTax}},
+		Tax:          teapotTax,
+		Tax_included: true,
+		Tax_lines:    []models.TaxLine{{Name: "MwSt", Country: "DE", Basis_points: 1900, Included: true, Amount: teapotTax}},
+		Price:        models.NewMoney(3000, "EUR"),
+	}
+	New(&order, at)
+	order.Status = models.OrderPaid
+
+	// Tax in the prices is refunded with them, not on top
+	amount := refund(t, &order, []models.OrderLine{{Product_id: teapot, Quantity: 1}})
+	if amount != models.NewMoney(1500, "EUR") {
+		t.Errorf("refund = %v, want the price 15.00 EUR", amount)
+	}
+	if tax := order.History[len(order.History)-1].Tax; tax == nil || *tax != models.NewMoney(240, "EUR") {
+		t.Errorf("refund tax = %v, want 2.40 EUR", tax)
+	}
+
+	if amount = refund(t, &order, nil); amount != models.NewMoney(1500, "EUR") {
+		t.Errorf("last refund = %v, want 15.00 EUR", amount)
+	}
+	if tax := order.History[len(order.History)-1].Tax; tax == nil || *tax != models.NewMoney(239, "EUR") {
+		t.Errorf("last refund tax = %v, want the 2.39 EUR left of the line's tax", tax)
+	}
+}
@@ -0,0 +1,39 @@
+package payments
+
+import (
+	"context"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const CashOnDeliveryName = "cod"
+
+// CashOnDelivery never talks to anyone. The money changes hands at the door,
+// so capturing just means the courier came back with it.
+type CashOnDelivery struct{}
+
+func NewCashOnDelivery() *CashOnDelivery {
+	return &CashOnDelivery{}
+}
+
+func (CashOnDelivery) Name() string {
+	return CashOnDeliveryName
+}
+
+func (CashOnDelivery) Authorize(ctx context.Context, amount models.Money, source string) (string, error) {
+	return "cod_" + primitive.NewObjectID().Hex(), nil
+}
+
+func (CashOnDelivery) Capture(ctx context.Context, reference string, amount models.Money, key string) error {
+	return nil
+}
+
+func (CashOnDelivery) Refund(ctx context.Context, reference string, amount models.Money, key string) error {
+	return nil
+}
+
+func (CashOnDelivery) Void(ctx context.Context, reference string, key string) error {
+	return nil
+}
@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"context"
+	"sync"
+
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const FakeCardName = "card"
+
+// Card tokens the fake provider understands. Any other token is accepted.
+const (
+	TokenDeclined          = "tok_declined"
+	TokenInsufficientFunds = "tok_insufficient_funds"
+)
+
+type fakeCharge struct {
+	authorized models.Money
+	captured   models.Money
+	refunded   models.Money
+	voided     bool
+}
+
+// FakeCard behaves like a card gateway without leaving the process, so the
+// digital payment flow can be exercised end to end. It keeps its own ledger
+// and refuses anything a real gateway would refuse. Like a real gateway it
+// remembers the idempotency keys of the calls that went through.
+type FakeCard struct {
+	mu      sync.Mutex
+	charges map[string]*fakeCharge
+	done    map[string]bool
+}
+
+func NewFakeCard() *FakeCard {
+	return &FakeCard{charges: make(map[string]*fakeCharge), done: make(map[string]bool)}
+}
+
+func (card *FakeCard) Name() string {
+	return FakeCardName
+}
+
+func (card *FakeCard) Authorize(ctx context.Context, amount models.Money, source string) (string, error) {
+	switch source {
+	case "", TokenDeclined, TokenInsufficientFunds:
+		return "", ErrPaymentDeclined
+	}
+
+	card.mu.Lock()
+	defer card.mu.Unlock()
+
+	reference := "card_" + primitive.NewObjectID().Hex()
+	card.charges[reference] = &fakeCharge{authorized: amount}
+	return reference, nil
+}
+
+func (card *FakeCard) Capture(ctx context.Context, reference string, amount models.Money, key string) error {
+	card.mu.Lock()
+	defer card.mu.Unlock()
+
+	if card.done[key] {
+		return nil
+	}
+
+	charge, ok := card.charges[reference]
+	if !ok || charge.voided || !charge.captured.IsZero() {
+		return ErrInvalidOperation
+	}
+
+	if cmp, err := amount.Cmp(charge.authorized); err != nil || cmp > 0 {
+		return ErrAmountTooLarge
+	}
+
+	charge.captured = amount
+	card.done[key] = true
+	return nil
+}
+
+func (card *FakeCard) Refund(ctx context.Context, reference string, amount models.Money, key string) error {
+	card.mu.Lock()
+	defer card.mu.Unlock()
+
+	if card.done[key] {
+		return nil
+	}
+
+	charge, ok := card.charges[reference]
+	if !ok || charge.captured.IsZero() {
+		return ErrInvalidOperation
+	}
+
+	refunded, err := charge.refunded.Add(amount)
+	if err != nil {
+		return err
+	}
+	if cmp, err := refunded.Cmp(charge.captured); err != nil || cmp > 0 {
+		return ErrAmountTooLarge
+	}
+
+	charge.refunded = refunded
+	card.done[key] = true
+	return nil
+}
+
+func (card *FakeCard) Void(ctx context.Context, reference string, key string) error {
+	card.mu.Lock()
+	defer card.mu.Unlock()
+
+	if card.done[key] {
+		return nil
+	}
+
+	charge, ok := card.charges[reference]
+	if !ok || !charge.captured.IsZero() {
+		return ErrInvalidOperation
+	}
+
+	charge.voided = true
+	card.done[key] = true
+	return nil
+}
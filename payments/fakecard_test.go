@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/models"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+func TestFakeCardAuthorize(t *testing.T) {
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{"tok_visa", nil},
+		{TokenDeclined, ErrPaymentDeclined},
+		{TokenInsufficientFunds, ErrPaymentDeclined},
+		{"", ErrPaymentDeclined},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			payment, err := Authorize(context.Background(), NewFakeCard(), usd(4000), test.source, at)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Authorize() error = %v, want %v", err, test.err)
+			}
+			if err != nil && payment.Reference != "" {
+				t.Errorf("declined Authorize() returned payment %+v", payment)
+			}
+			if err == nil && (payment.Status != models.PaymentAuthorized || payment.Amount != usd(4000) || !payment.Digital) {
+				t.Errorf("Authorize() = %+v, want a digital payment authorized for 40.00 USD", payment)
+			}
+		})
+	}
+}
+
+// cardCall is one call to the fake card on a charge authorized for 40.00
+type cardCall struct {
+	action string
+	amount int64
+	key    string
+	err    error
+}
+
+func TestFakeCardLedger(t *testing.T) {
+	tests := []struct {
+		name     string
+		calls    []cardCall
+		captured int64
+		refunded int64
+		voided   bool
+	}{
+		{"replayed capture", []cardCall{
+			{ActionCapture, 4000, "k1", nil},
+			{ActionCapture, 4000, "k1", nil},
+		}, 4000, 0, false},
+		{"second capture", []cardCall{
+			{ActionCapture, 4000, "k1", nil},
+			{ActionCapture, 4000, "k2", ErrInvalidOperation},
+		}, 4000, 0, false},
+		{"capture over the authorized amount", []cardCall{
+			{ActionCapture, 4001, "k1", ErrAmountTooLarge},
+		}, 0, 0, false},
+		{"refused key goes through later", []cardCall{
+			{ActionCapture, 4001, "k1", ErrAmountTooLarge},
+			{ActionCapture, 4000, "k1", nil},
+		}, 4000, 0, false},
+		{"replayed refund", []cardCall{
+			{ActionCapture, 4000, "k1", nil},
+			{ActionRefund, 3000, "k2", nil},
+			{ActionRefund, 3000, "k2", nil},
+			{ActionRefund, 1000, "k3", nil},
+		}, 4000, 4000, false},
+		{"refund over the captured amount", []cardCall{
+			{ActionCapture, 4000, "k1", nil},
+			{ActionRefund, 3000, "k2", nil},
+			{ActionRefund, 1001, "k3", ErrAmountTooLarge},
+		}, 4000, 3000, false},
+		{"refund before capture", []cardCall{
+			{ActionRefund, 1000, "k1", ErrInvalidOperation},
+		}, 0, 0, false},
+		{"replayed void", []cardCall{
+			{ActionVoid, 0, "k1", nil},
+			{ActionVoid, 0, "k1", nil},
+			{ActionCapture, 4000, "k2", ErrInvalidOperation},
+		}, 0, 0, true},
+		{"void after capture", []cardCall{
+			{ActionCapture, 4000, "k1", nil},
+			{ActionVoid, 0, "k2", ErrInvalidOperation},
+		}, 4000, 0, false},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := NewFakeCard()
+			reference, err := card.Authorize(ctx, usd(4000), "tok_visa")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, call := range test.calls {
+				op := models.PaymentOperation{Action: call.action, Amount: usd(call.amount), Key: call.key}
+				if err := Execute(ctx, card, models.Payment{Reference: reference}, op); !errors.Is(err, call.err) {
+					t.Fatalf("%s %d with %s error = %v, want %v", call.action, call.amount, call.key, err, call.err)
+				}
+			}
+
+			charge := card.charges[reference]
+			if charge.captured.Amount != test.captured || charge.refunded.Amount != test.refunded || charge.voided != test.voided {
+				t.Errorf("charge = %+v, want captured %d, refunded %d, voided %v", *charge, test.captured, test.refunded, test.voided)
+			}
+		})
+	}
+}
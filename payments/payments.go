@@ -0,0 +1,104 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-com/models"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("Payment method is not supported")
+	ErrPaymentDeclined  = errors.New("Payment was declined")
+	ErrInvalidOperation = errors.New("Payment can't do this in its current state")
+	ErrAmountTooLarge   = errors.New("Amount is more than the payment allows")
+)
+
+// PaymentProvider is a way of taking money. Authorize reserves the amount and
+// returns the provider's reference for it, which the other calls work on. They
+// also take an idempotency key: a call with a key that already went through
+// succeeds again without moving any money.
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, amount models.Money, source string) (string, error)
+	Capture(ctx context.Context, reference string, amount models.Money, key string) error
+	Refund(ctx context.Context, reference string, amount models.Money, key string) error
+	Void(ctx context.Context, reference string, key string) error
+}
+
+// Registry looks providers up by the name customers pick at checkout
+type Registry struct {
+	providers map[string]PaymentProvider
+}
+
+func NewRegistry(providers ...PaymentProvider) *Registry {
+	registry := &Registry{providers: make(map[string]PaymentProvider)}
+	for _, provider := range providers {
+		registry.providers[provider.Name()] = provider
+	}
+
+	return registry
+}
+
+func (registry *Registry) Get(name string) (PaymentProvider, error) {
+	provider, ok := registry.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+
+	return provider, nil
+}
+
+func record(payment *models.Payment, action string, amount models.Money, at time.Time) {
+	payment.Events = append(payment.Events, models.PaymentEvent{Action: action, Amount: amount, Key: nextKey(*payment), At: at})
+}
+
+// nextKey is the idempotency key of the next thing done to the payment
+func nextKey(payment models.Payment) string {
+	return payment.Reference + ":" + strconv.Itoa(len(payment.Events))
+}
+
+// Authorize reserves the amount with the provider and returns the payment record for the order
+func Authorize(ctx context.Context, provider PaymentProvider, amount models.Money, source string, at time.Time) (models.Payment, error) {
+	reference, err := provider.Authorize(ctx, amount, source)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	payment := models.Payment{
+		Provider:  provider.Name(),
+		Reference: reference,
+		Status:    models.PaymentAuthorized,
+		Amount:    amount,
+		Captured:  models.Money{Currency: amount.Currency},
+		Refunded:  models.Money{Currency: amount.Currency},
+	}
+	payment.COD = provider.Name() == CashOnDeliveryName
+	payment.Digital = !payment.COD
+	record(&payment, "authorize", amount, at)
+
+	return payment, nil
+}
+
+// Void releases an authorization that was never captured
+func Void(ctx context.Context, provider PaymentProvider, payment *models.Payment, at time.Time) error {
+	if payment.Status != models.PaymentAuthorized {
+		return ErrInvalidOperation
+	}
+
+	if err := provider.Void(ctx, payment.Reference, nextKey(*payment)); err != nil {
+		return err
+	}
+
+	payment.Status = models.PaymentVoided
+	record(payment, "void", payment.Amount, at)
+	return nil
+}
+
+// Refundable is how much of the captured amount hasn't been given back yet
+func Refundable(payment models.Payment) (models.Money, error) {
+	return payment.Captured.Sub(payment.Refunded)
+}
@@ -0,0 +1,161 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-com/models"
+	"go-com/orders"
+)
+
+const (
+	ActionCapture = "capture"
+	ActionVoid    = "void"
+	ActionRefund  = "refund"
+)
+
+// Due works out the next thing the order's payment has to do at its provider
+// to match the order. Digital payments are captured once the order is placed
+// and cash on delivery once the order is paid. A payment that was never
+// captured is voided when the order is cancelled or refunded. Otherwise what
+// the order's refunds add up to is given back, or everything captured once the
+// order is cancelled. Orders from before payments were recorded owe nothing.
+func Due(order models.Order, at time.Time) (models.PaymentOperation, bool, error) {
+	payment := order.Payment_method
+	if payment.Provider == "" {
+		return models.PaymentOperation{}, false, nil
+	}
+
+	op := models.PaymentOperation{Key: nextKey(payment), At: at}
+	switch payment.Status {
+	case models.PaymentAuthorized:
+		switch order.Status {
+		case models.OrderPending:
+			if payment.COD {
+				return op, false, nil
+			}
+			op.Action = ActionCapture
+		case models.OrderPaid, models.OrderFulfilled, models.OrderDelivered:
+			op.Action = ActionCapture
+		case models.OrderCancelled, models.OrderRefunded:
+			op.Action = ActionVoid
+		default:
+			return op, false, nil
+		}
+		op.Amount = payment.Amount
+		return op, true, nil
+
+	case models.PaymentCaptured, models.PaymentPartiallyRefunded:
+		owed := payment.Captured
+		if order.Status != models.OrderCancelled {
+			refunded, err := orders.Refunded(order)
+			if err != nil {
+				return op, false, err
+			}
+			owed = refunded
+		}
+
+		missing, err := owed.Sub(payment.Refunded)
+		if err != nil {
+			return op, false, err
+		}
+		refundable, err := Refundable(payment)
+		if err != nil {
+			return op, false, err
+		}
+		if cmp, err := missing.Cmp(refundable); err != nil {
+			return op, false, err
+		} else if cmp > 0 {
+			missing = refundable
+		}
+		if missing.IsZero() || missing.IsNegative() {
+			return op, false, nil
+		}
+
+		op.Action, op.Amount = ActionRefund, missing
+		return op, true, nil
+	}
+
+	return op, false, nil
+}
+
+// Plan writes what Due finds to the order as its pending operation, unless one
+// is pending already, and reports whether the order has one now
+func Plan(order *models.Order, at time.Time) (bool, error) {
+	if order.Payment_method.Pending != nil {
+		return true, nil
+	}
+
+	op, ok, err := Due(*order, at)
+	if err != nil || !ok {
+		return false, err
+	}
+	order.Payment_method.Pending = &op
+	order.Updated_at = at
+
+	return true, nil
+}
+
+// Execute has the provider carry out the operation, with its key
+func Execute(ctx context.Context, provider PaymentProvider, payment models.Payment, op models.PaymentOperation) error {
+	switch op.Action {
+	case ActionCapture:
+		return provider.Capture(ctx, payment.Reference, op.Amount, op.Key)
+	case ActionVoid:
+		return provider.Void(ctx, payment.Reference, op.Key)
+	case ActionRefund:
+		return provider.Refund(ctx, payment.Reference, op.Amount, op.Key)
+	}
+
+	return ErrInvalidOperation
+}
+
+// Refused reports whether the provider turned the operation down, as opposed
+// to failing in a way that leaves open whether the money moved
+func Refused(err error) bool {
+	return errors.Is(err, ErrPaymentDeclined) || errors.Is(err, ErrInvalidOperation) || errors.Is(err, ErrAmountTooLarge)
+}
+
+// Record writes the outcome of the order's pending operation to its payment,
+// failed is what Execute returned. A capture that went through marks a pending
+// order as paid, one that was refused is recorded as failed and leaves the
+// order as it was.
+func Record(order *models.Order, failed error, at time.Time) error {
+	payment := &order.Payment_method
+	op := payment.Pending
+	if op == nil {
+		return ErrInvalidOperation
+	}
+	payment.Pending = nil
+	order.Updated_at = at
+
+	if failed != nil {
+		payment.Events = append(payment.Events, models.PaymentEvent{Action: op.Action + "_failed", Amount: op.Amount, Key: op.Key, At: at})
+		return nil
+	}
+
+	switch op.Action {
+	case ActionCapture:
+		payment.Status = models.PaymentCaptured
+		payment.Captured = op.Amount
+	case ActionVoid:
+		payment.Status = models.PaymentVoided
+	case ActionRefund:
+		refunded, err := payment.Refunded.Add(op.Amount)
+		if err != nil {
+			return err
+		}
+		payment.Refunded = refunded
+		payment.Status = models.PaymentPartiallyRefunded
+		if refunded == payment.Captured {
+			payment.Status = models.PaymentRefunded
+		}
+	}
+	payment.Events = append(payment.Events, models.PaymentEvent{Action: op.Action, Amount: op.Amount, Key: op.Key, At: at})
+
+	if op.Action == ActionCapture && order.Status == models.OrderPending {
+		return orders.Transition(order, models.OrderPaid, at)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-com/models"
+	"go-com/orders"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cardOrder is a pending order for four mugs at 10.00 paid by card
+func cardOrder(t *testing.T, card PaymentProvider) models.Order {
+	t.Helper()
+	payment, err := Authorize(context.Background(), card, usd(4000), "tok_visa", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := models.Order{
+		Order_id:       primitive.NewObjectID(),
+		Order_cart:     []models.ProductUser{{Product_id: primitive.NewObjectID(), Price: usd(1000), Quantity: 4}},
+		Price:          usd(4000),
+		Payment_method: payment,
+	}
+	orders.New(&order, at)
+	return order
+}
+
+// settle does what the checkout does after placing an order: it plans, executes
+// and records operations until none is due, leaving one whose outcome isn't
+// known pending
+func settle(t *testing.T, provider PaymentProvider, order *models.Order) error {
+	t.Helper()
+	for {
+		planned, err := Plan(order, at)
+		if err != nil || !planned {
+			return err
+		}
+
+		op := *order.Payment_method.Pending
+		failed := Execute(context.Background(), provider, order.Payment_method, op)
+		if failed != nil && !Refused(failed) {
+			return failed
+		}
+		if err = Record(order, failed, at); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		if failed != nil {
+			return failed
+		}
+	}
+}
+
+func refunded(amount int64) models.OrderEvent {
+	refund := usd(amount)
+	return models.OrderEvent{Action: "refund", By: "admin", Amount: &refund, At: at}
+}
+
+func TestDue(t *testing.T) {
+	captured := func(order *models.Order) {
+		order.Status = models.OrderPaid
+		order.Payment_method.Status = models.PaymentCaptured
+		order.Payment_method.Captured = usd(4000)
+	}
+
+	tests := []struct {
+		name   string
+		change func(order *models.Order)
+		action string
+		amount int64
+	}{
+		{"placed by card", func(order *models.Order) {}, ActionCapture, 4000},
+		{"placed cash on delivery", func(order *models.Order) {
+			order.Payment_method.Provider, order.Payment_method.COD = CashOnDeliveryName, true
+		}, "", 0},
+		{"paid cash on delivery", func(order *models.Order) {
+			order.Payment_method.Provider, order.Payment_method.COD = CashOnDeliveryName, true
+			order.Status = models.OrderPaid
+		}, ActionCapture, 4000},
+		{"cancelled before capture", func(order *models.Order) {
+			order.Status = models.OrderCancelled
+		}, ActionVoid, 4000},
+		{"captured", captured, "", 0},
+		{"refunded in part", func(order *models.Order) {
+			captured(order)
+			order.History = append(order.History, refunded(1000))
+		}, ActionRefund, 1000},
+		{"refund given back already", func(order *models.Order) {
+			captured(order)
+			order.History = append(order.History, refunded(1000))
+			order.Payment_method.Status, order.Payment_method.Refunded = models.PaymentPartiallyRefunded, usd(1000)
+		}, "", 0},
+		{"cancelled after capture", func(order *models.Order) {
+			captured(order)
+			order.Status = models.OrderCancelled
+			order.Payment_method.Status, order.Payment_method.Refunded = models.PaymentPartiallyRefunded, usd(1000)
+		}, ActionRefund, 3000},
+		{"refunds over the captured amount", func(order *models.Order) {
+			captured(order)
+			order.History = append(order.History, refunded(3000), refunded(2000))
+		}, ActionRefund, 4000},
+		{"refunds over what is left to refund", func(order *models.Order) {
+			captured(order)
+			order.History = append(order.History, refunded(5000))
+			order.Payment_method.Status, order.Payment_method.Refunded = models.PaymentPartiallyRefunded, usd(2500)
+		}, ActionRefund, 1500},
+		{"from before payments were recorded", func(order *models.Order) {
+			order.Payment_method = models.Payment{}
+		}, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := cardOrder(t, NewFakeCard())
+			test.change(&order)
+
+			op, ok, err := Due(order, at)
+			if err != nil {
+				t.Fatalf("Due() error = %v", err)
+			}
+			if ok != (test.action != "") || op.Action != test.action {
+				t.Fatalf("Due() = %+v, %v, want %q", op, ok, test.action)
+			}
+			if ok && (op.Amount != usd(test.amount) || op.Key != nextKey(order.Payment_method)) {
+				t.Errorf("Due() = %+v, want %d USD with key %s", op, test.amount, nextKey(order.Payment_method))
+			}
+		})
+	}
+}
+
+func TestSettleCapturesAndRefunds(t *testing.T) {
+	card := NewFakeCard()
+	order := cardOrder(t, card)
+
+	if err := settle(t, card, &order); err != nil {
+		t.Fatalf("settle() error = %v", err)
+	}
+	payment := order.Payment_method
+	if order.Status != models.OrderPaid || payment.Status != models.PaymentCaptured || payment.Captured != usd(4000) || payment.Pending != nil {
+		t.Fatalf("settled order is %s with payment %+v, want paid and captured", order.Status, payment)
+	}
+
+	// More refunds on the order than was ever captured give back what was captured
+	order.History = append(order.History, refunded(3000), refunded(2000))
+	if err := settle(t, card, &order); err != nil {
+		t.Fatalf("settle() error = %v", err)
+	}
+	payment = order.Payment_method
+	if payment.Status != models.PaymentRefunded || payment.Refunded != usd(4000) {
+		t.Errorf("payment = %+v, want all 40.00 refunded", payment)
+	}
+	if charge := card.charges[payment.Reference]; charge.refunded != usd(4000) {
+		t.Errorf("card refunded %v, want 40.00 USD", charge.refunded)
+	}
+	if refundable, _ := Refundable(payment); !refundable.IsZero() {
+		t.Errorf("Refundable() = %v after refunding everything, want nothing", refundable)
+	}
+}
+
+func TestReplayedKeyReturnsTheFirstResult(t *testing.T) {
+	card := NewFakeCard()
+	order := cardOrder(t, card)
+	if err := settle(t, card, &order); err != nil {
+		t.Fatal(err)
+	}
+	order.History = append(order.History, refunded(1500))
+	if err := settle(t, card, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, event := range order.Payment_method.Events[1:] {
+		op := models.PaymentOperation{Action: event.Action, Amount: event.Amount, Key: event.Key}
+		if err := Execute(ctx, card, order.Payment_method, op); err != nil {
+			t.Errorf("replayed %s with %s error = %v, want the first result", event.Action, event.Key, err)
+		}
+	}
+
+	charge := card.charges[order.Payment_method.Reference]
+	if charge.captured != usd(4000) || charge.refunded != usd(1500) {
+		t.Errorf("card captured %v and refunded %v after the replays, want 40.00 and 15.00", charge.captured, charge.refunded)
+	}
+}
+
+func TestDeclinedCapture(t *testing.T) {
+	card := NewFakeCard()
+	order := cardOrder(t, card)
+	if err := card.Void(context.Background(), order.Payment_method.Reference, "elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := settle(t, card, &order); !errors.Is(err, ErrInvalidOperation) {
+		t.Fatalf("settle() error = %v, want %v", err, ErrInvalidOperation)
+	}
+	payment := order.Payment_method
+	last := payment.Events[len(payment.Events)-1]
+	if order.Status != models.OrderPending || payment.Status != models.PaymentAuthorized || payment.Pending != nil || last.Action != "capture_failed" {
+		t.Errorf("order is %s with payment %+v, want it pending with the capture recorded as failed", order.Status, payment)
+	}
+}
+
+var errTimeout = errors.New("gateway timeout")
+
+// flakyCard loses the outcome of the first captures, either before the call
+// reaches the card or on the way back
+type flakyCard struct {
+	*FakeCard
+	lost    int
+	reached bool
+}
+
+func (card *flakyCard) Capture(ctx context.Context, reference string, amount models.Money, key string) error {
+	if card.lost == 0 {
+		return card.FakeCard.Capture(ctx, reference, amount, key)
+	}
+	card.lost--
+	if card.reached {
+		card.FakeCard.Capture(ctx, reference, amount, key)
+	}
+	return errTimeout
+}
+
+func TestUnknownOutcomeStaysPending(t *testing.T) {
+	tests := []struct {
+		name    string
+		reached bool
+	}{
+		{"call never reached the card", false},
+		{"reply got lost", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := &flakyCard{FakeCard: NewFakeCard(), lost: 1, reached: test.reached}
+			order := cardOrder(t, card)
+
+			if err := settle(t, card, &order); !errors.Is(err, errTimeout) || Refused(err) {
+				t.Fatalf("settle() error = %v, want %v", err, errTimeout)
+			}
+			pending := order.Payment_method.Pending
+			if pending == nil || pending.Action != ActionCapture || order.Status != models.OrderPending || len(order.Payment_method.Events) != 1 {
+				t.Fatalf("order is %s with payment %+v, want the capture still pending", order.Status, order.Payment_method)
+			}
+			key := pending.Key
+
+			// A later sweep runs the same operation again
+			if err := settle(t, card, &order); err != nil {
+				t.Fatalf("later settle() error = %v", err)
+			}
+			payment := order.Payment_method
+			last := payment.Events[len(payment.Events)-1]
+			if order.Status != models.OrderPaid || payment.Status != models.PaymentCaptured || payment.Pending != nil || last.Key != key {
+				t.Errorf("order is %s with payment %+v, want it paid by the capture with key %s", order.Status, payment, key)
+			}
+			if charge := card.charges[payment.Reference]; charge.captured != usd(4000) {
+				t.Errorf("card captured %v, want 40.00 USD once", charge.captured)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package pricing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go-com/coupons"
+	"go-com/models"
+	"go-com/taxes"
+)
+
+// ShippingRule works out what shipping costs for goods worth the given amount,
+// after discounts. The address is nil while it isn't known yet.
+type ShippingRule interface {
+	Shipping(goods models.Money, address *models.Address) (models.Money, error)
+}
+
+// FreeShipping never charges for shipping
+type FreeShipping struct{}
+
+func (FreeShipping) Shipping(goods models.Money, address *models.Address) (models.Money, error) {
+	return models.Money{Currency: goods.Currency}, nil
+}
+
+// FlatRate charges Amount for shipping an order, or nothing once its goods come
+// to Free_over when that is set. Both are in the minor units of the cart's currency.
+type FlatRate struct {
+	Amount    int64
+	Free_over int64
+}
+
+func (rate FlatRate) Shipping(goods models.Money, address *models.Address) (models.Money, error) {
+	if rate.Free_over > 0 && goods.Amount >= rate.Free_over {
+		return models.Money{Currency: goods.Currency}, nil
+	}
+
+	return models.Money{Amount: rate.Amount, Currency: goods.Currency}, nil
+}
+
+// Engine prices carts. The cart view and the checkout both go through it, so
+// the total a customer is shown is the total they are charged. Taxes picks the
+// tax calculator by the country the cart ships to.
+type Engine struct {
+	Shipping ShippingRule
+	Taxes    *taxes.Registry
+}
+
+// Default ships for free and charges no tax
+func Default() *Engine {
+	return &Engine{Shipping: FreeShipping{}, Taxes: taxes.Default()}
+}
+
+// FromEnv sets up the engine from the environment. SHIPPING_FLAT_RATE is what
+// shipping an order costs and SHIPPING_FREE_OVER the value of goods from which
+// shipping is free, both in minor units. Shipping is free when neither is set.
+// Tax is charged following taxes.FromEnv.
+func FromEnv() (*Engine, error) {
+	engine := Default()
+
+	registry, err := taxes.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	engine.Taxes = registry
+
+	var rate FlatRate
+	for _, setting := range []struct {
+		name  string
+		value *int64
+	}{
+		{"SHIPPING_FLAT_RATE", &rate.Amount},
+		{"SHIPPING_FREE_OVER", &rate.Free_over},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		amount, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("%s must be an amount in minor units, got %q", setting.name, raw)
+		}
+		*setting.value = amount
+	}
+	if rate.Amount > 0 {
+		engine.Shipping = rate
+	}
+
+	return engine, nil
+}
+
+// Subtotal adds up price times quantity over the lines. Mixed currencies and
+// totals that don't fit in the amount are errors instead of wrong numbers.
+func Subtotal(lines []models.ProductUser) (models.Money, error) {
+	var subtotal models.Money
+	for _, item := range lines {
+		line, err := item.Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return models.Money{}, err
+		}
+		if subtotal, err = subtotal.Add(line); err != nil {
+			return models.Money{}, err
+		}
+	}
+
+	return subtotal, nil
+}
+
+// Quote prices the lines for the user: the subtotal, what the coupon takes off
+// it when there is one, shipping and tax on what is left, and the total of it
+// all. Tax included in the prices is shown but not added to the total. A coupon
+// that doesn't apply fails the quote with the coupons error.
+func (engine *Engine) Quote(lines []models.ProductUser, coupon *models.Coupon, userID string, address *models.Address, at time.Time) (models.Quote, error) {
+	quote := models.Quote{Lines: make([]models.QuoteLine, 0, len(lines))}
+	for _, item := range lines {
+		total, err := item.Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return models.Quote{}, err
+		}
+		if quote.Subtotal, err = quote.Subtotal.Add(total); err != nil {
+			return models.Quote{}, err
+		}
+		quote.Lines = append(quote.Lines, models.QuoteLine{ProductUser: item, Line_total: total})
+		quote.Item_count += item.Quantity
+	}
+
+	zero := models.Money{Currency: quote.Subtotal.Currency}
+	quote.Discount, quote.Shipping_fee, quote.Tax = zero, zero, zero
+
+	if coupon != nil {
+		discount, err := coupons.Discount(*coupon, quote.Subtotal, userID, at)
+		if err != nil {
+			return models.Quote{}, err
+		}
+		code := coupon.Code
+		quote.Discount, quote.Coupon_code = discount, &code
+	}
+
+	goods, err := quote.Subtotal.Sub(quote.Discount)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	// An empty cart doesn't ship
+	if len(lines) > 0 {
+		if quote.Shipping_fee, err = engine.Shipping.Shipping(goods, address); err != nil {
+			return models.Quote{}, err
+		}
+	}
+	if err = engine.tax(&quote, address); err != nil {
+		return models.Quote{}, err
+	}
+
+	quote.Total = goods
+	charges := []models.Money{quote.Shipping_fee}
+	if !quote.Tax_included {
+		charges = append(charges, quote.Tax)
+	}
+	for _, charge := range charges {
+		if quote.Total, err = quote.Total.Add(charge); err != nil {
+			return models.Quote{}, err
+		}
+	}
+
+	return quote, nil
+}
+
+// tax has the calculator for the address work out the tax on every line of the
+// quote, on what the line is worth once its share of the discount is taken off
+func (engine *Engine) tax(quote *models.Quote, address *models.Address) error {
+	discounts, err := allocate(quote.Discount, quote.Lines)
+	if err != nil {
+		return err
+	}
+
+	items := make([]taxes.Item, len(quote.Lines))
+	for i, line := range quote.Lines {
+		amount, err := line.Line_total.Sub(discounts[i])
+		if err != nil {
+			return err
+		}
+		items[i] = taxes.Item{Class: line.Tax_class, Amount: amount}
+	}
+
+	var destination models.Address
+	if address != nil {
+		destination = *address
+	}
+	assessment, err := engine.Taxes.For(address).Calculate(items, destination)
+	if err != nil {
+		return err
+	}
+
+	quote.Tax_included = assessment.Included
+	quote.Tax_lines = assessment.Tax_lines
+	if quote.Tax_lines == nil {
+		quote.Tax_lines = make([]models.TaxLine, 0)
+	}
+	for i, tax := range assessment.Lines {
+		if quote.Tax, err = quote.Tax.Add(tax); err != nil {
+			return err
+		}
+		if !tax.IsZero() {
+			lineTax := tax
+			quote.Lines[i].Tax = &lineTax
+		}
+	}
+
+	return nil
+}
+
+// allocate splits the discount over the lines by what each of them is worth.
+// The last line takes whatever rounding left over, so the parts add up to the
+// discount exactly.
+func allocate(discount models.Money, lines []models.QuoteLine) ([]models.Money, error) {
+	shares := make([]models.Money, len(lines))
+	subtotal := models.Money{Currency: discount.Currency}
+	for i, line := range lines {
+		shares[i] = models.Money{Currency: line.Line_total.Currency}
+		var err error
+		if subtotal, err = subtotal.Add(line.Line_total); err != nil {
+			return nil, err
+		}
+	}
+	if discount.IsZero() || subtotal.IsZero() {
+		return shares, nil
+	}
+
+	left := discount
+	for i, line := range lines[:len(lines)-1] {
+		share, err := line.Line_total.MulRatio(discount.Amount, subtotal.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = left.Sub(share); err != nil {
+			return nil, err
+		}
+		shares[i] = share
+	}
+	shares[len(lines)-1] = left
+
+	return shares, nil
+}
@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/coupons"
+	"go-com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+func line(price int64, quantity int) models.ProductUser {
+	return models.ProductUser{Product_id: primitive.NewObjectID(), Price: usd(price), Quantity: quantity}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		discount int64
+		totals   []int64
+		want     []int64
+	}{
+		{"no discount", 0, []int64{1000, 2000}, []int64{0, 0}},
+		{"even split", 300, []int64{1000, 2000}, []int64{100, 200}},
+		{"last line takes the rounding", 1000, []int64{1000, 1000, 1000}, []int64{333, 333, 334}},
+		{"rounding up on the way", 200, []int64{1000, 1000, 1000}, []int64{67, 67, 66}},
+		{"lines worth nothing", 500, []int64{0, 0}, []int64{0, 0}},
+		{"single line", 1250, []int64{5000}, []int64{1250}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := make([]models.QuoteLine, len(test.totals))
+			for i, total := range test.totals {
+				lines[i].Line_total = usd(total)
+			}
+
+			shares, err := allocate(usd(test.discount), lines)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(shares) != len(test.want) {
+				t.Fatalf("allocate() = %v, want %v", shares, test.want)
+			}
+			for i, want := range test.want {
+				if shares[i] != usd(want) {
+					t.Errorf("share %d = %v, want %v", i, shares[i], usd(want))
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteEmptyCart(t *testing.T) {
+	engine := &Engine{Shipping: FlatRate{Amount: 499}, Taxes: Default().Taxes}
+
+	quote, err := engine.Quote(nil, nil, "user", nil, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Total.IsZero() || !quote.Shipping_fee.IsZero() || quote.Item_count != 0 {
+		t.Errorf("Quote() of an empty cart = %+v, want nothing to pay", quote)
+	}
+	if quote.Lines == nil || quote.Tax_lines == nil {
+		t.Errorf("Quote() of an empty cart has nil lines, which encode as null")
+	}
+}
+
+func TestQuoteShipping(t *testing.T) {
+	engine := &Engine{Shipping: FlatRate{Amount: 499, Free_over: 5000}, Taxes: Default().Taxes}
+	tenOff := &models.Coupon{Code: "TENOFF", Type: models.CouponFixed, Amount: usd(1000), Active: true}
+
+	tests := []struct {
+		name     string
+		lines    []models.ProductUser
+		coupon   *models.Coupon
+		shipping int64
+		total    int64
+	}{
+		{"below the threshold", []models.ProductUser{line(4999, 1)}, nil, 499, 5498},
+		{"at the threshold", []models.ProductUser{line(2500, 2)}, nil, 0, 5000},
+		{"over the threshold", []models.ProductUser{line(3000, 1), line(2500, 1)}, nil, 0, 5500},
+		{"discount takes it below the threshold", []models.ProductUser{line(5500, 1)}, tenOff, 499, 4999},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quote, err := engine.Quote(test.lines, test.coupon, "user", nil, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.Shipping_fee != usd(test.shipping) {
+				t.Errorf("Shipping_fee = %v, want %v", quote.Shipping_fee, usd(test.shipping))
+			}
+			if quote.Total != usd(test.total) {
+				t.Errorf("Total = %v, want %v", quote.Total, usd(test.total))
+			}
+		})
+	}
+}
+
+func TestQuoteCoupon(t *testing.T) {
+	engine := Default()
+	lines := []models.ProductUser{line(1000, 2), line(2500, 1)}
+
+	quote, err := engine.Quote(lines, &models.Coupon{Code: "SAVE10", Type: models.CouponPercentage, Percent: 10, Active: true}, "user", nil, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Subtotal != usd(4500) || quote.Discount != usd(450) || quote.Total != usd(4050) || quote.Item_count != 3 {
+		t.Errorf("Quote() = %+v, want 45.00 less 4.50 for 3 items", quote)
+	}
+	if quote.Coupon_code == nil || *quote.Coupon_code != "SAVE10" {
+		t.Errorf("Coupon_code = %v, want SAVE10", quote.Coupon_code)
+	}
+	if quote.Lines[0].Line_total != usd(2000) || quote.Lines[1].Line_total != usd(2500) {
+		t.Errorf("line totals = %v, %v, want 20.00 and 25.00", quote.Lines[0].Line_total, quote.Lines[1].Line_total)
+	}
+
+	expired := at.Add(-time.Hour)
+	_, err = engine.Quote(lines, &models.Coupon{Code: "OLD", Type: models.CouponFixed, Amount: usd(500), Active: true, Expires_at: &expired}, "user", nil, at)
+	if !errors.Is(err, coupons.ErrCouponExpired) {
+		t.Errorf("Quote() with an expired coupon error = %v, want %v", err, coupons.ErrCouponExpired)
+	}
+}
+
+func TestSubtotal(t *testing.T) {
+	subtotal, err := Subtotal([]models.ProductUser{line(1250, 2), line(99, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subtotal != usd(2797) {
+		t.Errorf("Subtotal() = %v, want 27.97 USD", subtotal)
+	}
+
+	mixed := line(100, 1)
+	mixed.Price = models.NewMoney(100, "EUR")
+	if _, err = Subtotal([]models.ProductUser{line(100, 1), mixed}); !errors.Is(err, models.ErrCurrencyMismatch) {
+		t.Errorf("Subtotal() of mixed currencies error = %v, want %v", err, models.ErrCurrencyMismatch)
+	}
+}
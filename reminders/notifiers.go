@@ -0,0 +1,52 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogNotifier writes reminders to the service log instead of sending them
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	log.Printf("cart reminder: user %s (%s) left %d items in their cart since %s",
+		reminder.User_id, reminder.Email, len(reminder.Cart), reminder.Idle_since.Format(time.RFC3339))
+	return nil
+}
+
+// FileNotifier appends reminders to a file, one JSON object per line, for
+// another process to send or for checking what would have been sent
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (notifier *FileNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	line, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	file, err := os.OpenFile(notifier.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("cart reminders: %w", err)
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("cart reminders: %w", err)
+	}
+
+	return file.Close()
+}
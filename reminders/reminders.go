@@ -0,0 +1,149 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-com/carts"
+	"go-com/database"
+	"go-com/models"
+)
+
+const (
+	DefaultIdleAfter = 24 * time.Hour
+	DefaultInterval  = 15 * time.Minute
+	DefaultBatch     = 100
+)
+
+// Reminder is the event sent for a cart left alone for too long
+type Reminder struct {
+	User_id    string               `json:"user_id"`
+	Email      string               `json:"email"`
+	First_name string               `json:"first_name"`
+	Cart       []models.ProductUser `json:"usercart"`
+	Idle_since time.Time            `json:"idle_since"`
+	At         time.Time            `json:"at"`
+}
+
+// Notifier delivers reminders, e.g. by email. A reminder that fails to go out
+// is tried again on the next sweep.
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// Worker looks for abandoned carts every Interval. A cart is abandoned once it
+// holds something and hasn't changed for IdleAfter, and its user is reminded
+// of it once until it changes again. Each sweep also purges expired guest carts.
+type Worker struct {
+	Carts     database.AbandonedCartStore
+	Notifier  Notifier
+	IdleAfter time.Duration
+	Interval  time.Duration
+	// Batch is how many carts one sweep reminds of at most
+	Batch int
+}
+
+func NewWorker(store database.AbandonedCartStore, notifier Notifier) *Worker {
+	return &Worker{
+		Carts:     store,
+		Notifier:  notifier,
+		IdleAfter: DefaultIdleAfter,
+		Interval:  DefaultInterval,
+		Batch:     DefaultBatch,
+	}
+}
+
+// FromEnv sets up a worker from the environment. CART_REMINDER_AFTER is how long
+// a cart has to be idle and CART_REMINDER_INTERVAL how often to look, both Go
+// durations such as "24h". Reminders go to the file CART_REMINDER_FILE names,
+// or to the log when it isn't set.
+func FromEnv(store database.AbandonedCartStore) (*Worker, error) {
+	var notifier Notifier = LogNotifier{}
+	if path := os.Getenv("CART_REMINDER_FILE"); path != "" {
+		notifier = NewFileNotifier(path)
+	}
+
+	worker := NewWorker(store, notifier)
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"CART_REMINDER_AFTER", &worker.IdleAfter},
+		{"CART_REMINDER_INTERVAL", &worker.Interval},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(raw)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%s must be a positive duration, got %q", setting.name, raw)
+		}
+		*setting.value = duration
+	}
+
+	return worker, nil
+}
+
+// Run sweeps straight away and then every Interval until the context is done
+func (worker *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+
+	for {
+		worker.Sweep(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep reminds the users of the carts that are abandoned at now and purges the
+// guest carts that expired by then. It returns how many reminders went out.
+func (worker *Worker) Sweep(ctx context.Context, now time.Time) int {
+	users, err := worker.Carts.AbandonedCarts(ctx, now.Add(-worker.IdleAfter), worker.Batch)
+	if err != nil {
+		log.Println(err)
+		users = nil
+	}
+
+	sent := 0
+	for _, user := range users {
+		if err = worker.Notifier.Notify(ctx, reminderFor(user, now)); err != nil {
+			log.Println(err)
+			continue
+		}
+		if err = worker.Carts.MarkCartReminded(ctx, user.User_id, now); err != nil {
+			log.Println(err)
+			continue
+		}
+		sent++
+	}
+
+	if _, err = worker.Carts.PurgeGuestCarts(ctx, now.Add(-carts.GuestLifetime)); err != nil {
+		log.Println(err)
+	}
+
+	return sent
+}
+
+func reminderFor(user models.User, now time.Time) Reminder {
+	reminder := Reminder{User_id: user.User_id, Cart: user.UserCart, At: now}
+	if user.Email != nil {
+		reminder.Email = *user.Email
+	}
+	if user.First_name != nil {
+		reminder.First_name = *user.First_name
+	}
+	if user.Cart_updated_at != nil {
+		reminder.Idle_since = *user.Cart_updated_at
+	}
+
+	return reminder
+}
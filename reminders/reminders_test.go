@@ -0,0 +1,128 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-com/carts"
+	"go-com/database"
+	"go-com/models"
+	"go-com/pricing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recorder keeps the reminders instead of sending them
+type recorder struct {
+	reminders []Reminder
+}
+
+func (r *recorder) Notify(ctx context.Context, reminder Reminder) error {
+	r.reminders = append(r.reminders, reminder)
+	return nil
+}
+
+func newStore(t *testing.T) (*database.MemoryStore, models.ProductUser) {
+	t.Helper()
+
+	store := database.NewMemoryStore(pricing.Default())
+	name := "Mug"
+	mug := models.Product{Product_id: primitive.NewObjectID(), Product_name: &name, Price: models.NewMoney(1250, "USD"), Stock: 10}
+	if err := store.InsertProduct(context.Background(), mug); err != nil {
+		t.Fatal(err)
+	}
+
+	return store, models.ProductUser{Product_id: mug.Product_id, Product_name: &name, Price: mug.Price, Quantity: 1}
+}
+
+func TestSweepReminds(t *testing.T) {
+	ctx := context.Background()
+	store, line := newStore(t)
+
+	// The store stamps cart changes with the clock, so the sweeps run at fixed
+	// times before and after it. The clock is at base+30h.
+	base := time.Now().Add(-30 * time.Hour)
+	name, email := "Ann", "ann@example.com"
+	idle, recent := base.Add(-48*time.Hour), base.Add(-time.Hour)
+	users := []models.User{
+		{ID: primitive.NewObjectID(), Email: &email, First_name: &name, UserCart: []models.ProductUser{line}, Cart_updated_at: &idle},
+		{ID: primitive.NewObjectID(), UserCart: []models.ProductUser{line}, Cart_updated_at: &recent},
+		{ID: primitive.NewObjectID(), UserCart: []models.ProductUser{}, Cart_updated_at: &idle},
+	}
+	for i := range users {
+		users[i].User_id = users[i].ID.Hex()
+		if err := store.InsertUser(ctx, users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifier := &recorder{}
+	worker := NewWorker(store, notifier)
+
+	// sweep runs a sweep at base+after and checks it reminded the users, in order
+	sweep := func(after time.Duration, want ...models.User) {
+		t.Helper()
+		before := len(notifier.reminders)
+		sent := worker.Sweep(ctx, base.Add(after))
+		got := notifier.reminders[before:]
+		if sent != len(want) || len(got) != len(want) {
+			t.Fatalf("Sweep(+%v) sent %d reminders, notifier got %d, want %d", after, sent, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].User_id != want[i].User_id {
+				t.Errorf("Sweep(+%v) reminder %d went to %s, want %s", after, i, got[i].User_id, want[i].User_id)
+			}
+		}
+	}
+
+	// Only the cart idle for a day gets a reminder, the empty one never does
+	sweep(3*time.Hour, users[0])
+	got := notifier.reminders[0]
+	if got.Email != email || got.First_name != name || len(got.Cart) != 1 || !got.Idle_since.Equal(idle) || !got.At.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("reminder = %+v, want the idle cart of %s", got, email)
+	}
+
+	// No second reminder for the same cart
+	sweep(4 * time.Hour)
+
+	// Changing the cart, now at base+30h, makes it a new cart to remind of once
+	// it is idle again
+	if err := store.AddProductToCart(ctx, line.Product_id, "", users[0].User_id, 1); err != nil {
+		t.Fatal(err)
+	}
+	sweep(31*time.Hour, users[1])
+	sweep(55*time.Hour, users[0])
+	sweep(56 * time.Hour)
+}
+
+func TestSweepPurgesExpiredGuestCarts(t *testing.T) {
+	ctx := context.Background()
+	store, line := newStore(t)
+
+	now := time.Now()
+	guests := []models.GuestCart{
+		{Token: "kept", UserCart: []models.ProductUser{line}, Updated_at: now},
+		{Token: "expired", UserCart: []models.ProductUser{line}, Updated_at: now.Add(-carts.GuestLifetime + time.Hour)},
+	}
+	for _, guest := range guests {
+		if err := store.InsertGuestCart(ctx, guest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Still there before the sweep that sees it expired
+	NewWorker(store, &recorder{}).Sweep(ctx, now)
+	if _, err := store.GuestCarts().GetCart(ctx, "expired"); err != nil {
+		t.Fatalf("guest cart that didn't expire yet: error = %v", err)
+	}
+
+	NewWorker(store, &recorder{}).Sweep(ctx, now.Add(2*time.Hour))
+	if _, err := store.GuestCarts().GetCart(ctx, "expired"); !errors.Is(err, database.ErrGuestCartNotFound) {
+		t.Errorf("expired guest cart: error = %v, want %v", err, database.ErrGuestCartNotFound)
+	}
+	if _, err := store.GuestCarts().GetCart(ctx, "kept"); err != nil {
+		t.Errorf("guest cart that didn't expire: error = %v", err)
+	}
+}
@@ -2,14 +2,28 @@ package routes
 
 import(
 	"go-com/controllers"
+	"go-com/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.POST("/users/signup", controllers.SignUp())
-	incomingRoutes.POST("/users/login", controllers.Login())
-	incomingRoutes.POST("/admin/addproduct", controllers.ProductViewerAdmin())
-	incomingRoutes.GET("/users/productview", controllers.SearchProduct())
-	incomingRoutes.GET("/users/search", controllers.SearchProductByQuery())
+func UserRoutes(incomingRoutes *gin.Engine, app *controllers.Application) {
+	incomingRoutes.POST("/users/signup", app.SignUp())
+	incomingRoutes.POST("/users/login", app.Login())
+	incomingRoutes.POST("/users/refresh", app.RefreshToken())
+	incomingRoutes.GET("/users/productview", app.SearchProduct())
+	incomingRoutes.GET("/users/search", app.SearchProductByQuery())
+	incomingRoutes.GET("/users/categories", app.ListCategories())
 }
 
+// GuestRoutes are the cart routes for visitors who haven't logged in, working
+// on the guest cart of the guest_token header
+func GuestRoutes(incomingRoutes *gin.Engine, app *controllers.Application) {
+	incomingRoutes.POST("/guest/cart", app.CreateGuestCart())
+
+	guest := incomingRoutes.Group("/guest", middleware.Guest())
+	guest.GET("/addtocart", app.AddToCart())
+	guest.GET("/removeitem", app.RemoveItem())
+	guest.PUT("/setquantity", app.SetItemQuantity())
+	guest.GET("/decrementitem", app.DecrementItem())
+	guest.GET("/listcart", app.GetItemFromCart())
+}
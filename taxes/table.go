@@ -0,0 +1,125 @@
+package taxes
+
+import (
+	"fmt"
+	"strings"
+
+	"go-com/models"
+)
+
+// Rate is one row of a tax table. Region narrows it to one region of the
+// country and Class to the products of one tax class, left empty they cover
+// all of them. Basis_points is the rate in hundredths of a percent, 825 for 8.25%.
+type Rate struct {
+	Name         string `json:"name"`
+	Region       string `json:"region,omitempty"`
+	Class        string `json:"class,omitempty"`
+	Basis_points int64  `json:"basis_points"`
+}
+
+// Table is the TaxCalculator of one country, driven by its rates. Included is
+// for countries where prices are quoted with tax, like VAT in most of Europe.
+type Table struct {
+	Country  string `json:"country"`
+	Included bool   `json:"included"`
+	Rates    []Rate `json:"rates"`
+}
+
+// Check normalizes the table and makes sure every item can only match one rate
+func (table *Table) Check() error {
+	table.Country = strings.ToUpper(strings.TrimSpace(table.Country))
+	if len(table.Country) != 2 {
+		return fmt.Errorf("%w: country must be an ISO 3166-1 alpha-2 code, got %q", ErrInvalidTaxTable, table.Country)
+	}
+
+	seen := make(map[[2]string]bool, len(table.Rates))
+	for i := range table.Rates {
+		rate := &table.Rates[i]
+		rate.Region = strings.ToUpper(strings.TrimSpace(rate.Region))
+		rate.Class = strings.TrimSpace(rate.Class)
+		if rate.Name == "" {
+			return fmt.Errorf("%w: %s rate %d has no name", ErrInvalidTaxTable, table.Country, i)
+		}
+		if rate.Basis_points < 0 || rate.Basis_points > 10000 {
+			return fmt.Errorf("%w: %s rate %q must be between 0 and 10000 basis points", ErrInvalidTaxTable, table.Country, rate.Name)
+		}
+
+		key := [2]string{rate.Region, rate.Class}
+		if seen[key] {
+			return fmt.Errorf("%w: %s has more than one rate for region %q and class %q", ErrInvalidTaxTable, table.Country, rate.Region, rate.Class)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// rate finds the row for a product of the class shipped to the region, or -1.
+// A row for the class wins over the general one, and within either a row for
+// the region wins over the one for the whole country.
+func (table *Table) rate(region, class string) int {
+	for _, want := range [][2]string{{region, class}, {"", class}, {region, ""}, {"", ""}} {
+		for i, rate := range table.Rates {
+			if rate.Region == want[0] && rate.Class == want[1] {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func (table *Table) Calculate(items []Item, address models.Address) (Assessment, error) {
+	region := ""
+	if address.Region != nil {
+		region = strings.ToUpper(*address.Region)
+	}
+
+	assessment := Assessment{Included: table.Included, Lines: make([]models.Money, len(items))}
+	summed := make(map[int]int)
+	for i, item := range items {
+		assessment.Lines[i] = models.Money{Currency: item.Amount.Currency}
+		row := table.rate(region, strings.TrimSpace(item.Class))
+		if row < 0 {
+			continue
+		}
+		rate := table.Rates[row]
+
+		// Tax included in a price is the part of it that the rate came to on
+		// top of the price before tax
+		var err error
+		if table.Included {
+			assessment.Lines[i], err = item.Amount.MulRatio(rate.Basis_points, 10000+rate.Basis_points)
+		} else {
+			assessment.Lines[i], err = item.Amount.MulRatio(rate.Basis_points, 10000)
+		}
+		if err != nil {
+			return Assessment{}, err
+		}
+
+		line, ok := summed[row]
+		if !ok {
+			line = len(assessment.Tax_lines)
+			summed[row] = line
+			assessment.Tax_lines = append(assessment.Tax_lines, models.TaxLine{
+				Name:         rate.Name,
+				Country:      table.Country,
+				Region:       rate.Region,
+				Class:        rate.Class,
+				Basis_points: rate.Basis_points,
+				Included:     table.Included,
+				Taxable:      models.Money{Currency: item.Amount.Currency},
+				Amount:       models.Money{Currency: item.Amount.Currency},
+			})
+		}
+		taxLine := &assessment.Tax_lines[line]
+		if taxLine.Taxable, err = taxLine.Taxable.Add(item.Amount); err != nil {
+			return Assessment{}, err
+		}
+		if taxLine.Amount, err = taxLine.Amount.Add(assessment.Lines[i]); err != nil {
+			return Assessment{}, err
+		}
+	}
+
+	return assessment, nil
+}
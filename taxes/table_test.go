@@ -0,0 +1,182 @@
+package taxes
+
+import (
+	"errors"
+	"testing"
+
+	"go-com/models"
+)
+
+func usd(amount int64) models.Money {
+	return models.NewMoney(amount, "USD")
+}
+
+func shippedTo(country, region string) models.Address {
+	address := models.Address{Country: country}
+	if region != "" {
+		address.Region = &region
+	}
+
+	return address
+}
+
+// usTable has a country rate, a higher rate for one state and a lower one for
+// food, with its own rate in that state
+func usTable(t *testing.T) *Table {
+	t.Helper()
+
+	table := &Table{Country: "us", Rates: []Rate{
+		{Name: "Sales tax", Basis_points: 600},
+		{Name: "California sales tax", Region: "ca", Basis_points: 725},
+		{Name: "Groceries", Class: "food", Basis_points: 0},
+		{Name: "California groceries", Region: "CA", Class: "food", Basis_points: 100},
+		{Name: "Books", Class: "books", Basis_points: 200},
+	}}
+	if err := table.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	return table
+}
+
+func TestTableRatePrecedence(t *testing.T) {
+	table := usTable(t)
+
+	tests := []struct {
+		name   string
+		region string
+		class  string
+		want   string
+	}{
+		{"country rate", "NY", "", "Sales tax"},
+		{"no region", "", "", "Sales tax"},
+		{"region rate", "CA", "", "California sales tax"},
+		{"region is case insensitive", "ca", "", "California sales tax"},
+		{"class rate", "NY", "food", "Groceries"},
+		{"class and region rate", "CA", "food", "California groceries"},
+		{"class wins over region", "CA", "books", "Books"},
+		{"unknown class falls back", "NY", "toys", "Sales tax"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assessment, err := table.Calculate([]Item{{Class: test.class, Amount: usd(1000)}}, shippedTo("US", test.region))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(assessment.Tax_lines) != 1 || assessment.Tax_lines[0].Name != test.want {
+				t.Errorf("Tax_lines = %+v, want the %q rate", assessment.Tax_lines, test.want)
+			}
+		})
+	}
+}
+
+func TestTableExclusive(t *testing.T) {
+	table := usTable(t)
+
+	items := []Item{
+		{Amount: usd(1000)},
+		{Amount: usd(2999)},
+		{Class: "food", Amount: usd(450)},
+		{Class: "books", Amount: usd(1250)},
+	}
+	assessment, err := table.Calculate(items, shippedTo("US", "CA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assessment.Included {
+		t.Error("Included = true, want tax on top of the prices")
+	}
+	// 7.25% of 10.00 and 29.99, 1% of 4.50 and 2% of 12.50, rounding half away from zero
+	want := []int64{73, 217, 5, 25}
+	for i := range want {
+		if assessment.Lines[i] != usd(want[i]) {
+			t.Errorf("tax on item %d = %v, want %v", i, assessment.Lines[i], usd(want[i]))
+		}
+	}
+
+	// The two items at the state rate add up into one tax line
+	if len(assessment.Tax_lines) != 3 {
+		t.Fatalf("Tax_lines = %+v, want one for each rate used", assessment.Tax_lines)
+	}
+	state := assessment.Tax_lines[0]
+	if state.Name != "California sales tax" || state.Country != "US" || state.Region != "CA" || state.Taxable != usd(3999) || state.Amount != usd(290) {
+		t.Errorf("state tax line = %+v, want 2.90 on 39.99", state)
+	}
+}
+
+func TestTableInclusive(t *testing.T) {
+	table := &Table{Country: "DE", Included: true, Rates: []Rate{
+		{Name: "MwSt", Basis_points: 1900},
+		{Name: "MwSt ermäßigt", Class: "food", Basis_points: 700},
+	}}
+	if err := table.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	items := []Item{
+		{Amount: models.NewMoney(1190, "EUR")},
+		{Class: "food", Amount: models.NewMoney(107, "EUR")},
+		{Amount: models.NewMoney(999, "EUR")},
+	}
+	assessment, err := table.Calculate(items, shippedTo("DE", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assessment.Included {
+		t.Error("Included = false, want the tax to be part of the prices")
+	}
+	// The tax in a gross price is price * rate / (1 + rate)
+	want := []int64{190, 7, 160}
+	for i := range want {
+		if assessment.Lines[i] != models.NewMoney(want[i], "EUR") {
+			t.Errorf("tax in item %d = %v, want %v", i, assessment.Lines[i], models.NewMoney(want[i], "EUR"))
+		}
+	}
+	for _, line := range assessment.Tax_lines {
+		if !line.Included {
+			t.Errorf("tax line %q is not marked as included", line.Name)
+		}
+	}
+}
+
+func TestTableWithoutMatchingRate(t *testing.T) {
+	table := &Table{Country: "US", Rates: []Rate{{Name: "California sales tax", Region: "CA", Basis_points: 725}}}
+	if err := table.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	assessment, err := table.Calculate([]Item{{Amount: usd(1000)}}, shippedTo("US", "OR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assessment.Lines[0].IsZero() || len(assessment.Tax_lines) != 0 {
+		t.Errorf("Calculate() = %+v, want no tax where no rate applies", assessment)
+	}
+}
+
+func TestTableCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		table Table
+	}{
+		{"country is not a code", Table{Country: "USA", Rates: []Rate{{Name: "Sales tax", Basis_points: 600}}}},
+		{"rate without a name", Table{Country: "US", Rates: []Rate{{Basis_points: 600}}}},
+		{"negative rate", Table{Country: "US", Rates: []Rate{{Name: "Sales tax", Basis_points: -1}}}},
+		{"rate over 100%", Table{Country: "US", Rates: []Rate{{Name: "Sales tax", Basis_points: 10001}}}},
+		{"two rates for the same region and class", Table{Country: "US", Rates: []Rate{
+			{Name: "Groceries", Region: "CA", Class: "food", Basis_points: 100},
+			{Name: "Food", Region: " ca ", Class: "food", Basis_points: 200},
+		}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.table.Check(); !errors.Is(err, ErrInvalidTaxTable) {
+				t.Errorf("Check() error = %v, want %v", err, ErrInvalidTaxTable)
+			}
+		})
+	}
+}
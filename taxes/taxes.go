@@ -0,0 +1,117 @@
+package taxes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-com/models"
+)
+
+var ErrInvalidTaxTable = errors.New("Tax table is not valid")
+
+// Item is one line of a cart as far as tax goes: the tax class of its product
+// and what the line is worth after discounts
+type Item struct {
+	Class  string
+	Amount models.Money
+}
+
+// Assessment is the tax due on a cart. Lines holds the tax on each item, in
+// order, and Tax_lines the same tax summed up by rate. When Included is set
+// the tax is part of the prices already instead of coming on top of them.
+type Assessment struct {
+	Included  bool
+	Lines     []models.Money
+	Tax_lines []models.TaxLine
+}
+
+// TaxCalculator works out the tax on items shipped to an address
+type TaxCalculator interface {
+	Calculate(items []Item, address models.Address) (Assessment, error)
+}
+
+// NoTax charges no tax at all
+type NoTax struct{}
+
+func (NoTax) Calculate(items []Item, address models.Address) (Assessment, error) {
+	assessment := Assessment{Lines: make([]models.Money, len(items))}
+	for i, item := range items {
+		assessment.Lines[i] = models.Money{Currency: item.Amount.Currency}
+	}
+
+	return assessment, nil
+}
+
+// Registry picks the calculator for the country an order ships to. Countries
+// without a calculator of their own, and orders without an address, get the
+// fallback.
+type Registry struct {
+	calculators map[string]TaxCalculator
+	fallback    TaxCalculator
+}
+
+func NewRegistry(fallback TaxCalculator) *Registry {
+	return &Registry{calculators: make(map[string]TaxCalculator), fallback: fallback}
+}
+
+// Register makes the calculator the one for the country, by its ISO 3166-1 alpha-2 code
+func (registry *Registry) Register(country string, calculator TaxCalculator) {
+	registry.calculators[strings.ToUpper(country)] = calculator
+}
+
+func (registry *Registry) For(address *models.Address) TaxCalculator {
+	if address == nil {
+		return registry.fallback
+	}
+	if calculator, ok := registry.calculators[strings.ToUpper(address.Country)]; ok {
+		return calculator
+	}
+
+	return registry.fallback
+}
+
+// Default charges no tax anywhere
+func Default() *Registry {
+	return NewRegistry(NoTax{})
+}
+
+// Load reads a JSON array of tables and registers each for its country, on top
+// of charging no tax elsewhere
+func Load(data []byte) (*Registry, error) {
+	var tables []Table
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTaxTable, err)
+	}
+
+	registry := Default()
+	for i := range tables {
+		table := &tables[i]
+		if err := table.Check(); err != nil {
+			return nil, err
+		}
+		if _, taken := registry.calculators[table.Country]; taken {
+			return nil, fmt.Errorf("%w: %s has more than one table", ErrInvalidTaxTable, table.Country)
+		}
+		registry.Register(table.Country, table)
+	}
+
+	return registry, nil
+}
+
+// FromEnv loads the tables in the file TAX_TABLES names, or charges no tax when it isn't set
+func FromEnv() (*Registry, error) {
+	path := os.Getenv("TAX_TABLES")
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TAX_TABLES: %w", err)
+	}
+
+	return Load(data)
+}
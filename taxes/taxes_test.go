@@ -0,0 +1,69 @@
+package taxes
+
+import (
+	"errors"
+	"testing"
+
+	"go-com/models"
+)
+
+func TestLoad(t *testing.T) {
+	registry, err := Load([]byte(`[
+		{"country": "us", "rates": [{"name": "Sales tax", "basis_points": 600}]},
+		{"country": "DE", "included": true, "rates": [{"name": "MwSt", "basis_points": 1900}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		address  *models.Address
+		included bool
+		tax      int64
+	}{
+		{"table of the country", &models.Address{Country: "US"}, false, 60},
+		{"country is case insensitive", &models.Address{Country: "de"}, true, 160},
+		{"no table for the country", &models.Address{Country: "FR"}, false, 0},
+		{"no address yet", nil, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var address models.Address
+			if test.address != nil {
+				address = *test.address
+			}
+			assessment, err := registry.For(test.address).Calculate([]Item{{Amount: usd(1000)}}, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assessment.Included != test.included || assessment.Lines[0] != usd(test.tax) {
+				t.Errorf("Calculate() = %+v, want %v tax, included %v", assessment, usd(test.tax), test.included)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{`},
+		{"not a list of tables", `{"country": "US"}`},
+		{"two tables for a country", `[
+			{"country": "US", "rates": [{"name": "Sales tax", "basis_points": 600}]},
+			{"country": "us", "rates": [{"name": "Other tax", "basis_points": 500}]}
+		]`},
+		{"table that doesn't check", `[{"country": "US", "rates": [{"name": "Sales tax", "basis_points": 20000}]}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Load([]byte(test.data)); !errors.Is(err, ErrInvalidTaxTable) {
+				t.Errorf("Load() error = %v, want %v", err, ErrInvalidTaxTable)
+			}
+		})
+	}
+}
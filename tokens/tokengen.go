@@ -1,18 +1,13 @@
 package tokens
 
 import (
-	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
 	"time"
 
-	"go-com/database"
-
 	jwt "github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )	
 
 type SignedDetails struct {
@@ -20,13 +15,37 @@ type SignedDetails struct {
 	First_name 	string
 	Last_name	string
 	Uid			string
+	Role		string
+	Token_type	string
+	Family		string
 	jwt.StandardClaims
 }
 
-var UserData *mongo.Collection = database.UserData(database.Client, "Users")
+// Every login starts a token family. Refreshing swaps the refresh token for a new
+// one in the same family, so the family ties together all tokens of one login.
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+const RefreshTokenLifetime = time.Hour * time.Duration(168)
+
+// NewID returns a random id for a token family or a single token
+func NewID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err!=nil {
+		log.Panicln(err)
+	}
+
+	return hex.EncodeToString(id)
+}
+
 var SECRET_KEY = os.Getenv("SECRET_KEY")
 
-func GenerateToken(email, first_name, last_name, uid string) (signedToken, signedRefreshToken string, err error) {
+// GenerateToken signs an access token and a refresh token in the given family.
+// The refresh claims are returned as well, their Id is what the store remembers
+// as the one refresh token of the family that may still be used.
+func GenerateToken(email, first_name, last_name, uid, role, family string) (signedToken, signedRefreshToken string, refreshClaims *SignedDetails, err error) {
 	
 	// Generating a token as an instance of SignedDetails with an expiry of 24hrs
 	claims := &SignedDetails{
@@ -34,31 +53,36 @@ func GenerateToken(email, first_name, last_name, uid string) (signedToken, signe
 		First_name: first_name,
 		Last_name: last_name,
 		Uid: uid, 
+		Role: role,
+		Token_type: AccessToken,
+		Family: family,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
 		},
 	}
 
-	// Generating a Refresh token, only defines expiry. Not sure why.
-	refreshClaims := &SignedDetails{
+	// The refresh token only says who it belongs to and which login it comes from
+	refreshClaims = &SignedDetails{
+		Uid: uid,
+		Token_type: RefreshToken,
+		Family: family,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(168)).Unix(),
+			Id: NewID(),
+			ExpiresAt: time.Now().Local().Add(RefreshTokenLifetime).Unix(),
 		},
 	}
 
-	// Not sure what is happening from here on
 	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
 	if err!=nil {
-		return "", "", nil
+		return "", "", nil, err
 	}
 
 	refreshtoken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
 	if err!=nil {
-		log.Panicln(err)
-		return 
+		return "", "", nil, err
 	}
 
-	return token, refreshtoken, err
+	return token, refreshtoken, refreshClaims, nil
 }
 
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
@@ -82,38 +106,30 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 		return 
 	}
 
+	// A refresh token only buys new tokens, it doesn't open the API
+	if claims.Token_type == RefreshToken {
+		msg = "Token is invalid"
+		return nil, msg
+	}
+
 	return claims, msg 
 }
 
-func UpdateAllTokens(signedToken, signedRefreshToken, userID string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-	var updateObj primitive.D 
-
-	updateObj = append(updateObj, bson.E{Key: "token", Value: signedToken})
-	updateObj = append(updateObj, bson.E{Key: "refresh_token", Value: signedToken})
-	
-	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
-
-	// Upsert: when true a document will be inserted if no documents match the filter
-	// Seems to be an operation related to new users
-	// But it doesnt make sense because why didnt we initialise the created_at field of the user? 
-	upsert := true 
-	filter := bson.M{"user_id": userID}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	//Update the user's data in the DB
-	_, err := UserData.UpdateOne(ctx, filter, bson.D{
-		{Key: "$set", Value: updateObj},
-	},
-	&opt,
-	)
-	
-	defer cancel()
+// ValidateRefreshToken accepts only refresh tokens, which say who they belong to
+func ValidateRefreshToken(signedToken string) (claims *SignedDetails, msg string) {
+	token, err := jwt.ParseWithClaims(signedToken, &SignedDetails{}, func(token *jwt.Token)(interface{}, error) {
+		return []byte(SECRET_KEY), nil 
+	})
 	if err!=nil {
-		log.Panic(err)
+		msg = err.Error()
 		return 
 	}
-}
\ No newline at end of file
+
+	claims, ok := token.Claims.(*SignedDetails)
+	if !ok || claims.Token_type != RefreshToken || claims.Uid == "" || claims.Family == "" || claims.Id == "" {
+		msg = "Refresh token is invalid"
+		return nil, msg
+	}
+
+	return claims, msg
+}
@@ -0,0 +1,84 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func sign(t *testing.T, claims *SignedDetails, secret string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestGenerateToken(t *testing.T) {
+	SECRET_KEY = "test-secret"
+
+	token, refreshToken, refreshClaims, err := GenerateToken("ann@example.com", "Ann", "Lee", "uid1", "customer", "family1")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	claims, msg := ValidateToken(token)
+	if msg != "" {
+		t.Fatalf("ValidateToken() of the access token = %q", msg)
+	}
+	if claims.Uid != "uid1" || claims.Email != "ann@example.com" || claims.Role != "customer" || claims.Token_type != AccessToken || claims.Family != "family1" {
+		t.Errorf("access claims = %+v, want ann's access token in family1", claims)
+	}
+
+	refresh, msg := ValidateRefreshToken(refreshToken)
+	if msg != "" {
+		t.Fatalf("ValidateRefreshToken() of the refresh token = %q", msg)
+	}
+	if refresh.Uid != "uid1" || refresh.Family != "family1" || refresh.Id != refreshClaims.Id || refresh.Email != "" {
+		t.Errorf("refresh claims = %+v, want only who it belongs to and id %s", refresh, refreshClaims.Id)
+	}
+
+	// Rotating signs a new refresh token in the same family
+	_, _, rotated, err := GenerateToken("ann@example.com", "Ann", "Lee", "uid1", "customer", refresh.Family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Family != "family1" || rotated.Id == refreshClaims.Id {
+		t.Errorf("rotated refresh claims = %+v, want a new id in family1", rotated)
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	SECRET_KEY = "test-secret"
+	later, earlier := time.Now().Add(time.Hour).Unix(), time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		access  bool
+		refresh bool
+	}{
+		{"access token", sign(t, &SignedDetails{Uid: "uid1", Token_type: AccessToken, Family: "f", StandardClaims: jwt.StandardClaims{ExpiresAt: later}}, SECRET_KEY), true, false},
+		{"access token from before token types", sign(t, &SignedDetails{Uid: "uid1", StandardClaims: jwt.StandardClaims{ExpiresAt: later}}, SECRET_KEY), true, false},
+		{"refresh token", sign(t, &SignedDetails{Uid: "uid1", Token_type: RefreshToken, Family: "f", StandardClaims: jwt.StandardClaims{Id: "t", ExpiresAt: later}}, SECRET_KEY), false, true},
+		{"refresh token without a family", sign(t, &SignedDetails{Uid: "uid1", Token_type: RefreshToken, StandardClaims: jwt.StandardClaims{Id: "t", ExpiresAt: later}}, SECRET_KEY), false, false},
+		{"expired access token", sign(t, &SignedDetails{Uid: "uid1", Token_type: AccessToken, StandardClaims: jwt.StandardClaims{ExpiresAt: earlier}}, SECRET_KEY), false, false},
+		{"expired refresh token", sign(t, &SignedDetails{Uid: "uid1", Token_type: RefreshToken, Family: "f", StandardClaims: jwt.StandardClaims{Id: "t", ExpiresAt: earlier}}, SECRET_KEY), false, false},
+		{"other secret", sign(t, &SignedDetails{Uid: "uid1", Token_type: AccessToken, StandardClaims: jwt.StandardClaims{ExpiresAt: later}}, "other-secret"), false, false},
+		{"garbage", "not.a.token", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, msg := ValidateToken(test.token); (msg == "") != test.access {
+				t.Errorf("ValidateToken() = %q, want it accepted: %v", msg, test.access)
+			}
+			if _, msg := ValidateRefreshToken(test.token); (msg == "") != test.refresh {
+				t.Errorf("ValidateRefreshToken() = %q, want it accepted: %v", msg, test.refresh)
+			}
+		})
+	}
+}